@@ -0,0 +1,114 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package circuit
+
+import (
+	"errors"
+	"sync/atomic"
+)
+
+// ErrBudgetExhausted is returned by RetryBudget.Withdraw if there is no budget
+// left for another retry.
+var ErrBudgetExhausted = errors.New("retry budget exhausted")
+
+// budgetUnit is the balance of a single retry. The balance is kept as an
+// integer to be able to update it atomically.
+const budgetUnit = 1000
+
+// RetryBudgetParams are the parameters used to create a retry budget.
+type RetryBudgetParams struct {
+	// Ratio is the amount of retries permitted per request. If unset, the value
+	// is set to 0.1, i.e. one retry per ten requests.
+	Ratio float64
+	// MaxRetries is the maximal amount of retries the budget can save up, and
+	// also the amount it starts out with. If unset, the value is set to 10.
+	MaxRetries uint32
+}
+
+// RetryBudget limits the amount of retries done against a dependency, relative
+// to the amount of requests sent to it. When the budget is exhausted, retries
+// are considered anomalies and registered on the budget's breaker. Without a
+// budget, a retry storm against a struggling service may both make things worse
+// and hide the failures from the breaker, as requests eventually succeed.
+//
+// A retry budget is typically shared by all callers of a dependency:
+//
+//	if err := breaker.IsTripped(); err != nil {
+//		return err
+//	}
+//	budget.Deposit()
+//	err := performAction()
+//	for err != nil && isRetryable(err) {
+//		if budgetErr := budget.Withdraw(); budgetErr != nil {
+//			return err
+//		}
+//		err = performAction()
+//	}
+type RetryBudget struct {
+	balance int64
+	max     int64
+	deposit int64
+	breaker Breaker
+}
+
+// NewRetryBudget creates a new retry budget. If b is non-nil, every retry
+// denied by the budget registers an Anomaly on b.
+func NewRetryBudget(b Breaker, params RetryBudgetParams) *RetryBudget {
+	if params.Ratio == 0 {
+		params.Ratio = 0.1
+	}
+	if params.MaxRetries == 0 {
+		params.MaxRetries = 10
+	}
+	maxBalance := int64(params.MaxRetries) * budgetUnit
+	return &RetryBudget{
+		balance: maxBalance,
+		max:     maxBalance,
+		deposit: int64(params.Ratio * budgetUnit),
+		breaker: b,
+	}
+}
+
+// Deposit should be called for every request which is not a retry, and adds
+// Ratio retries to the budget.
+func (rb *RetryBudget) Deposit() {
+	for {
+		balance := atomic.LoadInt64(&rb.balance)
+		updated := balance + rb.deposit
+		if rb.max < updated {
+			updated = rb.max
+		}
+		if atomic.CompareAndSwapInt64(&rb.balance, balance, updated) {
+			return
+		}
+	}
+}
+
+// Withdraw should be called before every retry, and returns nil if the retry
+// is within budget. Otherwise, it registers an Anomaly on the budget's breaker.
+// If that anomaly trips the breaker, Withdraw returns ErrTripped, otherwise it
+// returns ErrBudgetExhausted.
+func (rb *RetryBudget) Withdraw() error {
+	for {
+		balance := atomic.LoadInt64(&rb.balance)
+		if balance < budgetUnit {
+			break
+		}
+		if atomic.CompareAndSwapInt64(&rb.balance, balance, balance-budgetUnit) {
+			return nil
+		}
+	}
+	if rb.breaker != nil {
+		if err := rb.breaker.Register(Anomaly); err != nil {
+			return err
+		}
+	}
+	return ErrBudgetExhausted
+}
+
+// Retries returns the amount of retries currently left in the budget.
+func (rb *RetryBudget) Retries() int {
+	return int(atomic.LoadInt64(&rb.balance) / budgetUnit)
+}
@@ -0,0 +1,37 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package circuit
+
+import "testing"
+
+func TestRetryBudget(t *testing.T) {
+	breaker := NewCountBreaker("test", CountBreakerParams{MaxAnomalies: 1})
+	budget := NewRetryBudget(breaker, RetryBudgetParams{Ratio: 0.5, MaxRetries: 2})
+	for i := 0; i < 2; i++ {
+		if err := budget.Withdraw(); err != nil {
+			t.Fatalf("Expected retry %d to be within budget, but got %s", i, err)
+		}
+	}
+	if err := budget.Withdraw(); err != ErrBudgetExhausted {
+		t.Fatalf("Expected ErrBudgetExhausted, but got %v", err)
+	}
+	budget.Deposit()
+	if budget.Retries() != 0 {
+		t.Fatalf("Expected half a retry to be rounded down, but had %d retries", budget.Retries())
+	}
+	budget.Deposit()
+	if err := budget.Withdraw(); err != nil {
+		t.Fatalf("Expected retry to be within budget after two deposits, but got %s", err)
+	}
+	if err := budget.Withdraw(); !IsErrTripped(err) {
+		t.Fatalf("Expected second exhausted withdrawal to trip the breaker, but got %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		budget.Deposit()
+	}
+	if budget.Retries() != 2 {
+		t.Fatalf("Expected budget to be capped at 2 retries, but had %d", budget.Retries())
+	}
+}
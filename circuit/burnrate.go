@@ -0,0 +1,243 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package circuit
+
+import (
+	"sync"
+	"time"
+
+	"github.com/hypirion/gluten/clock"
+)
+
+// BurnRateRule is a multi-window burn rate rule, as used for SLO alerting: The
+// rule is violated when the error budget burns at least Rate times faster than
+// sustainable over both the long and the short window. The long window makes
+// the rule robust against short spikes, and the short window makes it stop
+// firing soon after the errors stop.
+type BurnRateRule struct {
+	// LongWindow is the long window of the rule, e.g. one hour.
+	LongWindow time.Duration
+	// ShortWindow is the short window of the rule. If unset, the value is set to
+	// LongWindow/12, e.g. five minutes for a one hour long window.
+	ShortWindow time.Duration
+	// Rate is the burn rate threshold, e.g. 14.4 for spending 2% of a 30 day
+	// error budget within one hour.
+	Rate float64
+}
+
+// BurnRateParams are the parameters used to create a burn rate breaker.
+type BurnRateParams struct {
+	// SLO is the success ratio target of the service, e.g. 0.999. It must be
+	// between 0 and 1, exclusive.
+	SLO float64
+	// Rules are the burn rate rules. The breaker trips if any rule is violated.
+	Rules []BurnRateRule
+	// MinRequests is the minimal amount of requests within the short window of a
+	// rule before the rule is considered. If unset, the value is set to 10.
+	MinRequests uint64
+	// BackoffDuration is the duration the breaker will stay tripped. If unset,
+	// the value is set to one minute.
+	BackoffDuration time.Duration
+	// Resolution is the granularity responses are counted with. Windows are
+	// rounded up to a multiple of it. If unset, the value is set to ten seconds.
+	Resolution time.Duration
+	// Clock is the source of time for the breaker. If unset, the real clock is
+	// used.
+	Clock clock.Clock
+}
+
+// BurnRateBreaker is a circuit breaker driven by SLO burn rates, matching the
+// multi-window, multi-burn-rate alerting rules SREs commonly page on. This
+// keeps breaker behaviour consistent with paging thresholds: If the breaker
+// trips, someone is (or should be) paged, and vice versa.
+//
+// Success and Slow responses count as good events, every other response type
+// counts as a bad event.
+type BurnRateBreaker struct {
+	serviceName string
+	params      BurnRateParams
+	mutex       sync.Mutex
+	buckets     []burnBucket
+	tripped     bool
+	resetTime   time.Time
+}
+
+type burnBucket struct {
+	epoch int64
+	good  uint64
+	bad   uint64
+}
+
+// NewBurnRateBreaker creates a new burn rate breaker for the service with the
+// given name.
+func NewBurnRateBreaker(serviceName string, params BurnRateParams) *BurnRateBreaker {
+	if params.SLO <= 0 || 1 <= params.SLO {
+		panic("circuit: burn rate SLO must be between 0 and 1")
+	}
+	if params.MinRequests == 0 {
+		params.MinRequests = 10
+	}
+	if params.BackoffDuration == 0 {
+		params.BackoffDuration = 1 * time.Minute
+	}
+	if params.Resolution == 0 {
+		params.Resolution = 10 * time.Second
+	}
+	if params.Clock == nil {
+		params.Clock = clock.Real
+	}
+	rules := make([]BurnRateRule, len(params.Rules))
+	var maxWindow time.Duration
+	for i, rule := range params.Rules {
+		if rule.ShortWindow == 0 {
+			rule.ShortWindow = rule.LongWindow / 12
+		}
+		if maxWindow < rule.LongWindow {
+			maxWindow = rule.LongWindow
+		}
+		rules[i] = rule
+	}
+	params.Rules = rules
+	n := int(maxWindow/params.Resolution) + 2
+	return &BurnRateBreaker{
+		serviceName: serviceName,
+		params:      params,
+		buckets:     make([]burnBucket, n),
+	}
+}
+
+func (b *BurnRateBreaker) epoch(now time.Time) int64 {
+	return now.UnixNano() / int64(b.params.Resolution)
+}
+
+// bucket returns the bucket slot for epoch, which may hold an older epoch.
+func (b *BurnRateBreaker) bucket(epoch int64) *burnBucket {
+	n := int64(len(b.buckets))
+	return &b.buckets[(epoch%n+n)%n]
+}
+
+// sum returns the good and bad events within the window ending at epoch. Must
+// be called while holding the mutex.
+func (b *BurnRateBreaker) sum(epoch int64, window time.Duration) (good, bad uint64) {
+	n := int64((window + b.params.Resolution - 1) / b.params.Resolution)
+	if n < 1 {
+		n = 1
+	}
+	for e := epoch - n + 1; e <= epoch; e++ {
+		if bucket := b.bucket(e); bucket.epoch == e {
+			good += bucket.good
+			bad += bucket.bad
+		}
+	}
+	return good, bad
+}
+
+// burnRate returns the burn rate of the window ending at epoch, and whether
+// the window had enough requests. Must be called while holding the mutex.
+func (b *BurnRateBreaker) burnRate(epoch int64, window time.Duration) (float64, bool) {
+	good, bad := b.sum(epoch, window)
+	total := good + bad
+	if total == 0 {
+		return 0, false
+	}
+	errorRate := float64(bad) / float64(total)
+	return errorRate / (1 - b.params.SLO), total >= b.params.MinRequests
+}
+
+// violated returns true if any rule is violated. Must be called while holding
+// the mutex.
+func (b *BurnRateBreaker) violated(epoch int64) bool {
+	for _, rule := range b.params.Rules {
+		short, ok := b.burnRate(epoch, rule.ShortWindow)
+		if !ok || short < rule.Rate {
+			continue
+		}
+		if long, _ := b.burnRate(epoch, rule.LongWindow); rule.Rate <= long {
+			return true
+		}
+	}
+	return false
+}
+
+// maybeReset untrips the breaker if the backoff has passed. Must be called
+// while holding the mutex.
+func (b *BurnRateBreaker) maybeReset(now time.Time) {
+	if b.tripped && !now.Before(b.resetTime) {
+		b.tripped = false
+	}
+}
+
+// IsTripped returns an ErrTripped error iff the circuit breaker is tripped.
+func (b *BurnRateBreaker) IsTripped() error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.maybeReset(b.params.Clock.Now())
+	if b.tripped {
+		return ErrTripped{b.serviceName}
+	}
+	return nil
+}
+
+// Register registers the response type of an action. If this particular
+// response makes a burn rate rule violated, the breaker trips and returns an
+// ErrTripped error.
+func (b *BurnRateBreaker) Register(r ResponseType) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	now := b.params.Clock.Now()
+	b.maybeReset(now)
+	epoch := b.epoch(now)
+	bucket := b.bucket(epoch)
+	if bucket.epoch != epoch {
+		*bucket = burnBucket{epoch: epoch}
+	}
+	if r == Success || r == Slow {
+		bucket.good++
+		return nil
+	}
+	bucket.bad++
+	if b.tripped || !b.violated(epoch) {
+		return nil
+	}
+	b.tripped = true
+	b.resetTime = now.Add(b.params.BackoffDuration)
+	return ErrTripped{b.serviceName}
+}
+
+// ResetDuration returns the duration until the breaker untrips, or 0 if it is
+// not tripped.
+func (b *BurnRateBreaker) ResetDuration() time.Duration {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	now := b.params.Clock.Now()
+	b.maybeReset(now)
+	if !b.tripped {
+		return 0
+	}
+	return b.resetTime.Sub(now)
+}
+
+// State returns Open if the breaker is tripped, and Closed otherwise. A burn
+// rate breaker has no half-open state: Once the backoff has passed, it trips
+// again only if the rules are still violated.
+func (b *BurnRateBreaker) State() State {
+	if b.IsTripped() != nil {
+		return Open
+	}
+	return Closed
+}
+
+// BurnRates returns the current burn rate over the long window of each rule,
+// in the order of the rules.
+func (b *BurnRateBreaker) BurnRates() []float64 {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	epoch := b.epoch(b.params.Clock.Now())
+	rates := make([]float64, len(b.params.Rules))
+	for i, rule := range b.params.Rules {
+		rates[i], _ = b.burnRate(epoch, rule.LongWindow)
+	}
+	return rates
+}
@@ -0,0 +1,71 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package circuit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hypirion/gluten/clock"
+)
+
+func TestBurnRateBreaker(t *testing.T) {
+	clk := clock.NewFake(time.Unix(0, 0))
+	breaker := NewBurnRateBreaker("test", BurnRateParams{
+		SLO: 0.99,
+		Rules: []BurnRateRule{
+			{LongWindow: 1 * time.Hour, Rate: 14.4},
+		},
+		BackoffDuration: 1 * time.Minute,
+		Clock:           clk,
+	})
+
+	// a healthy hour: 1% errors burns exactly at rate 1
+	for i := 0; i < 360; i++ {
+		for j := 0; j < 99; j++ {
+			breaker.Register(Success)
+		}
+		if err := breaker.Register(Anomaly); err != nil {
+			t.Fatalf("Expected no trip at burn rate 1, got %v", err)
+		}
+		clk.Advance(10 * time.Second)
+	}
+	if rates := breaker.BurnRates(); rates[0] < 0.99 || 1.01 < rates[0] {
+		t.Fatalf("Expected burn rate ~1, got %v", rates)
+	}
+
+	// an outage: every request fails. The short window (5 minutes) is violated
+	// quickly, but the long window needs about 5 minutes of full failure
+	var tripped bool
+	var elapsed time.Duration
+	for !tripped && elapsed < 1*time.Hour {
+		for j := 0; j < 100 && !tripped; j++ {
+			tripped = IsErrTripped(breaker.Register(Anomaly))
+		}
+		clk.Advance(10 * time.Second)
+		elapsed += 10 * time.Second
+	}
+	if !tripped {
+		t.Fatal("Expected breaker to trip during outage")
+	}
+	if elapsed < 4*time.Minute || 10*time.Minute < elapsed {
+		t.Errorf("Expected breaker to trip after ~5 minutes, tripped after %s", elapsed)
+	}
+	if breaker.State() != Open || breaker.ResetDuration() <= 0 {
+		t.Fatal("Expected breaker to be tripped")
+	}
+
+	// after the backoff, successes through the short window keep it closed
+	clk.Advance(6 * time.Minute)
+	if breaker.IsTripped() != nil {
+		t.Fatal("Expected breaker to untrip after backoff")
+	}
+	for i := 0; i < 100; i++ {
+		breaker.Register(Success)
+	}
+	if err := breaker.Register(Anomaly); err != nil {
+		t.Fatalf("Expected recovered short window to keep breaker closed, got %v", err)
+	}
+}
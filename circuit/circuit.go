@@ -28,12 +28,23 @@
 package circuit
 
 import (
+	"context"
+	"errors"
+	"math"
 	"math/rand"
+	"strconv"
 	"sync"
 	"sync/atomic"
 	"time"
+
+	"github.com/hypirion/gluten/clock"
+	"github.com/hypirion/gluten/syncx"
 )
 
+// ErrBypassed is returned by strict count breakers when Register is called
+// while they are tripped.
+var ErrBypassed = errors.New("response registered on tripped breaker")
+
 // IsErrTripped returns true if the error is of type ErrTripped.
 func IsErrTripped(err error) bool {
 	_, ok := err.(ErrTripped)
@@ -63,8 +74,40 @@ const (
 	// Fatal is a critical error which happened on an action. Sending this
 	// should tell the circuit breaker that the service has an outage.
 	Fatal
+	// Slow is a successful action which took suspiciously long to complete. It
+	// is considered a Success, except when probing a half-open breaker: See
+	// CountBreakerParams.SlowProbeSuccesses.
+	Slow
 )
 
+// Custom is the first custom response type. Custom response types are
+// considered failures, and are only permitted on count breakers with weights
+// (see CountBreakerParams.Weights). You can define your own like so:
+//
+//	const (
+//		Timeout = circuit.Custom + iota
+//		ServerError
+//		RateLimited
+//	)
+const Custom ResponseType = 1 << 8
+
+func (r ResponseType) String() string {
+	switch r {
+	case Success:
+		return "success"
+	case Anomaly:
+		return "anomaly"
+	case Fatal:
+		return "fatal"
+	case Slow:
+		return "slow"
+	}
+	if r >= Custom {
+		return "custom(" + strconv.Itoa(int(r-Custom)) + ")"
+	}
+	return "ResponseType(" + strconv.Itoa(int(r)) + ")"
+}
+
 // Breaker is the interface for any circuit breaker
 type Breaker interface {
 	// IsTripped returns ErrTripped if the Breaker is tripped; i.e. the
@@ -79,12 +122,23 @@ type Breaker interface {
 	Register(ResponseType) error
 }
 
-// Reseter is an interface for circuit breakers that end up in "closed" state,
-// which will be reset at a certain point in time.
+// Reseter is an interface for circuit breakers that end up in a tripped (Open)
+// state, which will be reset at a certain point in time.
 type Reseter interface {
 	ResetDuration() time.Duration
 }
 
+// Forcer is an interface for circuit breakers that can be tripped and reset
+// manually, typically by an operator.
+type Forcer interface {
+	// ForceTrip trips the breaker as if it had registered too many failures.
+	// It returns ErrTripped if this changed the state of the breaker.
+	ForceTrip() error
+	// ForceReset resets the breaker to a healthy state, forgetting all
+	// registered failures.
+	ForceReset()
+}
+
 // BreakReseter is the interface that groups the basic Breaker and Sleeper
 // methods.
 type BreakReseter interface {
@@ -110,6 +164,83 @@ type CountBreakerParams struct {
 	// MaxBackoff is the maximal duration the breaker will wait before
 	// untripping. If unset, the value is set to four minutes.
 	MaxBackoff time.Duration
+	// SlowProbeSuccesses is the amount of successive Success responses a
+	// half-open breaker requires after it has registered a Slow response, before
+	// it considers the service fully recovered. This avoids flooding a service
+	// which is technically up, but still overloaded. If unset, Slow responses
+	// are treated as Success.
+	SlowProbeSuccesses uint32
+	// Probe is an optional health check the breaker calls periodically while it
+	// is tripped. If the probe returns nil, the breaker moves to a half-open
+	// state immediately instead of waiting out the remaining backoff. The context
+	// passed in is cancelled after ProbeInterval. Probing stops once the backoff
+	// has passed, the breaker is reset, or the breaker is closed: Call Close on
+	// breakers with a probe once they are no longer used.
+	Probe func(ctx context.Context) error
+	// ProbeInterval is the duration between each call to Probe. If unset, the
+	// value is set to five seconds.
+	ProbeInterval time.Duration
+	// Weights assigns weights to response types, and enables weighted tripping:
+	// If the summed weight of the responses within a time window exceeds
+	// MaxWeight, the breaker trips. Every custom response type registered must
+	// have a weight. Anomalies and fatalities have a weight of 1 unless
+	// specified, and count towards MaxAnomalies and MaxFatalities as usual.
+	Weights map[ResponseType]uint32
+	// MaxWeight is the maximal summed weight of responses the count breaker is
+	// permitted to register within the time window before it trips. It is only
+	// used if Weights is set.
+	MaxWeight uint32
+	// LeakInterval enables leaky bucket counting: Instead of resetting all
+	// counts at the end of each time window, one anomaly, one fatality and one
+	// unit of weight leak out of the count breaker every LeakInterval. This
+	// makes the breaker trip on sustained failure rates above one per
+	// LeakInterval, even if the rate is too low to trip within a single time
+	// window. The time window is still used to reset successive failures.
+	LeakInterval time.Duration
+	// RandSource is the source of randomness used to jitter backoff durations.
+	// Set it to make backoffs deterministic in tests and simulations. The source
+	// is only used while holding the breaker's lock, so it need not be safe for
+	// concurrent use. If unset, the global math/rand source is used.
+	RandSource rand.Source
+	// Shadow makes the count breaker record-only: It tracks responses and trips
+	// as usual, and Register still returns ErrTripped when it trips so that
+	// trips can be logged and measured. However, IsTripped always returns nil.
+	// Use this to try out new parameters in production before letting them shed
+	// traffic.
+	Shadow bool
+	// DegradationLevels are optional levels of partial degradation, sorted by
+	// increasing amount of anomalies. They do not affect tripping, but let you
+	// shed some low priority traffic through ShouldAllow before the service is
+	// considered down.
+	DegradationLevels []DegradationLevel
+	// OnBypass is called when Register is called on a tripped breaker, which
+	// typically means the caller did not check IsTripped before calling the
+	// service. Responses from calls that were in flight when the breaker tripped
+	// are also reported, so expect some noise around trips. OnBypass is not
+	// called in shadow mode.
+	OnBypass func(ResponseType)
+	// Strict makes the count breaker reject responses registered while it is
+	// tripped: They are not counted, and Register returns ErrBypassed. Strict
+	// has no effect in shadow mode.
+	Strict bool
+	// Clock is the source of time for the count breaker. If unset, the real
+	// clock is used. Probes are scheduled on the clock if it is a
+	// clock.TimerClock, and in real time otherwise.
+	Clock clock.Clock
+}
+
+// DegradationLevel is a partial degradation of a service. See
+// CountBreaker.ShouldAllow for how it is used.
+type DegradationLevel struct {
+	// Anomalies is the amount of anomalies within the time window at which the
+	// service enters this level.
+	Anomalies uint32
+	// ShedRatio is the ratio of requests to reject at this level, between 0
+	// and 1.
+	ShedRatio float64
+	// MinPriority is the lowest request priority which is never rejected at this
+	// level.
+	MinPriority int
 }
 
 // NewCountBreaker creates a new CountBreaker.
@@ -123,17 +254,22 @@ func NewCountBreaker(serviceName string, params CountBreakerParams) *CountBreake
 	if params.MaxBackoff == 0 {
 		params.MaxBackoff = 4 * time.Minute
 	}
+	if params.ProbeInterval == 0 {
+		params.ProbeInterval = 5 * time.Second
+	}
+	if params.Clock == nil {
+		params.Clock = clock.Real
+	}
 	breaker := &CountBreaker{serviceName: serviceName, params: params}
-	breaker.resetTime.Store(time.Now().Add(breaker.params.TimeWindow))
+	if params.RandSource != nil {
+		breaker.rand = rand.New(params.RandSource)
+	}
+	now := params.Clock.Now()
+	breaker.resetTime.Store(now.Add(breaker.params.TimeWindow))
+	breaker.lastLeak.Store(now)
 	return breaker
 }
 
-const (
-	stateOpen = iota
-	stateHalfOpen
-	stateClosed
-)
-
 // CountBreaker is a circuit breaker that counts the amount of anomalies and
 // fatalities within a specified time window. If the amount of
 // anomalies/fatalities go over the specified threshold within a single time
@@ -145,48 +281,120 @@ const (
 //
 // The timewindow is not rolling: If you receive 4 anomalies in the last 5
 // seconds of a time window, the anomaly count will still be reset to 0 when the
-// time window is reset.
+// time window is reset. Use CountBreakerParams.LeakInterval if you need
+// continuous decay instead.
 type CountBreaker struct {
 	numAnomalies       uint32
 	numFatalities      uint32
-	resetTime          atomic.Value
+	weight             uint32
+	resetTime          syncx.AtomicTime
+	lastLeak           syncx.AtomicTime
 	successiveFailures uint
-	state              uint32
+	state              syncx.AtomicEnum
+	pendingProbes      uint32
+	trips              uint64
+	probe              clock.Timer
+	closed             bool
 	serviceName        string
 	mutex              sync.Mutex
+	rand               *rand.Rand
 	params             CountBreakerParams
 }
 
 func (c *CountBreaker) maybeReset() {
-	resetTime := c.resetTime.Load().(time.Time)
-	now := time.Now()
+	resetTime := c.resetTime.Load()
+	now := c.params.Clock.Now()
 	if resetTime.Before(now) {
 		c.mutex.Lock() // To ensure only one call resets the breaker
 		// Has someone else reset the breaker while we waited for the lock? If so,
 		// just bail out.
-		updated := c.resetTime.Load().(time.Time)
-		if updated != resetTime {
+		updated := c.resetTime.Load()
+		if !updated.Equal(resetTime) {
 			c.mutex.Unlock()
 			return
 		}
 		c.resetTime.Store(now.Add(c.params.TimeWindow))
-		state := c.state
+		state := c.loadState()
 		// We might leak some requests here, but that should be fine on the edge of
 		// a time window.
-		atomic.StoreUint32(&c.numAnomalies, 0)
-		atomic.StoreUint32(&c.numFatalities, 0)
+		if state == Open || c.params.LeakInterval == 0 {
+			c.resetCounts()
+		}
 		switch state {
-		case stateOpen, stateHalfOpen:
-			atomic.StoreUint32(&c.state, stateOpen)
+		case Closed, HalfOpen:
+			c.storeState(Closed)
 			c.successiveFailures = 0
-		case stateClosed:
-			atomic.StoreUint32(&c.state, stateHalfOpen)
+		case Open:
+			c.storeState(HalfOpen)
 		}
 
 		c.mutex.Unlock()
 	}
 }
 
+func (c *CountBreaker) resetCounts() {
+	atomic.StoreUint32(&c.numAnomalies, 0)
+	atomic.StoreUint32(&c.numFatalities, 0)
+	atomic.StoreUint32(&c.weight, 0)
+}
+
+// leak leaks counts out of the bucket if leaky bucket counting is enabled.
+func (c *CountBreaker) leak() {
+	if c.params.LeakInterval == 0 {
+		return
+	}
+	lastLeak := c.lastLeak.Load()
+	leaks := c.params.Clock.Now().Sub(lastLeak) / c.params.LeakInterval
+	if leaks <= 0 {
+		return
+	}
+	// Only one caller gets to leak for this time period
+	if !c.lastLeak.CompareAndSwap(lastLeak, lastLeak.Add(leaks*c.params.LeakInterval)) {
+		return
+	}
+	n := uint32(math.MaxUint32)
+	if leaks < math.MaxUint32 {
+		n = uint32(leaks)
+	}
+	leakUint32(&c.numAnomalies, n)
+	leakUint32(&c.numFatalities, n)
+	leakUint32(&c.weight, n)
+}
+
+// leakUint32 atomically subtracts n from the value at addr, without going
+// below zero.
+func leakUint32(addr *uint32, n uint32) {
+	for {
+		old := atomic.LoadUint32(addr)
+		updated := uint32(0)
+		if n < old {
+			updated = old - n
+		}
+		if atomic.CompareAndSwapUint32(addr, old, updated) {
+			return
+		}
+	}
+}
+
+// addWeight adds the weight of r to the summed weight, and returns true if this
+// made the sum exceed the maximal weight.
+func (c *CountBreaker) addWeight(r ResponseType) bool {
+	if c.params.Weights == nil {
+		return false
+	}
+	weight, ok := c.params.Weights[r]
+	if !ok {
+		if r >= Custom {
+			panic("No weight for custom response type " + r.String())
+		}
+		weight = 1
+	}
+	prevWeight := atomic.AddUint32(&c.weight, weight) - weight
+	// Only return true on the response which exceeded the weight, to avoid lock
+	// contention.
+	return prevWeight <= c.params.MaxWeight && c.params.MaxWeight < prevWeight+weight
+}
+
 func (c *CountBreaker) trip() bool {
 	// trip may race with maybeReset for the lock, in which case, trip may
 	// overwrite the reset. This shouldn't be an issue, as this will only happen
@@ -195,12 +403,13 @@ func (c *CountBreaker) trip() bool {
 	c.mutex.Lock()
 	// Has someone else tripped the breaker while we waited for the lock? If so,
 	// just bail out.
-	state := atomic.LoadUint32(&c.state)
-	if state == stateClosed {
+	state := c.loadState()
+	if state == Open {
 		c.mutex.Unlock()
 		return false
 	}
-	atomic.StoreUint32(&c.state, stateClosed)
+	c.storeState(Open)
+	atomic.StoreUint32(&c.pendingProbes, 0)
 	// Exponential backoff with randomization to avoid a thundering herd
 	minTime := c.params.BackoffDuration << c.successiveFailures
 	maxTime := c.params.BackoffDuration << (c.successiveFailures + 1)
@@ -209,65 +418,278 @@ func (c *CountBreaker) trip() bool {
 	if extraTimeBase <= 0 {
 		extraTimeBase = int64(5 * time.Minute)
 	}
-	extraTime := time.Duration(rand.Int63n(extraTimeBase))
+	var extraTime time.Duration
+	if c.rand != nil {
+		extraTime = time.Duration(c.rand.Int63n(extraTimeBase))
+	} else {
+		extraTime = time.Duration(rand.Int63n(extraTimeBase))
+	}
 
 	totalTime := minTime + extraTime
 	if c.params.MaxBackoff <= totalTime {
 		totalTime = c.params.MaxBackoff
 	}
-	c.resetTime.Store(time.Now().Add(totalTime))
+	c.resetTime.Store(c.params.Clock.Now().Add(totalTime))
 	c.successiveFailures++
+	c.trips++
+	if c.params.Probe != nil {
+		c.scheduleProbe(c.trips)
+	}
 	c.mutex.Unlock()
 	// Do not return error if we trip from a half-open state
-	return state == stateOpen
+	return state == Closed
+}
+
+// scheduleProbe schedules a probe for the trip with the given trip number.
+// Must be called while holding the mutex.
+func (c *CountBreaker) scheduleProbe(trip uint64) {
+	if c.closed {
+		return
+	}
+	c.probe = clock.AfterFunc(c.params.Clock, c.params.ProbeInterval, func() {
+		// Once the backoff has passed, the breaker half-opens on its next use
+		// anyway.
+		if c.loadState() != Open || !c.params.Clock.Now().Before(c.resetTime.Load()) {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), c.params.ProbeInterval)
+		err := c.params.Probe(ctx)
+		cancel()
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+		// Bail out if the breaker has been reset or tripped again while we probed:
+		// In the latter case, another probe is already scheduled.
+		if c.closed || c.loadState() != Open || c.trips != trip {
+			return
+		}
+		if err != nil {
+			c.scheduleProbe(trip)
+			return
+		}
+		c.halfOpen()
+	})
+}
+
+// halfOpen moves a tripped breaker to the half-open state ahead of its reset
+// time. Must be called while holding the mutex.
+func (c *CountBreaker) halfOpen() {
+	c.resetTime.Store(c.params.Clock.Now().Add(c.params.TimeWindow))
+	c.resetCounts()
+	c.storeState(HalfOpen)
+}
+
+// ForceTrip trips the count breaker, as if it had registered too many
+// failures. Like Register, it returns ErrTripped only if the breaker was closed,
+// and nil if it was half-open or already tripped.
+func (c *CountBreaker) ForceTrip() error {
+	c.maybeReset()
+	if c.trip() {
+		return ErrTripped{c.serviceName}
+	}
+	return nil
+}
+
+// ForceReset resets the count breaker to its initial state: Untripped, with no
+// registered failures.
+func (c *CountBreaker) ForceReset() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	now := c.params.Clock.Now()
+	c.resetTime.Store(now.Add(c.params.TimeWindow))
+	c.lastLeak.Store(now)
+	c.resetCounts()
+	c.successiveFailures = 0
+	atomic.StoreUint32(&c.pendingProbes, 0)
+	c.storeState(Closed)
+	c.stopProbe()
+}
+
+// stopProbe stops the scheduled probe, if any. Must be called while holding the
+// mutex.
+func (c *CountBreaker) stopProbe() {
+	if c.probe != nil {
+		c.probe.Stop()
+		c.probe = nil
+	}
+}
+
+// Close stops the active probing of a breaker created with a Probe, so that
+// the breaker can be garbage collected while tripped. The breaker otherwise
+// keeps working, but is no longer probed when it trips. Close always returns
+// nil.
+func (c *CountBreaker) Close() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.closed = true
+	c.stopProbe()
+	return nil
+}
+
+// CountBreakerStats is a snapshot of the state of a CountBreaker.
+type CountBreakerStats struct {
+	// State is the state of the breaker.
+	State State
+	// Anomalies, Fatalities and Weight are the counts in the current time
+	// window (or bucket, if leaky bucket counting is used).
+	Anomalies  uint32
+	Fatalities uint32
+	Weight     uint32
+	// Level is the current degradation level, see CountBreaker.Level.
+	Level int
+	// ResetDuration is the duration until the breaker untrips, see
+	// CountBreaker.ResetDuration.
+	ResetDuration time.Duration
+}
+
+// Stats returns a snapshot of the state of the count breaker. The fields are
+// read individually, so the snapshot may be slightly inconsistent if the
+// breaker is in use.
+func (c *CountBreaker) Stats() CountBreakerStats {
+	level := c.Level()
+	return CountBreakerStats{
+		State:         c.loadState(),
+		Anomalies:     atomic.LoadUint32(&c.numAnomalies),
+		Fatalities:    atomic.LoadUint32(&c.numFatalities),
+		Weight:        atomic.LoadUint32(&c.weight),
+		Level:         level,
+		ResetDuration: c.ResetDuration(),
+	}
 }
 
 // IsTripped returns an ErrTripped error iff the circuit breaker is tripped.
+// In shadow mode, IsTripped always returns nil.
 func (c *CountBreaker) IsTripped() error {
 	c.maybeReset()
-	state := atomic.LoadUint32(&c.state)
+	state := c.loadState()
 	switch state {
-	case stateOpen, stateHalfOpen:
+	case Closed, HalfOpen:
 		return nil
-	case stateClosed:
+	case Open:
+		if c.params.Shadow {
+			return nil
+		}
 		return ErrTripped{c.serviceName}
 	}
 	panic("Implementation error in CountBreaker")
 }
 
-// ResetDuration returns the duration the circuit breaker is back in a
-// non-closed state. If the count breaker is already in a non-closed state,
-// 0 is returned.
+// Level returns the current degradation level of the service: 0 if the
+// service is healthy, i if the service is in the ith level of
+// CountBreakerParams.DegradationLevels, and len(DegradationLevels)+1 if the
+// breaker is tripped.
+func (c *CountBreaker) Level() int {
+	c.maybeReset()
+	c.leak()
+	if c.loadState() == Open {
+		return len(c.params.DegradationLevels) + 1
+	}
+	anomalies := atomic.LoadUint32(&c.numAnomalies)
+	level := 0
+	for i, dl := range c.params.DegradationLevels {
+		if dl.Anomalies <= anomalies {
+			level = i + 1
+		}
+	}
+	return level
+}
+
+// ShouldAllow reports whether a request with the given priority should be sent
+// to the service. It returns false if the breaker is tripped, and if the
+// service is in a degradation level, it randomly rejects requests below the
+// level's MinPriority with probability ShedRatio. In shadow mode, ShouldAllow
+// always returns true.
+func (c *CountBreaker) ShouldAllow(priority int) bool {
+	if c.params.Shadow {
+		return true
+	}
+	level := c.Level()
+	switch {
+	case level == 0:
+		return true
+	case len(c.params.DegradationLevels) < level:
+		return false
+	}
+	dl := c.params.DegradationLevels[level-1]
+	return dl.MinPriority <= priority || dl.ShedRatio <= c.randFloat64()
+}
+
+// randFloat64 returns a random number in [0, 1). Must not be called while
+// holding the mutex.
+func (c *CountBreaker) randFloat64() float64 {
+	if c.rand == nil {
+		return rand.Float64()
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.rand.Float64()
+}
+
+// ResetDuration returns the duration until the circuit breaker leaves the Open
+// state. If the count breaker is not Open, 0 is returned.
 func (c *CountBreaker) ResetDuration() time.Duration {
-	state := atomic.LoadUint32(&c.state)
-	if state != stateClosed {
+	state := c.loadState()
+	if state != Open {
 		return 0
 	}
-	now := time.Now()
-	resetTime := c.resetTime.Load().(time.Time)
+	now := c.params.Clock.Now()
+	resetTime := c.resetTime.Load()
 	if resetTime.Before(now) {
 		return 0
 	}
 	return resetTime.Sub(now)
 }
 
+// probeSucceeded registers a successful probe in a half-open state, and
+// returns true if there are no more pending probes.
+func (c *CountBreaker) probeSucceeded() bool {
+	for {
+		pending := atomic.LoadUint32(&c.pendingProbes)
+		if pending == 0 {
+			return true
+		}
+		if atomic.CompareAndSwapUint32(&c.pendingProbes, pending, pending-1) {
+			return pending == 1
+		}
+	}
+}
+
 // Register registers the response type of an action. If this particular
-// response causes a trip, the count breaker will return an ErrTripped error.
+// response causes a trip, the count breaker will return an ErrTripped error. If
+// the count breaker is strict and already tripped, it returns ErrBypassed.
 func (c *CountBreaker) Register(r ResponseType) error {
 	c.maybeReset()
-	state := atomic.LoadUint32(&c.state)
+	c.leak()
+	state := c.loadState()
+	if state == Open && !c.params.Shadow {
+		if c.params.OnBypass != nil {
+			c.params.OnBypass(r)
+		}
+		if c.params.Strict {
+			return ErrBypassed
+		}
+	}
 	switch r {
-	case Success:
-		if state == stateHalfOpen { // Assume the service is back up again
-			atomic.StoreUint32(&c.state, stateOpen)
+	case Success, Slow:
+		if state != HalfOpen {
+			break
+		}
+		if r == Slow && c.params.SlowProbeSuccesses != 0 {
+			// The service is up, but struggling. Wait for some fast responses before
+			// we consider it to be back up again.
+			atomic.StoreUint32(&c.pendingProbes, c.params.SlowProbeSuccesses)
+			break
+		}
+		if c.probeSucceeded() { // Assume the service is back up again
+			c.storeState(Closed)
 			// ... but note that we don't reset successive failures. If we end up
 			// tripping in this time window, we will still consider it a successive
 			// failure from last trip.
 		}
 	case Anomaly:
 		prevAnomalies := atomic.AddUint32(&c.numAnomalies, 1) - 1
+		overweight := c.addWeight(r)
 		// Exact match to avoid multiple trips, as that would cause lock contention
-		if c.params.MaxAnomalies == prevAnomalies || state == stateHalfOpen {
+		if c.params.MaxAnomalies == prevAnomalies || overweight || state == HalfOpen {
 			if c.trip() {
 				return ErrTripped{c.serviceName}
 			}
@@ -275,16 +697,24 @@ func (c *CountBreaker) Register(r ResponseType) error {
 	case Fatal:
 		prevAnomalies := atomic.AddUint32(&c.numAnomalies, 1) - 1
 		prevFatalities := atomic.AddUint32(&c.numFatalities, 1) - 1
+		overweight := c.addWeight(r)
 		// Exact match to avoid multiple error values, to avoid lock contention.
 		// Since we may trip on both anomalies and fatalities, we also check the
 		// return value of trip, which will guarantee only one error.
-		if c.params.MaxFatalities == prevFatalities || c.params.MaxAnomalies == prevAnomalies || state == stateHalfOpen {
+		if c.params.MaxFatalities == prevFatalities || c.params.MaxAnomalies == prevAnomalies || overweight || state == HalfOpen {
 			if c.trip() {
 				return ErrTripped{c.serviceName}
 			}
 		}
 	default:
-		panic("Unknown response type")
+		if r < Custom || c.params.Weights == nil {
+			panic("Unknown response type")
+		}
+		if c.addWeight(r) || state == HalfOpen {
+			if c.trip() {
+				return ErrTripped{c.serviceName}
+			}
+		}
 	}
 	return nil
 }
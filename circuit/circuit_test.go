@@ -5,12 +5,17 @@
 package circuit
 
 import (
+	"context"
+	"errors"
 	"math/rand"
 	"reflect"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"testing/quick"
 	"time"
+
+	"github.com/hypirion/gluten/clock"
 )
 
 type SmallUint32 uint32
@@ -190,7 +195,7 @@ func TestHalfOpen(t *testing.T) {
 	if breaker.IsTripped() != nil {
 		t.Error("Expected breaker to be untripped")
 	}
-	if breaker.state != stateHalfOpen {
+	if breaker.loadState() != HalfOpen {
 		t.Error("Expected breaker to be half-open")
 	}
 	if breaker.Register(Anomaly) != nil {
@@ -203,19 +208,381 @@ func TestHalfOpen(t *testing.T) {
 	if breaker.IsTripped() != nil {
 		t.Error("Expected breaker to be untripped")
 	}
-	if breaker.state != stateHalfOpen {
+	if breaker.loadState() != HalfOpen {
 		t.Error("Expected breaker to be half-open")
 	}
 	if breaker.Register(Success) != nil {
 		t.Error("Breaker shouldn't trip on success")
 	}
-	if breaker.state != stateOpen {
+	if breaker.loadState() != Closed {
 		t.Error("Expected breaker to be open")
 	}
 	if breaker.Register(Success) != nil {
 		t.Error("Breaker shouldn't trip on first anomaly")
 	}
-	if breaker.state != stateOpen {
+	if breaker.loadState() != Closed {
 		t.Error("Expected breaker to be open")
 	}
 }
+
+func TestSlowProbe(t *testing.T) {
+	params := CountBreakerParams{
+		MaxAnomalies:       0,
+		MaxBackoff:         1 * time.Millisecond,
+		SlowProbeSuccesses: 2,
+	}
+	breaker := NewCountBreaker("test", params)
+	if !IsErrTripped(breaker.Register(Anomaly)) {
+		t.Error("Expected breaker to trip after first anomaly")
+	}
+	time.Sleep(2 * time.Millisecond)
+	if breaker.IsTripped() != nil {
+		t.Error("Expected breaker to be untripped")
+	}
+	if breaker.Register(Slow) != nil {
+		t.Error("Breaker shouldn't trip on slow response")
+	}
+	if breaker.loadState() != HalfOpen {
+		t.Error("Expected breaker to be half-open after slow probe")
+	}
+	if breaker.Register(Success) != nil {
+		t.Error("Breaker shouldn't trip on success")
+	}
+	if breaker.loadState() != HalfOpen {
+		t.Error("Expected breaker to be half-open after one fast probe")
+	}
+	if breaker.Register(Success) != nil {
+		t.Error("Breaker shouldn't trip on success")
+	}
+	if breaker.loadState() != Closed {
+		t.Error("Expected breaker to be open after two fast probes")
+	}
+	if breaker.Register(Slow) != nil {
+		t.Error("Breaker shouldn't trip on slow response")
+	}
+	if breaker.loadState() != Closed {
+		t.Error("Expected slow response to not affect an open breaker")
+	}
+}
+
+func TestActiveProbe(t *testing.T) {
+	var healthy atomic.Bool
+	params := CountBreakerParams{
+		MaxAnomalies: 0,
+		Probe: func(ctx context.Context) error {
+			if !healthy.Load() {
+				return errors.New("still down")
+			}
+			return nil
+		},
+		ProbeInterval: 1 * time.Millisecond,
+	}
+	breaker := NewCountBreaker("test", params)
+	if !IsErrTripped(breaker.Register(Anomaly)) {
+		t.Fatal("Expected breaker to trip after first anomaly")
+	}
+	time.Sleep(5 * time.Millisecond)
+	if !IsErrTripped(breaker.IsTripped()) {
+		t.Fatal("Expected breaker to stay tripped while probe fails")
+	}
+	healthy.Store(true)
+	deadline := time.Now().Add(1 * time.Second)
+	for breaker.IsTripped() != nil {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected breaker to untrip after successful probe")
+		}
+		time.Sleep(1 * time.Millisecond)
+	}
+	if breaker.loadState() != HalfOpen {
+		t.Error("Expected breaker to be half-open after successful probe")
+	}
+}
+
+func TestSimulatedProbe(t *testing.T) {
+	sim := clock.NewSim(time.Unix(0, 0))
+	healthy := false
+	probes := 0
+	breaker := NewCountBreaker("test", CountBreakerParams{
+		BackoffDuration: 1 * time.Hour,
+		MaxBackoff:      1 * time.Hour,
+		ProbeInterval:   5 * time.Minute,
+		Probe: func(ctx context.Context) error {
+			probes++
+			if !healthy {
+				return errors.New("still down")
+			}
+			return nil
+		},
+		Clock: sim,
+	})
+	breaker.Register(Anomaly)
+	sim.Advance(30 * time.Minute)
+	if probes != 6 || !IsErrTripped(breaker.IsTripped()) {
+		t.Fatalf("Expected 6 failed probes within 30 minutes, got %d", probes)
+	}
+	healthy = true
+	sim.Advance(5 * time.Minute)
+	if breaker.State() != HalfOpen {
+		t.Fatalf("Expected successful probe to half-open the breaker, was %s", breaker.State())
+	}
+}
+
+func TestProbeLifetime(t *testing.T) {
+	sim := clock.NewSim(time.Unix(0, 0))
+	probes := 0
+	breaker := NewCountBreaker("test", CountBreakerParams{
+		BackoffDuration: 1 * time.Hour,
+		MaxBackoff:      1 * time.Hour,
+		ProbeInterval:   5 * time.Minute,
+		Probe: func(ctx context.Context) error {
+			probes++
+			return errors.New("still down")
+		},
+		Clock: sim,
+	})
+	breaker.Register(Anomaly)
+	sim.Advance(3 * time.Hour)
+	if probes != 11 || sim.Pending() != 0 {
+		t.Fatalf("Expected probing to stop once the backoff passed, got %d probes and %d timers", probes, sim.Pending())
+	}
+
+	breaker.ForceReset()
+	breaker.ForceTrip()
+	breaker.ForceReset()
+	if sim.Pending() != 0 {
+		t.Fatal("Expected ForceReset to stop probing")
+	}
+
+	breaker.ForceTrip()
+	breaker.Close()
+	if sim.Pending() != 0 {
+		t.Fatal("Expected Close to stop probing")
+	}
+	breaker.ForceReset()
+	breaker.ForceTrip()
+	if sim.Pending() != 0 {
+		t.Fatal("Expected a closed breaker to not probe")
+	}
+}
+
+func TestWeights(t *testing.T) {
+	const (
+		timeout = Custom + iota
+		rateLimited
+	)
+	params := CountBreakerParams{
+		MaxAnomalies:  100,
+		MaxFatalities: 100,
+		Weights: map[ResponseType]uint32{
+			timeout:     3,
+			rateLimited: 1,
+			Fatal:       2,
+		},
+		MaxWeight: 7,
+	}
+	breaker := NewCountBreaker("test", params)
+	for _, r := range []ResponseType{timeout, rateLimited, Fatal, Success} {
+		if breaker.Register(r) != nil {
+			t.Fatalf("Breaker tripped on %s before exceeding max weight", r)
+		}
+	}
+	if breaker.Register(Anomaly) != nil {
+		t.Fatal("Breaker tripped at max weight")
+	}
+	if !IsErrTripped(breaker.Register(rateLimited)) {
+		t.Fatal("Expected breaker to trip after exceeding max weight")
+	}
+}
+
+func TestLeakyBucket(t *testing.T) {
+	params := CountBreakerParams{
+		MaxAnomalies: 2,
+		LeakInterval: 50 * time.Millisecond,
+	}
+	breaker := NewCountBreaker("test", params)
+	if breaker.Register(Anomaly) != nil {
+		t.Fatal("Breaker immediately tripped")
+	}
+	time.Sleep(60 * time.Millisecond)
+	for i := 0; i < 2; i++ {
+		if breaker.Register(Anomaly) != nil {
+			t.Fatal("Expected first anomaly to have leaked out of the bucket")
+		}
+	}
+	if !IsErrTripped(breaker.Register(Anomaly)) {
+		t.Fatal("Expected breaker to trip when the bucket overflows")
+	}
+}
+
+func TestSimulatedLeakyBucketAtEpoch(t *testing.T) {
+	sim := clock.NewSim(time.Unix(0, 0))
+	breaker := NewCountBreaker("test", CountBreakerParams{
+		MaxAnomalies: 1,
+		LeakInterval: time.Minute,
+		Clock:        sim,
+	})
+	if breaker.Register(Anomaly) != nil {
+		t.Fatal("Breaker immediately tripped")
+	}
+	sim.Advance(time.Minute)
+	if breaker.Register(Anomaly) != nil {
+		t.Fatal("Expected first anomaly to have leaked out of the bucket")
+	}
+	sim.Advance(30 * time.Second)
+	if !IsErrTripped(breaker.Register(Anomaly)) {
+		t.Fatal("Expected breaker to trip when nothing has leaked out yet")
+	}
+}
+
+func TestForceTrip(t *testing.T) {
+	sim := clock.NewSim(time.Unix(0, 0))
+	breaker := NewCountBreaker("test", CountBreakerParams{
+		BackoffDuration: time.Minute,
+		MaxBackoff:      time.Minute,
+		Clock:           sim,
+	})
+	if !IsErrTripped(breaker.ForceTrip()) {
+		t.Fatal("Expected ForceTrip to trip the breaker")
+	}
+	if err := breaker.ForceTrip(); err != nil {
+		t.Fatalf("Expected ForceTrip on a tripped breaker to return nil, got %v", err)
+	}
+	// Once the backoff has passed, the breaker is half-open, even if nothing has
+	// observed it yet.
+	sim.Advance(2 * time.Minute)
+	if err := breaker.ForceTrip(); err != nil {
+		t.Fatalf("Expected ForceTrip from half-open to return nil, got %v", err)
+	}
+	if !IsErrTripped(breaker.IsTripped()) {
+		t.Fatal("Expected ForceTrip to trip the breaker again after its backoff")
+	}
+}
+
+func TestRandSource(t *testing.T) {
+	params := CountBreakerParams{
+		MaxAnomalies: 0,
+		RandSource:   rand.NewSource(42),
+	}
+	breaker := NewCountBreaker("test", params)
+	if !IsErrTripped(breaker.Register(Anomaly)) {
+		t.Fatal("Expected breaker to trip on first anomaly")
+	}
+	expected := 1*time.Minute + time.Duration(rand.New(rand.NewSource(42)).Int63n(int64(1*time.Minute)))
+	duration := breaker.ResetDuration()
+	if duration < expected-100*time.Millisecond || expected < duration {
+		t.Fatalf("Expected breaker to wait for %s, but waits for %s", expected, duration)
+	}
+}
+
+func TestShadow(t *testing.T) {
+	params := CountBreakerParams{
+		MaxAnomalies: 0,
+		Shadow:       true,
+	}
+	breaker := NewCountBreaker("test", params)
+	if !IsErrTripped(breaker.Register(Anomaly)) {
+		t.Fatal("Expected shadow breaker to report trip from Register")
+	}
+	if breaker.IsTripped() != nil {
+		t.Fatal("Expected shadow breaker to never be tripped")
+	}
+	if breaker.ResetDuration() == 0 {
+		t.Fatal("Expected shadow breaker to report its backoff")
+	}
+}
+
+func TestDegradationLevels(t *testing.T) {
+	params := CountBreakerParams{
+		MaxAnomalies: 10,
+		DegradationLevels: []DegradationLevel{
+			{Anomalies: 2, ShedRatio: 0.5, MinPriority: 1},
+			{Anomalies: 5, ShedRatio: 1, MinPriority: 2},
+		},
+		RandSource: rand.NewSource(1),
+	}
+	breaker := NewCountBreaker("test", params)
+	register := func(n int) {
+		for i := 0; i < n; i++ {
+			breaker.Register(Anomaly)
+		}
+	}
+	if breaker.Level() != 0 || !breaker.ShouldAllow(0) {
+		t.Fatal("Expected healthy breaker to allow everything")
+	}
+	register(2)
+	if breaker.Level() != 1 {
+		t.Fatalf("Expected level 1, but was %d", breaker.Level())
+	}
+	allowed := 0
+	for i := 0; i < 1000; i++ {
+		if breaker.ShouldAllow(0) {
+			allowed++
+		}
+		if !breaker.ShouldAllow(1) {
+			t.Fatal("Expected priority 1 to never be shed at level 1")
+		}
+	}
+	if allowed < 400 || 600 < allowed {
+		t.Fatalf("Expected about half of low priority requests to be shed, but %d/1000 were allowed", allowed)
+	}
+	register(3)
+	if breaker.Level() != 2 || breaker.ShouldAllow(1) || !breaker.ShouldAllow(2) {
+		t.Fatal("Expected level 2 to shed everything below priority 2")
+	}
+	register(6)
+	if breaker.Level() != 3 || breaker.ShouldAllow(100) {
+		t.Fatal("Expected tripped breaker to shed everything")
+	}
+}
+
+func TestStrict(t *testing.T) {
+	var bypassed []ResponseType
+	params := CountBreakerParams{
+		MaxAnomalies: 0,
+		Strict:       true,
+		OnBypass: func(r ResponseType) {
+			bypassed = append(bypassed, r)
+		},
+	}
+	breaker := NewCountBreaker("test", params)
+	if breaker.Register(Success) != nil {
+		t.Fatal("Expected success to be registered")
+	}
+	if !IsErrTripped(breaker.Register(Anomaly)) {
+		t.Fatal("Expected breaker to trip on first anomaly")
+	}
+	if err := breaker.Register(Fatal); err != ErrBypassed {
+		t.Fatalf("Expected ErrBypassed, but got %v", err)
+	}
+	if breaker.numFatalities != 0 {
+		t.Fatal("Expected bypassing response to not be counted")
+	}
+	if len(bypassed) != 1 || bypassed[0] != Fatal {
+		t.Fatalf("Expected OnBypass to be called once with fatal, but got %v", bypassed)
+	}
+}
+
+func TestState(t *testing.T) {
+	clk := clock.NewFake(time.Unix(0, 0))
+	breaker := NewCountBreaker("test", CountBreakerParams{
+		MaxAnomalies:    1,
+		TimeWindow:      1 * time.Second,
+		BackoffDuration: 1 * time.Second,
+		Clock:           clk,
+	})
+	if s := breaker.State(); s != Closed {
+		t.Errorf("Expected new breaker to be %s, was %s", Closed, s)
+	}
+	breaker.Register(Anomaly)
+	breaker.Register(Anomaly)
+	if s := breaker.State(); s != Open {
+		t.Errorf("Expected tripped breaker to be %s, was %s", Open, s)
+	}
+	if stats := breaker.Stats(); stats.State != Open {
+		t.Errorf("Expected stats to agree with state, but got %+v", stats)
+	}
+	clk.Advance(2 * time.Second)
+	if s := breaker.State(); s != HalfOpen {
+		t.Errorf("Expected expired breaker to be %s, was %s", HalfOpen, s)
+	}
+}
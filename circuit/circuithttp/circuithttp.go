@@ -0,0 +1,176 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package circuithttp provides an HTTP handler for introspecting and operating
+// the breakers in a circuit.Registry.
+//
+// The handler is typically mounted under a debug path:
+//
+//	mux.Handle("/debug/circuits/", http.StripPrefix("/debug/circuits", circuithttp.Handler(registry)))
+//
+// It serves the following endpoints, relative to where it is mounted:
+//
+//	GET  /               JSON list of all breakers and their state
+//	GET  /?format=html   The same as a minimal HTML page
+//	POST /{name}/trip    Force trip the named breaker
+//	POST /{name}/reset   Force reset the named breaker
+//
+// Forcing only works for breakers implementing circuit.Forcer.
+package circuithttp
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/hypirion/gluten/circuit"
+)
+
+// BreakerStatus is the JSON representation of a breaker.
+type BreakerStatus struct {
+	Name    string `json:"name"`
+	Tripped bool   `json:"tripped"`
+	// State is the state of the breaker, if it is a circuit.Stater.
+	State string `json:"state,omitempty"`
+	// ResetIn is the duration until the breaker untrips, if the breaker is a
+	// circuit.Reseter.
+	ResetIn string `json:"reset_in,omitempty"`
+	// Stats are the statistics of the breaker, if it is a CountBreaker.
+	Stats *Stats `json:"stats,omitempty"`
+}
+
+// Stats is the JSON representation of circuit.CountBreakerStats.
+type Stats struct {
+	HalfOpen   bool   `json:"half_open"`
+	Anomalies  uint32 `json:"anomalies"`
+	Fatalities uint32 `json:"fatalities"`
+	Weight     uint32 `json:"weight"`
+	Level      int    `json:"level"`
+}
+
+type statser interface {
+	Stats() circuit.CountBreakerStats
+}
+
+// Status returns the status of the named breaker.
+func Status(name string, b circuit.Breaker) BreakerStatus {
+	status := BreakerStatus{
+		Name:    name,
+		Tripped: circuit.IsErrTripped(b.IsTripped()),
+	}
+	if st, ok := b.(circuit.Stater); ok {
+		status.State = st.State().String()
+	}
+	if r, ok := b.(circuit.Reseter); ok {
+		if d := r.ResetDuration(); d != 0 {
+			status.ResetIn = d.Round(time.Millisecond).String()
+		}
+	}
+	if s, ok := b.(statser); ok {
+		stats := s.Stats()
+		status.Stats = &Stats{
+			HalfOpen:   stats.State == circuit.HalfOpen,
+			Anomalies:  stats.Anomalies,
+			Fatalities: stats.Fatalities,
+			Weight:     stats.Weight,
+			Level:      stats.Level,
+		}
+	}
+	return status
+}
+
+// Handler returns an HTTP handler for the breakers in reg.
+func Handler(reg *circuit.Registry) http.Handler {
+	return &handler{reg: reg}
+}
+
+type handler struct {
+	reg *circuit.Registry
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(r.URL.Path, "/")
+	if path == "" {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.list(w, r)
+		return
+	}
+	idx := strings.LastIndexByte(path, '/')
+	if idx < 0 {
+		http.NotFound(w, r)
+		return
+	}
+	name, action := path[:idx], path[idx+1:]
+	if action != "trip" && action != "reset" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	b := h.reg.Get(name)
+	if b == nil {
+		http.NotFound(w, r)
+		return
+	}
+	forcer, ok := b.(circuit.Forcer)
+	if !ok {
+		http.Error(w, "breaker cannot be forced", http.StatusNotImplemented)
+		return
+	}
+	if action == "trip" {
+		forcer.ForceTrip()
+	} else {
+		forcer.ForceReset()
+	}
+	writeJSON(w, Status(name, b))
+}
+
+func (h *handler) list(w http.ResponseWriter, r *http.Request) {
+	names := h.reg.Names()
+	statuses := make([]BreakerStatus, 0, len(names))
+	for _, name := range names {
+		if b := h.reg.Get(name); b != nil {
+			statuses = append(statuses, Status(name, b))
+		}
+	}
+	if r.URL.Query().Get("format") == "html" {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		listTemplate.Execute(w, statuses)
+		return
+	}
+	writeJSON(w, statuses)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+var listTemplate = template.Must(template.New("list").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Circuit breakers</title></head>
+<body>
+<table>
+<tr><th>Name</th><th>State</th><th>Reset in</th><th>Anomalies</th><th>Fatalities</th><th>Level</th></tr>
+{{range .}}<tr>
+<td>{{.Name}}</td>
+<td>{{if .Tripped}}tripped{{else if and .Stats .Stats.HalfOpen}}half-open{{else}}ok{{end}}</td>
+<td>{{.ResetIn}}</td>
+{{with .Stats}}<td>{{.Anomalies}}</td><td>{{.Fatalities}}</td><td>{{.Level}}</td>{{else}}<td></td><td></td><td></td>{{end}}
+</tr>
+{{end}}</table>
+</body>
+</html>
+`))
@@ -0,0 +1,68 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package circuithttp
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hypirion/gluten/circuit"
+)
+
+func TestHandler(t *testing.T) {
+	reg := circuit.NewRegistry()
+	db := circuit.NewCountBreaker("db", circuit.CountBreakerParams{MaxAnomalies: 10})
+	if err := reg.Add("db", db); err != nil {
+		t.Fatal(err)
+	}
+	db.Register(circuit.Anomaly)
+	h := Handler(reg)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	var statuses []BreakerStatus
+	if err := json.NewDecoder(rec.Body).Decode(&statuses); err != nil {
+		t.Fatal(err)
+	}
+	if len(statuses) != 1 || statuses[0].Name != "db" || statuses[0].Tripped {
+		t.Fatalf("Unexpected statuses: %+v", statuses)
+	}
+	if statuses[0].Stats == nil || statuses[0].Stats.Anomalies != 1 {
+		t.Fatalf("Expected stats with 1 anomaly, but got %+v", statuses[0].Stats)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("POST", "/db/trip", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200 on trip, but got %d", rec.Code)
+	}
+	if !circuit.IsErrTripped(db.IsTripped()) {
+		t.Fatal("Expected breaker to be tripped")
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/?format=html", nil))
+	if !strings.Contains(rec.Body.String(), "<td>tripped</td>") {
+		t.Fatalf("Expected HTML page to show tripped breaker, but was:\n%s", rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("POST", "/db/reset", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200 on reset, but got %d", rec.Code)
+	}
+	if db.IsTripped() != nil {
+		t.Fatal("Expected breaker to be reset")
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("POST", "/unknown/trip", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("Expected 404 for unknown breaker, but got %d", rec.Code)
+	}
+}
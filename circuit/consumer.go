@@ -0,0 +1,142 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package circuit
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/hypirion/gluten/clock"
+)
+
+// Consumer is implemented by message queue consumers that can temporarily stop
+// pulling messages, such as wrappers around Kafka or SQS clients.
+type Consumer interface {
+	// Pause stops the consumer from pulling new messages.
+	Pause() error
+	// Resume makes the consumer pull messages again.
+	Resume() error
+}
+
+// ConsumerGuardParams are the parameters used to create a ConsumerGuard.
+type ConsumerGuardParams struct {
+	// PollInterval is how often Run checks whether the breaker has untripped.
+	// If the breaker is a Reseter, Run checks as soon as it should have reset
+	// if that is earlier. If unset, the value is set to one second.
+	PollInterval time.Duration
+	// OnPause and OnResume, if set, are called after the consumer has been
+	// paused or resumed.
+	OnPause  func()
+	OnResume func()
+	// OnError, if set, is called with errors from pausing or resuming the
+	// consumer. Failed attempts are retried on the next check.
+	OnError func(error)
+	// Clock is the clock used to wait between checks. If unset, the value is
+	// set to clock.Real.
+	Clock clock.Clock
+}
+
+// ConsumerGuard pauses a message queue consumer while the breaker guarding its
+// message processing is tripped, and resumes it once the breaker untrips. This
+// makes a tripped breaker stop the consumer from pulling messages, instead of
+// failing them into a dead letter queue.
+//
+// A ConsumerGuard is itself a Breaker: Register responses from processing
+// messages on the guard, and it pauses the consumer as soon as the breaker
+// trips. Run must be running for the consumer to be resumed again.
+type ConsumerGuard struct {
+	breaker  Breaker
+	consumer Consumer
+	params   ConsumerGuardParams
+	mut      sync.Mutex
+	paused   bool
+}
+
+// NewConsumerGuard creates a ConsumerGuard for c, guarded by b. The consumer is
+// assumed to be running.
+func NewConsumerGuard(b Breaker, c Consumer, params ConsumerGuardParams) *ConsumerGuard {
+	if params.PollInterval == 0 {
+		params.PollInterval = 1 * time.Second
+	}
+	if params.Clock == nil {
+		params.Clock = clock.Real
+	}
+	return &ConsumerGuard{breaker: b, consumer: c, params: params}
+}
+
+// IsTripped returns the result of IsTripped on the guarding breaker.
+func (g *ConsumerGuard) IsTripped() error {
+	return g.breaker.IsTripped()
+}
+
+// Register registers the response on the guarding breaker. If the response
+// tripped the breaker, the consumer is paused before Register returns.
+func (g *ConsumerGuard) Register(r ResponseType) error {
+	err := g.breaker.Register(r)
+	if IsErrTripped(err) {
+		g.Check()
+	}
+	return err
+}
+
+// Paused returns true if the guard has paused the consumer.
+func (g *ConsumerGuard) Paused() bool {
+	g.mut.Lock()
+	defer g.mut.Unlock()
+	return g.paused
+}
+
+// Check pauses or resumes the consumer to match the state of the breaker. It is
+// called by Register and Run, and only needs to be called directly if the
+// breaker may be tripped or reset by other means.
+func (g *ConsumerGuard) Check() {
+	g.mut.Lock()
+	tripped := g.breaker.IsTripped() != nil
+	if tripped == g.paused {
+		g.mut.Unlock()
+		return
+	}
+	var err error
+	var hook func()
+	if tripped {
+		err, hook = g.consumer.Pause(), g.params.OnPause
+	} else {
+		err, hook = g.consumer.Resume(), g.params.OnResume
+	}
+	if err == nil {
+		g.paused = tripped
+	}
+	g.mut.Unlock()
+	if err != nil {
+		if g.params.OnError != nil {
+			g.params.OnError(err)
+		}
+		return
+	}
+	if hook != nil {
+		hook()
+	}
+}
+
+// Run checks the breaker periodically, pausing and resuming the consumer
+// accordingly, until ctx is done. It then returns ctx.Err(), leaving the
+// consumer in its current state.
+func (g *ConsumerGuard) Run(ctx context.Context) error {
+	for {
+		g.Check()
+		wait := g.params.PollInterval
+		if r, ok := g.breaker.(Reseter); ok {
+			// Breakers reset once the reset time has passed, so wait a
+			// little longer than the reset duration.
+			if d := r.ResetDuration() + time.Millisecond; time.Millisecond < d && d < wait {
+				wait = d
+			}
+		}
+		if err := clock.Sleep(ctx, g.params.Clock, wait); err != nil {
+			return err
+		}
+	}
+}
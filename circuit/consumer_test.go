@@ -0,0 +1,81 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package circuit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hypirion/gluten/clock"
+)
+
+type dummyConsumer struct {
+	paused    bool
+	failPause bool
+}
+
+func (dc *dummyConsumer) Pause() error {
+	if dc.failPause {
+		return errors.New("pause failed")
+	}
+	dc.paused = true
+	return nil
+}
+
+func (dc *dummyConsumer) Resume() error {
+	dc.paused = false
+	return nil
+}
+
+func TestConsumerGuard(t *testing.T) {
+	sim := clock.NewSim(time.Unix(0, 0))
+	breaker := NewCountBreaker("test", CountBreakerParams{
+		BackoffDuration: 10 * time.Second,
+		MaxBackoff:      10 * time.Second,
+		Clock:           sim,
+	})
+	consumer := &dummyConsumer{}
+	var errs []error
+	guard := NewConsumerGuard(breaker, consumer, ConsumerGuardParams{
+		PollInterval: 1 * time.Minute,
+		OnError:      func(err error) { errs = append(errs, err) },
+		Clock:        sim,
+	})
+	var _ Breaker = guard
+
+	consumer.failPause = true
+	if !IsErrTripped(guard.Register(Anomaly)) {
+		t.Fatal("Expected the anomaly to trip the breaker")
+	}
+	if consumer.paused || guard.Paused() || len(errs) != 1 {
+		t.Fatalf("Expected failed pause to be reported, got %v", errs)
+	}
+	consumer.failPause = false
+	guard.Check()
+	if !consumer.paused || !guard.Paused() {
+		t.Fatal("Expected consumer to be paused while the breaker is tripped")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- guard.Run(ctx) }()
+	for sim.Pending() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	// Run should wake up at the reset time, not after the poll interval.
+	sim.Advance(11 * time.Second)
+	for guard.Paused() {
+		time.Sleep(time.Millisecond)
+	}
+	if consumer.paused {
+		t.Fatal("Expected consumer to be resumed after the breaker reset")
+	}
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Fatalf("Expected Run to return Canceled, got %v", err)
+	}
+}
@@ -0,0 +1,172 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package circuit
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/hypirion/gluten/clock"
+)
+
+// FallbackParams are the parameters used to create a Fallback.
+type FallbackParams struct {
+	// MaxRatio is the ratio of calls served by the fallback within a time window
+	// above which OnExcessive is called. If zero, OnExcessive is never called.
+	MaxRatio float64
+	// TimeWindow is the duration of the windows the ratio is computed over. If
+	// unset, the value is set to one minute.
+	TimeWindow time.Duration
+	// MinCalls is the minimal amount of calls within a time window before the
+	// ratio is considered. If unset, the value is set to 10.
+	MinCalls uint64
+	// OnExcessive is called when the fallback ratio of the current time window
+	// exceeds MaxRatio. It is called at most once per time window, on the
+	// goroutine calling Do, and must not call back into the Fallback.
+	OnExcessive func(FallbackStats)
+	// Clock is the clock used to measure time. If unset, the value is set to
+	// clock.Real.
+	Clock clock.Clock
+}
+
+// FallbackStats are usage statistics of a Fallback.
+type FallbackStats struct {
+	// Primary and Fallback are the total amount of calls served by the primary
+	// and the fallback path.
+	Primary  uint64
+	Fallback uint64
+	// WindowPrimary and WindowFallback are the amount of calls served by the
+	// primary and the fallback path in the current time window.
+	WindowPrimary  uint64
+	WindowFallback uint64
+	// FallbackSince is the time the fallback path started serving all traffic,
+	// or the zero time if the last call was served by the primary path.
+	FallbackSince time.Time
+	// FallbackDuration is the total duration the fallback path has served all
+	// traffic, including the ongoing period.
+	FallbackDuration time.Duration
+}
+
+// Ratio returns the fallback ratio of the current time window.
+func (fs FallbackStats) Ratio() float64 {
+	total := fs.WindowPrimary + fs.WindowFallback
+	if total == 0 {
+		return 0
+	}
+	return float64(fs.WindowFallback) / float64(total)
+}
+
+// Fallback serves calls through a primary path guarded by a breaker, and falls
+// back to a secondary path when the breaker is tripped or the primary path
+// fails. It tracks how often and for how long the fallback path serves traffic,
+// as silent long-term fallback operation tends to hide real outages.
+type Fallback struct {
+	breaker     Breaker
+	params      FallbackParams
+	mut         sync.Mutex
+	stats       FallbackStats
+	windowStart time.Time
+	alerted     bool
+	// fallbackTotal excludes the ongoing fallback period.
+	fallbackTotal time.Duration
+}
+
+// NewFallback creates a new Fallback for the breaker b.
+func NewFallback(b Breaker, params FallbackParams) *Fallback {
+	if params.TimeWindow == 0 {
+		params.TimeWindow = 1 * time.Minute
+	}
+	if params.MinCalls == 0 {
+		params.MinCalls = 10
+	}
+	if params.Clock == nil {
+		params.Clock = clock.Real
+	}
+	return &Fallback{
+		breaker:     b,
+		params:      params,
+		windowStart: params.Clock.Now(),
+	}
+}
+
+// Do calls primary if the breaker is not tripped. If the breaker is tripped or
+// primary returns an error, fallback is called instead and its error is
+// returned. primary is responsible for registering its outcome on the breaker,
+// for instance by using circuit.Do.
+func (f *Fallback) Do(ctx context.Context, primary, fallback func(context.Context) error) error {
+	if f.breaker.IsTripped() == nil {
+		if err := primary(ctx); err == nil {
+			f.record(false)
+			return nil
+		}
+	}
+	f.record(true)
+	return fallback(ctx)
+}
+
+// refresh starts a new time window if the current one has ended. Must be
+// called while holding mut.
+func (f *Fallback) refresh(now time.Time) {
+	if now.Sub(f.windowStart) < f.params.TimeWindow {
+		return
+	}
+	f.windowStart = now
+	f.stats.WindowPrimary = 0
+	f.stats.WindowFallback = 0
+	f.alerted = false
+}
+
+func (f *Fallback) record(usedFallback bool) {
+	f.mut.Lock()
+	now := f.params.Clock.Now()
+	f.refresh(now)
+	if !usedFallback {
+		f.stats.Primary++
+		f.stats.WindowPrimary++
+		if !f.stats.FallbackSince.IsZero() {
+			f.fallbackTotal += now.Sub(f.stats.FallbackSince)
+			f.stats.FallbackSince = time.Time{}
+		}
+		f.mut.Unlock()
+		return
+	}
+	f.stats.Fallback++
+	f.stats.WindowFallback++
+	if f.stats.FallbackSince.IsZero() {
+		f.stats.FallbackSince = now
+	}
+	var excessive *FallbackStats
+	if f.params.MaxRatio > 0 && f.params.OnExcessive != nil && !f.alerted &&
+		f.stats.WindowPrimary+f.stats.WindowFallback >= f.params.MinCalls &&
+		f.stats.Ratio() > f.params.MaxRatio {
+		f.alerted = true
+		stats := f.snapshot(now)
+		excessive = &stats
+	}
+	f.mut.Unlock()
+	if excessive != nil {
+		f.params.OnExcessive(*excessive)
+	}
+}
+
+// snapshot must be called while holding mut.
+func (f *Fallback) snapshot(now time.Time) FallbackStats {
+	stats := f.stats
+	stats.FallbackDuration = f.fallbackTotal
+	if !stats.FallbackSince.IsZero() {
+		stats.FallbackDuration += now.Sub(stats.FallbackSince)
+	}
+	return stats
+}
+
+// Stats returns the usage statistics of the fallback.
+func (f *Fallback) Stats() FallbackStats {
+	f.mut.Lock()
+	defer f.mut.Unlock()
+	now := f.params.Clock.Now()
+	f.refresh(now)
+	return f.snapshot(now)
+}
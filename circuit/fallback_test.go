@@ -0,0 +1,72 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package circuit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hypirion/gluten/clock"
+)
+
+func TestFallback(t *testing.T) {
+	clk := clock.NewFake(time.Unix(0, 0))
+	breaker := NewCountBreaker("test", CountBreakerParams{
+		MaxAnomalies: 100,
+		TimeWindow:   1 * time.Hour,
+		Clock:        clk,
+	})
+	var alerts []FallbackStats
+	fb := NewFallback(breaker, FallbackParams{
+		MaxRatio:    0.5,
+		TimeWindow:  1 * time.Minute,
+		MinCalls:    4,
+		OnExcessive: func(stats FallbackStats) { alerts = append(alerts, stats) },
+		Clock:       clk,
+	})
+	ok := func(context.Context) error { return nil }
+	failing := func(context.Context) error { return errors.New("failed") }
+	ctx := context.Background()
+
+	fb.Do(ctx, ok, ok)
+	fb.Do(ctx, failing, ok)
+	clk.Advance(10 * time.Second)
+	fb.Do(ctx, failing, ok)
+	if len(alerts) != 0 {
+		t.Fatalf("Expected no alerts before MinCalls, got %d", len(alerts))
+	}
+	fb.Do(ctx, failing, ok)
+	if len(alerts) != 1 || alerts[0].Ratio() != 0.75 {
+		t.Fatalf("Expected one alert at ratio 0.75, got %+v", alerts)
+	}
+	fb.Do(ctx, failing, ok)
+	if len(alerts) != 1 {
+		t.Fatalf("Expected at most one alert per window, got %d", len(alerts))
+	}
+
+	stats := fb.Stats()
+	if stats.Primary != 1 || stats.Fallback != 4 || stats.FallbackDuration != 10*time.Second {
+		t.Fatalf("Unexpected stats: %+v", stats)
+	}
+
+	fb.Do(ctx, ok, ok)
+	clk.Advance(1 * time.Minute)
+	stats = fb.Stats()
+	if !stats.FallbackSince.IsZero() || stats.FallbackDuration != 10*time.Second || stats.WindowFallback != 0 {
+		t.Fatalf("Unexpected stats after recovery: %+v", stats)
+	}
+
+	breaker.ForceTrip()
+	called := false
+	fb.Do(ctx, func(context.Context) error {
+		called = true
+		return nil
+	}, ok)
+	if called {
+		t.Error("Expected primary not to be called when the breaker is tripped")
+	}
+}
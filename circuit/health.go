@@ -0,0 +1,93 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package circuit
+
+import (
+	"context"
+	"strconv"
+)
+
+// HealthSignal is an external signal about the health of a service, e.g. from
+// a cloud provider status page or from endpoints being removed by a service
+// discovery system. Feeding such signals into a breaker lets it trip before
+// request failures accumulate.
+type HealthSignal int
+
+const (
+	// SignalHealthy reports that the service is healthy. A tripped breaker
+	// moves to the half-open state right away, so that requests can confirm
+	// the recovery.
+	SignalHealthy HealthSignal = iota
+	// SignalDegraded reports that the service is degraded. It counts as an
+	// anomaly, alongside the ones from registered responses.
+	SignalDegraded
+	// SignalDown reports that the service is down, and trips the breaker.
+	SignalDown
+)
+
+func (s HealthSignal) String() string {
+	switch s {
+	case SignalHealthy:
+		return "healthy"
+	case SignalDegraded:
+		return "degraded"
+	case SignalDown:
+		return "down"
+	}
+	return "HealthSignal(" + strconv.Itoa(int(s)) + ")"
+}
+
+// HealthReporter is an interface for circuit breakers that accept external
+// health signals.
+type HealthReporter interface {
+	// ReportHealth reports a health signal to the breaker. It returns ErrTripped
+	// if the signal tripped the breaker.
+	ReportHealth(HealthSignal) error
+}
+
+// ReportHealth feeds an external health signal into the count breaker. The
+// signal is combined with the evidence from registered responses: Degraded
+// signals count towards MaxAnomalies, and Down signals trip the breaker with
+// the usual backoff. Signals are ignored while the breaker is tripped, except
+// for Healthy signals, which move it to the half-open state.
+func (c *CountBreaker) ReportHealth(s HealthSignal) error {
+	c.maybeReset()
+	switch s {
+	case SignalHealthy:
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+		if c.loadState() == Open {
+			c.halfOpen()
+		}
+		return nil
+	case SignalDegraded:
+		if c.loadState() == Open {
+			return nil
+		}
+		return c.Register(Anomaly)
+	case SignalDown:
+		return c.ForceTrip()
+	}
+	panic("circuit: unknown health signal " + s.String())
+}
+
+// WatchHealth reports every signal received on signals to r, until signals is
+// closed or ctx is done. Errors from r are passed to onTrip if it is non-nil,
+// which is typically used to alert that a signal tripped the breaker.
+func WatchHealth(ctx context.Context, r HealthReporter, signals <-chan HealthSignal, onTrip func(error)) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case s, ok := <-signals:
+			if !ok {
+				return
+			}
+			if err := r.ReportHealth(s); err != nil && onTrip != nil {
+				onTrip(err)
+			}
+		}
+	}
+}
@@ -0,0 +1,62 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package circuit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hypirion/gluten/clock"
+)
+
+func TestReportHealth(t *testing.T) {
+	clk := clock.NewFake(time.Unix(0, 0))
+	breaker := NewCountBreaker("test", CountBreakerParams{
+		MaxAnomalies:    1,
+		TimeWindow:      1 * time.Minute,
+		BackoffDuration: 1 * time.Minute,
+		Clock:           clk,
+	})
+
+	// a degraded signal and a failed request together trip the breaker
+	if err := breaker.ReportHealth(SignalDegraded); err != nil {
+		t.Fatal(err)
+	}
+	if err := breaker.Register(Anomaly); !IsErrTripped(err) {
+		t.Fatalf("Expected signal and responses to trip the breaker, got %v", err)
+	}
+
+	if err := breaker.ReportHealth(SignalHealthy); err != nil {
+		t.Fatal(err)
+	}
+	if s := breaker.State(); s != HalfOpen {
+		t.Fatalf("Expected healthy signal to half-open the breaker, was %s", s)
+	}
+	breaker.Register(Success)
+	if s := breaker.State(); s != Closed {
+		t.Fatalf("Expected breaker to close, was %s", s)
+	}
+
+	if err := breaker.ReportHealth(SignalDown); !IsErrTripped(err) {
+		t.Fatalf("Expected down signal to trip the breaker, got %v", err)
+	}
+	if err := breaker.ReportHealth(SignalDown); err != nil {
+		t.Fatalf("Expected no error on an already tripped breaker, got %v", err)
+	}
+}
+
+func TestWatchHealth(t *testing.T) {
+	breaker := NewCountBreaker("test", CountBreakerParams{})
+	signals := make(chan HealthSignal, 2)
+	signals <- SignalDown
+	signals <- SignalDown
+	close(signals)
+	trips := 0
+	WatchHealth(context.Background(), breaker, signals, func(error) { trips++ })
+	if trips != 1 {
+		t.Errorf("Expected one trip, got %d", trips)
+	}
+}
@@ -0,0 +1,93 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package circuit
+
+import (
+	"context"
+	"log/slog"
+	"sync/atomic"
+	"time"
+)
+
+// WithLogger returns a Breaker which logs the behaviour of b to logger, with
+// serviceName as the service attribute of every record. Trips are logged at
+// error level along with the backoff duration (if b is a Reseter), untrips at
+// info level, fatal responses at warning level and all other failures at debug
+// level. If logger is nil, slog.Default() is used.
+//
+// If b is a Reseter, the returned Breaker is also a Reseter. Other optional
+// interfaces of b, such as Stater and Forcer, are reached through the Unwrap
+// method of the returned Breaker:
+//
+//	lb := circuit.WithLogger(b, "db", logger)
+//	st, ok := lb.(interface{ Unwrap() circuit.Breaker }).Unwrap().(circuit.Stater)
+func WithLogger(b Breaker, serviceName string, logger *slog.Logger) Breaker {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	lb := &loggingBreaker{breaker: b, logger: logger.With("service", serviceName)}
+	if r, ok := b.(Reseter); ok {
+		lb.reseter = r
+		return &loggingBreakReseter{lb}
+	}
+	return lb
+}
+
+type loggingBreaker struct {
+	breaker Breaker
+	reseter Reseter
+	logger  *slog.Logger
+	tripped atomic.Bool
+}
+
+type loggingBreakReseter struct {
+	*loggingBreaker
+}
+
+func (lb *loggingBreakReseter) ResetDuration() time.Duration {
+	return lb.reseter.ResetDuration()
+}
+
+// Unwrap returns the wrapped breaker.
+func (lb *loggingBreaker) Unwrap() Breaker {
+	return lb.breaker
+}
+
+func (lb *loggingBreaker) IsTripped() error {
+	err := lb.breaker.IsTripped()
+	wasTripped := lb.tripped.Swap(err != nil)
+	switch {
+	case wasTripped && err == nil:
+		lb.logger.Info("circuit breaker untripped")
+	case !wasTripped && err != nil:
+		// Someone else tripped the breaker, or it was tripped before we started
+		// logging.
+		lb.logTrip(err)
+	}
+	return err
+}
+
+func (lb *loggingBreaker) Register(r ResponseType) error {
+	err := lb.breaker.Register(r)
+	switch r {
+	case Success, Slow:
+	case Fatal:
+		lb.logger.Warn("circuit breaker registered fatal response", slog.String("response", r.String()))
+	default:
+		lb.logger.Debug("circuit breaker registered failure", slog.String("response", r.String()))
+	}
+	if IsErrTripped(err) && !lb.tripped.Swap(true) {
+		lb.logTrip(err)
+	}
+	return err
+}
+
+func (lb *loggingBreaker) logTrip(err error) {
+	attrs := []slog.Attr{slog.String("error", err.Error())}
+	if lb.reseter != nil {
+		attrs = append(attrs, slog.Duration("backoff", lb.reseter.ResetDuration()))
+	}
+	lb.logger.LogAttrs(context.Background(), slog.LevelError, "circuit breaker tripped", attrs...)
+}
@@ -0,0 +1,68 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package circuit
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWithLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	params := CountBreakerParams{
+		MaxAnomalies:  1,
+		MaxFatalities: 1,
+		MaxBackoff:    1 * time.Millisecond,
+	}
+	breaker := WithLogger(NewCountBreaker("test", params), "test", logger)
+	if _, ok := breaker.(Reseter); !ok {
+		t.Fatal("Expected logging breaker to be a Reseter")
+	}
+	unwrapped := breaker.(interface{ Unwrap() Breaker }).Unwrap()
+	if _, ok := unwrapped.(Stater); !ok {
+		t.Fatal("Expected unwrapped breaker to be a Stater")
+	}
+	if breaker.Register(Slow) != nil || breaker.Register(Fatal) != nil {
+		t.Error("Breaker immediately tripped")
+	}
+	if !IsErrTripped(breaker.Register(Anomaly)) {
+		t.Error("Expected breaker to trip after second anomaly")
+	}
+	if !IsErrTripped(breaker.IsTripped()) {
+		t.Error("Expected breaker to be tripped")
+	}
+	time.Sleep(2 * time.Millisecond)
+	if breaker.IsTripped() != nil {
+		t.Error("Expected breaker to be untripped")
+	}
+
+	out := buf.String()
+	expected := []string{
+		"level=WARN msg=\"circuit breaker registered fatal response\" service=test response=fatal",
+		"level=DEBUG msg=\"circuit breaker registered failure\" service=test response=anomaly",
+		"level=ERROR msg=\"circuit breaker tripped\"",
+		"level=INFO msg=\"circuit breaker untripped\"",
+	}
+	for _, e := range expected {
+		if !strings.Contains(out, e) {
+			t.Errorf("Expected log output to contain %q, but was:\n%s", e, out)
+		}
+	}
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		if !strings.Contains(line, "service=test") {
+			t.Errorf("Expected every record to carry the service, but got %q", line)
+		}
+	}
+	if strings.Contains(out, "response=slow") {
+		t.Errorf("Expected slow responses not to be logged, but was:\n%s", out)
+	}
+	if n := strings.Count(out, "circuit breaker tripped"); n != 1 {
+		t.Errorf("Expected exactly one trip to be logged, but got %d", n)
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package circuit
+
+import (
+	"errors"
+	"sort"
+	"sync"
+)
+
+// ErrDuplicateBreaker is returned when adding a breaker to a Registry under a
+// name which is already in use.
+var ErrDuplicateBreaker = errors.New("breaker name already in use")
+
+// Registry is a threadsafe collection of named breakers, typically one per
+// service you connect to. It is used to look up breakers for introspection and
+// manual operation.
+type Registry struct {
+	mut      sync.RWMutex
+	breakers map[string]Breaker
+}
+
+// NewRegistry creates a new, empty registry.
+func NewRegistry() *Registry {
+	return &Registry{breakers: make(map[string]Breaker)}
+}
+
+// Add adds b to the registry under the given name. If the name is already in
+// use, ErrDuplicateBreaker is returned.
+func (r *Registry) Add(name string, b Breaker) error {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	if _, ok := r.breakers[name]; ok {
+		return ErrDuplicateBreaker
+	}
+	r.breakers[name] = b
+	return nil
+}
+
+// Remove removes the breaker with the given name from the registry, if any.
+func (r *Registry) Remove(name string) {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	delete(r.breakers, name)
+}
+
+// Get returns the breaker with the given name, or nil if there is none.
+func (r *Registry) Get(name string) Breaker {
+	r.mut.RLock()
+	defer r.mut.RUnlock()
+	return r.breakers[name]
+}
+
+// Names returns the names of all breakers in the registry, sorted.
+func (r *Registry) Names() []string {
+	r.mut.RLock()
+	names := make([]string, 0, len(r.breakers))
+	for name := range r.breakers {
+		names = append(names, name)
+	}
+	r.mut.RUnlock()
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,124 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package circuit
+
+import (
+	"context"
+	"time"
+
+	"github.com/hypirion/gluten/clock"
+)
+
+// RetryPolicy describes how Do retries actions.
+type RetryPolicy struct {
+	// MaxAttempts is the maximal amount of attempts, including the first one. If
+	// unset, the value is set to 3. Do panics if it is negative.
+	MaxAttempts int
+	// Backoff returns the duration to wait before the nth retry, starting at 1.
+	// If nil, the backoff starts at 100 milliseconds and doubles for every
+	// retry, up to a minute.
+	Backoff func(retry int) time.Duration
+	// Classify returns the response type of an error returned by the action. If
+	// nil, nil errors are considered Success and all others Anomaly. Errors
+	// classified as Success or Slow are not retried.
+	Classify func(error) ResponseType
+	// Budget is an optional retry budget. If set, Do deposits to it once per
+	// call, and stops retrying once the budget is exhausted.
+	Budget *RetryBudget
+	// Tracer is an optional tracer. If set, Do wraps the call in a span, see
+	// Tracer.
+	Tracer Tracer
+	// Clock is the clock the backoff is waited out on. If unset, the real clock
+	// is used. Backoffs are waited out in real time if the clock is not a
+	// clock.TimerClock.
+	Clock clock.Clock
+}
+
+func defaultBackoff(retry int) time.Duration {
+	// Cap the backoff before the shift overflows.
+	if retry > 10 {
+		return time.Minute
+	}
+	return 100 * time.Millisecond << uint(retry-1)
+}
+
+func defaultClassify(err error) ResponseType {
+	if err == nil {
+		return Success
+	}
+	return Anomaly
+}
+
+// Do calls f, retrying according to policy for as long as b is untripped. The
+// outcome of every attempt is registered on b, so that the breaker sees every
+// failure – including the ones that are later retried successfully – exactly
+// once. If policy is nil, the default policy is used.
+//
+// If b is tripped before the first attempt, Do returns the breaker error
+// without calling f. If b trips while retrying, or the retry budget runs out,
+// Do stops immediately and returns the error from the last attempt. Attempts
+// that fail after ctx is done are not registered, as they say nothing about
+// the service.
+func Do(ctx context.Context, b Breaker, policy *RetryPolicy, f func(context.Context) error) (err error) {
+	if policy == nil {
+		policy = &RetryPolicy{}
+	}
+	maxAttempts := policy.MaxAttempts
+	if maxAttempts < 0 {
+		panic("circuit: negative MaxAttempts in RetryPolicy")
+	}
+	if maxAttempts == 0 {
+		maxAttempts = 3
+	}
+	backoff := policy.Backoff
+	if backoff == nil {
+		backoff = defaultBackoff
+	}
+	classify := policy.Classify
+	if classify == nil {
+		classify = defaultClassify
+	}
+	c := policy.Clock
+	if c == nil {
+		c = clock.Real
+	}
+	if policy.Budget != nil {
+		policy.Budget.Deposit()
+	}
+	if policy.Tracer != nil {
+		var span Span
+		ctx, span = policy.Tracer.StartSpan(ctx, SpanName)
+		end := startSpan(span, b)
+		attempts := 0
+		f = countAttempts(f, &attempts)
+		defer func() {
+			end(attempts, err)
+		}()
+	}
+
+	for attempt := 1; ; attempt++ {
+		if tripErr := b.IsTripped(); tripErr != nil {
+			if err != nil {
+				return err
+			}
+			return tripErr
+		}
+		err = f(ctx)
+		if err != nil && ctx.Err() != nil {
+			return err
+		}
+		r := classify(err)
+		tripErr := b.Register(r)
+		if r == Success || r == Slow || IsErrTripped(tripErr) || attempt == maxAttempts {
+			return err
+		}
+		if policy.Budget != nil && policy.Budget.Withdraw() != nil {
+			return err
+		}
+		if clock.Sleep(ctx, c, backoff(attempt)) != nil {
+			return err
+		}
+	}
+}
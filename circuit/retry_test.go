@@ -0,0 +1,127 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package circuit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hypirion/gluten/clock"
+)
+
+var errFlaky = errors.New("flaky")
+
+func noBackoff(int) time.Duration {
+	return 0
+}
+
+func TestDoRetries(t *testing.T) {
+	breaker := NewCountBreaker("test", CountBreakerParams{MaxAnomalies: 10})
+	calls := 0
+	err := Do(context.Background(), breaker, &RetryPolicy{Backoff: noBackoff}, func(context.Context) error {
+		calls++
+		if calls < 3 {
+			return errFlaky
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls != 3 {
+		t.Fatalf("Expected 3 calls, but got %d", calls)
+	}
+	if breaker.numAnomalies != 2 {
+		t.Fatalf("Expected 2 anomalies to be registered, but got %d", breaker.numAnomalies)
+	}
+}
+
+func TestDoStopsOnTrip(t *testing.T) {
+	breaker := NewCountBreaker("test", CountBreakerParams{MaxAnomalies: 1})
+	calls := 0
+	policy := &RetryPolicy{MaxAttempts: 10, Backoff: noBackoff}
+	err := Do(context.Background(), breaker, policy, func(context.Context) error {
+		calls++
+		return errFlaky
+	})
+	if err != errFlaky {
+		t.Fatalf("Expected last error to be returned, but got %v", err)
+	}
+	if calls != 2 {
+		t.Fatalf("Expected retries to stop once the breaker tripped, but got %d calls", calls)
+	}
+	err = Do(context.Background(), breaker, policy, func(context.Context) error {
+		t.Fatal("Expected tripped breaker to not call the action")
+		return nil
+	})
+	if !IsErrTripped(err) {
+		t.Fatalf("Expected ErrTripped, but got %v", err)
+	}
+}
+
+func TestDoClassify(t *testing.T) {
+	breaker := NewCountBreaker("test", CountBreakerParams{})
+	calls := 0
+	policy := &RetryPolicy{
+		Backoff:  noBackoff,
+		Classify: func(error) ResponseType { return Success },
+	}
+	err := Do(context.Background(), breaker, policy, func(context.Context) error {
+		calls++
+		return errFlaky
+	})
+	if err != errFlaky {
+		t.Fatalf("Expected error to be returned, but got %v", err)
+	}
+	if calls != 1 {
+		t.Fatalf("Expected errors classified as success to not be retried, but got %d calls", calls)
+	}
+}
+
+func TestDefaultBackoff(t *testing.T) {
+	if d := defaultBackoff(1); d != 100*time.Millisecond {
+		t.Errorf("Expected first backoff to be 100ms, got %v", d)
+	}
+	if d := defaultBackoff(3); d != 400*time.Millisecond {
+		t.Errorf("Expected third backoff to be 400ms, got %v", d)
+	}
+	for _, retry := range []int{11, 40, 100} {
+		if d := defaultBackoff(retry); d != time.Minute {
+			t.Errorf("Expected backoff %d to be capped at a minute, got %v", retry, d)
+		}
+	}
+}
+
+func TestDoNegativeMaxAttempts(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("Expected Do to panic on negative MaxAttempts")
+		}
+	}()
+	breaker := NewCountBreaker("test", CountBreakerParams{})
+	Do(context.Background(), breaker, &RetryPolicy{MaxAttempts: -1}, func(context.Context) error {
+		return nil
+	})
+}
+
+func TestDoClock(t *testing.T) {
+	sim := clock.NewSim(time.Unix(0, 0))
+	breaker := NewCountBreaker("test", CountBreakerParams{MaxAnomalies: 10, Clock: sim})
+	done := make(chan error)
+	go func() {
+		done <- Do(context.Background(), breaker, &RetryPolicy{Clock: sim}, func(context.Context) error {
+			return errFlaky
+		})
+	}()
+	sim.BlockUntil(1)
+	sim.Advance(100 * time.Millisecond)
+	sim.BlockUntil(1)
+	sim.Advance(200 * time.Millisecond)
+	if err := <-done; err != errFlaky {
+		t.Fatalf("Expected last error to be returned, but got %v", err)
+	}
+}
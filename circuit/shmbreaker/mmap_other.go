@@ -0,0 +1,20 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !unix
+
+package shmbreaker
+
+import (
+	"errors"
+	"os"
+)
+
+func mmap(f *os.File, n int) ([]byte, error) {
+	return nil, &os.PathError{Op: "mmap", Path: f.Name(), Err: errors.ErrUnsupported}
+}
+
+func munmap(data []byte) error {
+	return errors.ErrUnsupported
+}
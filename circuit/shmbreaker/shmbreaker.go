@@ -0,0 +1,353 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package shmbreaker is an experimental circuit breaker whose counters and
+// trip state live in a shared memory mapped file, so that multiple processes
+// on one host share a single breaker.
+//
+// This is intended for preforking and CGI-like deployment models, where every
+// process only sees a small fraction of the traffic, and per-process breakers
+// never accumulate enough samples to trip. All processes map the same file and
+// update it with atomic operations, so registering a response costs about as
+// much as with an in-process breaker.
+//
+// The breaker is a simplified count breaker: It counts anomalies and
+// fatalities within a fixed time window, and trips for BackoffDuration if
+// either goes above its maximum. It has no half-open state or exponential
+// backoff. All processes must use the same service name and parameters, which
+// Open checks, and their clocks must agree. Shared memory mapping is only
+// supported on Unix systems.
+package shmbreaker
+
+import (
+	"errors"
+	"hash/fnv"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	"github.com/hypirion/gluten/circuit"
+	"github.com/hypirion/gluten/clock"
+)
+
+var (
+	// ErrBadLayout is returned by Open if the file is not a shared breaker
+	// file.
+	ErrBadLayout = errors.New("shmbreaker: file is not a shared breaker file")
+	// ErrMismatch is returned by Open if the file is used by another service,
+	// or with other parameters.
+	ErrMismatch = errors.New("shmbreaker: file is used by another service or with other parameters")
+	// ErrClosed is returned when using a closed breaker.
+	ErrClosed = errors.New("shmbreaker: breaker is closed")
+)
+
+const (
+	magic = 0x676c7432 // "glt2"
+	// magicInit is stored while the process creating the file writes the
+	// header.
+	magicInit = 0x676c7430 // "glt0"
+	// size is the size of the mapped file. It is larger than the shared struct
+	// to leave room for future fields.
+	size = 128
+	// initTimeout is how long Open waits for another process to finish writing
+	// the header before it assumes that process crashed, and writes the header
+	// itself.
+	initTimeout = 1 * time.Second
+)
+
+// shared is the layout of the mapped file. Every field must be accessed
+// atomically. The header fields up to and including service are written once
+// by the process creating the file, before magic is set.
+type shared struct {
+	magic         atomic.Uint32
+	maxAnomalies  atomic.Uint32
+	maxFatalities atomic.Uint32
+	anomalies     atomic.Uint32
+	fatalities    atomic.Uint32
+	_             uint32
+	timeWindow    atomic.Int64
+	backoff       atomic.Int64
+	service       atomic.Uint64
+	windowEnd     atomic.Int64
+	trippedUntil  atomic.Int64
+	trips         atomic.Uint64
+}
+
+// Params are the parameters used to open a shared breaker.
+type Params struct {
+	// MaxAnomalies is the maximal amount of anomalies the breaker is permitted
+	// to detect within the time window before it trips. A fatal response is
+	// also considered an anomaly.
+	MaxAnomalies uint32
+	// MaxFatalities is the maximal amount of fatalities the breaker is permitted
+	// to detect within the time window before it trips.
+	MaxFatalities uint32
+	// TimeWindow is the length of the time window. If unset, the value is set to
+	// one minute.
+	TimeWindow time.Duration
+	// BackoffDuration is the duration the breaker stays tripped. If unset, the
+	// value is set to one minute.
+	BackoffDuration time.Duration
+	// Clock is the source of time for the breaker. If unset, the real clock is
+	// used.
+	Clock clock.Clock
+}
+
+// Breaker is a circuit breaker backed by a shared memory mapped file. It is
+// safe for concurrent use, both within and across processes.
+type Breaker struct {
+	serviceName string
+	params      Params
+	// mut guards data and s, which are nil once the breaker is closed.
+	mut  sync.RWMutex
+	data []byte
+	s    *shared
+}
+
+// Open maps the file at path, creating it if it does not exist, and returns a
+// breaker for the service with the given name backed by it. Every process
+// opening the same path shares the breaker. If the file was created for another
+// service name or with other parameters, Open returns ErrMismatch.
+func Open(path, serviceName string, params Params) (*Breaker, error) {
+	if params.TimeWindow == 0 {
+		params.TimeWindow = 1 * time.Minute
+	}
+	if params.BackoffDuration == 0 {
+		params.BackoffDuration = 1 * time.Minute
+	}
+	if params.Clock == nil {
+		params.Clock = clock.Real
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if fi.Size() < size {
+		// Truncate only ever grows the file here, and the new bytes are zero,
+		// so racing processes can do this concurrently.
+		if err := f.Truncate(size); err != nil {
+			return nil, err
+		}
+	}
+	data, err := mmap(f, size)
+	if err != nil {
+		return nil, err
+	}
+	s := (*shared)(unsafe.Pointer(&data[0]))
+	if err := initHeader(s, serviceName, params); err != nil {
+		munmap(data)
+		return nil, err
+	}
+	return &Breaker{
+		serviceName: serviceName,
+		params:      params,
+		data:        data,
+		s:           s,
+	}, nil
+}
+
+func serviceHash(serviceName string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(serviceName))
+	return h.Sum64()
+}
+
+// initHeader writes the header of a new file, or checks the header of an
+// existing one against the service name and parameters.
+func initHeader(s *shared, serviceName string, params Params) error {
+	for !s.magic.CompareAndSwap(0, magicInit) {
+		deadline := time.Now().Add(initTimeout)
+		for s.magic.Load() == magicInit && time.Now().Before(deadline) {
+			time.Sleep(1 * time.Millisecond)
+		}
+		switch s.magic.Load() {
+		case magic:
+			return checkHeader(s, serviceName, params)
+		case magicInit:
+			// The process writing the header crashed before it finished. Start
+			// over, racing any other process that gave up waiting on it.
+			s.magic.CompareAndSwap(magicInit, 0)
+		default:
+			return ErrBadLayout
+		}
+	}
+	s.maxAnomalies.Store(params.MaxAnomalies)
+	s.maxFatalities.Store(params.MaxFatalities)
+	s.timeWindow.Store(int64(params.TimeWindow))
+	s.backoff.Store(int64(params.BackoffDuration))
+	s.service.Store(serviceHash(serviceName))
+	s.magic.Store(magic)
+	return nil
+}
+
+// checkHeader checks the header of an initialised file against the service
+// name and parameters.
+func checkHeader(s *shared, serviceName string, params Params) error {
+	if s.service.Load() != serviceHash(serviceName) ||
+		s.maxAnomalies.Load() != params.MaxAnomalies ||
+		s.maxFatalities.Load() != params.MaxFatalities ||
+		s.timeWindow.Load() != int64(params.TimeWindow) ||
+		s.backoff.Load() != int64(params.BackoffDuration) {
+		return ErrMismatch
+	}
+	return nil
+}
+
+// Close unmaps the shared file. Closing does not affect other processes using
+// the same file. Using the breaker afterwards is safe: IsTripped reports it as
+// tripped with an ErrTripped error, so that callers shed their calls, and
+// Register and ForceTrip return ErrClosed.
+func (b *Breaker) Close() error {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+	if b.data == nil {
+		return nil
+	}
+	err := munmap(b.data)
+	b.data = nil
+	b.s = nil
+	return err
+}
+
+func (b *Breaker) now() int64 {
+	return b.params.Clock.Now().UnixNano()
+}
+
+// maybeRoll starts a new time window if the current one has ended.
+func (b *Breaker) maybeRoll(now int64) {
+	end := b.s.windowEnd.Load()
+	if now < end {
+		return
+	}
+	if b.s.windowEnd.CompareAndSwap(end, now+int64(b.params.TimeWindow)) {
+		// Responses registered by other processes in between are lost, which
+		// is acceptable at the window boundary.
+		b.s.anomalies.Store(0)
+		b.s.fatalities.Store(0)
+	}
+}
+
+// trip trips the breaker, and returns true if this call tripped it.
+func (b *Breaker) trip(now int64) bool {
+	until := b.s.trippedUntil.Load()
+	if now < until {
+		return false
+	}
+	if !b.s.trippedUntil.CompareAndSwap(until, now+int64(b.params.BackoffDuration)) {
+		return false
+	}
+	b.s.trips.Add(1)
+	b.s.windowEnd.Store(now + int64(b.params.BackoffDuration+b.params.TimeWindow))
+	b.s.anomalies.Store(0)
+	b.s.fatalities.Store(0)
+	return true
+}
+
+// IsTripped returns an ErrTripped error iff the breaker is tripped or closed.
+func (b *Breaker) IsTripped() error {
+	b.mut.RLock()
+	defer b.mut.RUnlock()
+	if b.s == nil || b.now() < b.s.trippedUntil.Load() {
+		return circuit.ErrTripped{ServiceName: b.serviceName}
+	}
+	return nil
+}
+
+// Register registers the response type of an action. If this particular
+// response trips the breaker, it returns an ErrTripped error. Responses
+// registered while the breaker is tripped are ignored.
+func (b *Breaker) Register(r circuit.ResponseType) error {
+	b.mut.RLock()
+	defer b.mut.RUnlock()
+	if b.s == nil {
+		return ErrClosed
+	}
+	if r == circuit.Success || r == circuit.Slow {
+		return nil
+	}
+	now := b.now()
+	if now < b.s.trippedUntil.Load() {
+		return nil
+	}
+	b.maybeRoll(now)
+	tripped := b.s.anomalies.Add(1) > b.params.MaxAnomalies
+	if r == circuit.Fatal && b.s.fatalities.Add(1) > b.params.MaxFatalities {
+		tripped = true
+	}
+	if tripped && b.trip(now) {
+		return circuit.ErrTripped{ServiceName: b.serviceName}
+	}
+	return nil
+}
+
+// ResetDuration returns the duration until the breaker untrips, or 0 if it is
+// not tripped.
+func (b *Breaker) ResetDuration() time.Duration {
+	b.mut.RLock()
+	defer b.mut.RUnlock()
+	if b.s == nil {
+		return 0
+	}
+	d := time.Duration(b.s.trippedUntil.Load() - b.now())
+	if d < 0 {
+		return 0
+	}
+	return d
+}
+
+// State returns Open if the breaker is tripped or closed, and Closed otherwise.
+func (b *Breaker) State() circuit.State {
+	if b.IsTripped() != nil {
+		return circuit.Open
+	}
+	return circuit.Closed
+}
+
+// Trips returns the number of times the breaker has tripped, across all
+// processes. It returns 0 if the breaker is closed.
+func (b *Breaker) Trips() uint64 {
+	b.mut.RLock()
+	defer b.mut.RUnlock()
+	if b.s == nil {
+		return 0
+	}
+	return b.s.trips.Load()
+}
+
+// ForceTrip trips the breaker for all processes. It returns ErrTripped if this
+// changed the state of the breaker, and ErrClosed if the breaker is closed.
+func (b *Breaker) ForceTrip() error {
+	b.mut.RLock()
+	defer b.mut.RUnlock()
+	if b.s == nil {
+		return ErrClosed
+	}
+	if b.trip(b.now()) {
+		return circuit.ErrTripped{ServiceName: b.serviceName}
+	}
+	return nil
+}
+
+// ForceReset resets the breaker to a healthy state for all processes,
+// forgetting all registered failures. It does nothing if the breaker is
+// closed.
+func (b *Breaker) ForceReset() {
+	b.mut.RLock()
+	defer b.mut.RUnlock()
+	if b.s == nil {
+		return
+	}
+	now := b.now()
+	b.s.trippedUntil.Store(0)
+	b.s.windowEnd.Store(now + int64(b.params.TimeWindow))
+	b.s.anomalies.Store(0)
+	b.s.fatalities.Store(0)
+}
@@ -0,0 +1,154 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package shmbreaker
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hypirion/gluten/circuit"
+	"github.com/hypirion/gluten/clock"
+)
+
+func open(t *testing.T, path string, params Params) *Breaker {
+	b, err := Open(path, "shared", params)
+	if errors.Is(err, errors.ErrUnsupported) {
+		t.Skip("shared memory mapping is not supported on this platform")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { b.Close() })
+	return b
+}
+
+func TestSharedCounters(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "breaker")
+	c := clock.NewFake(time.Unix(1000, 0))
+	params := Params{MaxAnomalies: 3, MaxFatalities: 10, Clock: c}
+	a := open(t, path, params)
+	b := open(t, path, params)
+
+	a.Register(circuit.Anomaly)
+	b.Register(circuit.Anomaly)
+	a.Register(circuit.Success)
+	if err := b.Register(circuit.Anomaly); err != nil {
+		t.Fatalf("Expected breaker not to trip yet, got %v", err)
+	}
+	if err := a.Register(circuit.Anomaly); !circuit.IsErrTripped(err) {
+		t.Fatalf("Expected shared anomalies to trip the breaker, got %v", err)
+	}
+	if !circuit.IsErrTripped(b.IsTripped()) || b.State() != circuit.Open {
+		t.Fatal("Expected trip to be visible through the other breaker")
+	}
+	if d := b.ResetDuration(); d != time.Minute {
+		t.Errorf("Expected reset duration of a minute, got %v", d)
+	}
+	if b.Trips() != 1 {
+		t.Errorf("Expected one trip, got %d", b.Trips())
+	}
+
+	c.Advance(time.Minute)
+	if err := a.IsTripped(); err != nil {
+		t.Fatalf("Expected breaker to untrip after the backoff, got %v", err)
+	}
+	a.ForceTrip()
+	if b.IsTripped() == nil {
+		t.Fatal("Expected forced trip to be visible through the other breaker")
+	}
+	b.ForceReset()
+	if a.IsTripped() != nil {
+		t.Fatal("Expected forced reset to be visible through the other breaker")
+	}
+}
+
+func TestTimeWindow(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "breaker")
+	c := clock.NewFake(time.Unix(1000, 0))
+	b := open(t, path, Params{MaxAnomalies: 1, MaxFatalities: 1, TimeWindow: time.Second, Clock: c})
+	for i := 0; i < 5; i++ {
+		if err := b.Register(circuit.Fatal); err != nil {
+			t.Fatalf("Expected window to reset counts, got %v", err)
+		}
+		c.Advance(time.Second)
+	}
+}
+
+func TestBadLayout(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "breaker")
+	if err := os.WriteFile(path, []byte("not a breaker"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	b, err := Open(path, "shared", Params{})
+	if errors.Is(err, errors.ErrUnsupported) {
+		t.Skip("shared memory mapping is not supported on this platform")
+	}
+	if err != ErrBadLayout {
+		b.Close()
+		t.Fatalf("Expected ErrBadLayout, got %v", err)
+	}
+}
+
+func TestStuckInit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "breaker")
+	// A process crashed after claiming the file, but before writing the header.
+	data := make([]byte, size)
+	binary.NativeEndian.PutUint32(data, magicInit)
+	if err := os.WriteFile(path, data, 0666); err != nil {
+		t.Fatal(err)
+	}
+	b := open(t, path, Params{MaxAnomalies: 1})
+	if b.Register(circuit.Anomaly) != nil || !circuit.IsErrTripped(b.Register(circuit.Anomaly)) {
+		t.Fatal("Expected the recovered breaker to trip after the second anomaly")
+	}
+}
+
+func TestMismatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "breaker")
+	params := Params{MaxAnomalies: 3, MaxFatalities: 1}
+	open(t, path, params)
+	if b, err := Open(path, "other", params); err != ErrMismatch {
+		if err == nil {
+			b.Close()
+		}
+		t.Fatalf("Expected ErrMismatch for another service, got %v", err)
+	}
+	params.MaxAnomalies = 4
+	if b, err := Open(path, "shared", params); err != ErrMismatch {
+		if err == nil {
+			b.Close()
+		}
+		t.Fatalf("Expected ErrMismatch for other parameters, got %v", err)
+	}
+}
+
+func TestClosed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "breaker")
+	b := open(t, path, Params{MaxAnomalies: 1000})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for b.Register(circuit.Anomaly) != ErrClosed {
+		}
+	}()
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+	<-done
+	if err := b.IsTripped(); !circuit.IsErrTripped(err) || b.State() != circuit.Open {
+		t.Fatalf("Expected a closed breaker to be tripped, got %v", err)
+	}
+	if err := b.ForceTrip(); err != ErrClosed {
+		t.Fatalf("Expected ErrClosed, got %v", err)
+	}
+	b.ForceReset()
+	if b.ResetDuration() != 0 || b.Trips() != 0 {
+		t.Fatal("Expected no reset duration or trips for a closed breaker")
+	}
+}
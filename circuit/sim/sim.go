@@ -0,0 +1,111 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package sim replays scripted traffic against circuit breakers in simulated
+// time, so that breaker parameters can be validated against recorded
+// production traffic before they are deployed.
+//
+// A simulation needs a breaker which reads time from a fake clock:
+//
+//	clk := clock.NewFake(start)
+//	breaker := circuit.NewCountBreaker("db", circuit.CountBreakerParams{
+//		MaxAnomalies: 10,
+//		Clock:        clk,
+//	})
+//	res := sim.Run(breaker, clk, events)
+//	for _, tr := range res.Transitions {
+//		fmt.Println(tr.At, tr.Tripped)
+//	}
+package sim
+
+import (
+	"sort"
+	"time"
+
+	"github.com/hypirion/gluten/circuit"
+	"github.com/hypirion/gluten/clock"
+)
+
+// Event is a response from a service, at an offset from the start of the
+// simulation.
+type Event struct {
+	At       time.Duration
+	Response circuit.ResponseType
+}
+
+// Step is the outcome of replaying a single event.
+type Step struct {
+	Event
+	// Shed is true if the breaker was tripped when the event happened. The
+	// request is then considered never sent, and the response is not registered.
+	Shed bool
+	// Tripped is true if registering the response tripped the breaker.
+	Tripped bool
+}
+
+// Transition is a change in the state of the breaker.
+type Transition struct {
+	At      time.Duration
+	Tripped bool
+}
+
+// Result is the outcome of a simulation.
+type Result struct {
+	// Steps contains one step per event, in the order they were replayed.
+	Steps []Step
+	// Transitions is the state timeline of the breaker.
+	Transitions []Transition
+}
+
+// Shed returns the amount of events which were shed.
+func (r Result) Shed() int {
+	n := 0
+	for _, step := range r.Steps {
+		if step.Shed {
+			n++
+		}
+	}
+	return n
+}
+
+// Run replays events against b the way a well-behaved caller would: For every
+// event, clk is set to the event time, and the response is registered unless
+// the breaker is tripped. Events are replayed in time order, relative to the
+// time clk is set to when Run is called. b must read its time from clk.
+func Run(b circuit.Breaker, clk *clock.Fake, events []Event) Result {
+	sorted := make([]Event, len(events))
+	copy(sorted, events)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].At < sorted[j].At
+	})
+
+	start := clk.Now()
+	res := Result{Steps: make([]Step, 0, len(sorted))}
+	tripped := false
+	transition := func(at time.Duration, nowTripped bool) {
+		if nowTripped != tripped {
+			tripped = nowTripped
+			res.Transitions = append(res.Transitions, Transition{At: at, Tripped: tripped})
+		}
+	}
+	for _, ev := range sorted {
+		clk.Set(start.Add(ev.At))
+		step := Step{Event: ev}
+		if b.IsTripped() != nil {
+			step.Shed = true
+			transition(ev.At, true)
+		} else {
+			transition(ev.At, false)
+			err := b.Register(ev.Response)
+			// Trips from a half-open state are not necessarily reported by Register,
+			// so check the state as well.
+			step.Tripped = circuit.IsErrTripped(err) || b.IsTripped() != nil
+			if step.Tripped {
+				transition(ev.At, true)
+			}
+		}
+		res.Steps = append(res.Steps, step)
+	}
+	return res
+}
@@ -0,0 +1,61 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sim
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/hypirion/gluten/circuit"
+	"github.com/hypirion/gluten/clock"
+)
+
+func TestRun(t *testing.T) {
+	clk := clock.NewFake(time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC))
+	breaker := circuit.NewCountBreaker("test", circuit.CountBreakerParams{
+		MaxAnomalies:    2,
+		BackoffDuration: 10 * time.Second,
+		MaxBackoff:      10 * time.Second,
+		RandSource:      rand.NewSource(1),
+		Clock:           clk,
+	})
+	var events []Event
+	// An outage lasting 30 seconds, with one request per second
+	for i := 0; i < 30; i++ {
+		events = append(events, Event{At: time.Duration(i) * time.Second, Response: circuit.Anomaly})
+	}
+	events = append(events, Event{At: 45 * time.Second, Response: circuit.Success})
+
+	res := Run(breaker, clk, events)
+	if len(res.Steps) != len(events) {
+		t.Fatalf("Expected %d steps, but got %d", len(events), len(res.Steps))
+	}
+	if !res.Steps[2].Tripped {
+		t.Fatal("Expected third anomaly to trip the breaker")
+	}
+	if !res.Steps[3].Shed {
+		t.Fatal("Expected requests to be shed after the trip")
+	}
+	expected := []Transition{
+		{At: 2 * time.Second, Tripped: true},
+		{At: 13 * time.Second, Tripped: false},
+		{At: 13 * time.Second, Tripped: true},
+		{At: 24 * time.Second, Tripped: false},
+		{At: 24 * time.Second, Tripped: true},
+		{At: 45 * time.Second, Tripped: false},
+	}
+	if len(res.Transitions) != len(expected) {
+		t.Fatalf("Expected transitions %v, but got %v", expected, res.Transitions)
+	}
+	for i := range expected {
+		if res.Transitions[i] != expected[i] {
+			t.Fatalf("Expected transitions %v, but got %v", expected, res.Transitions)
+		}
+	}
+	if res.Shed() != 25 {
+		t.Fatalf("Expected 25 shed requests, but got %d", res.Shed())
+	}
+}
@@ -0,0 +1,159 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package sqlbreaker guards database/sql databases with circuit breakers.
+//
+// A DB wraps a *sql.DB and guards Query, QueryRow, Exec and Begin (along with
+// their context variants) with a breaker. Calls made while the breaker is
+// tripped return the breaker's error without touching the database, and every
+// call that does hit the database registers its outcome on the breaker.
+//
+// Only the initial call is guarded: Errors from iterating over *sql.Rows or
+// from statements run inside a transaction are not registered.
+package sqlbreaker
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"net"
+
+	"github.com/hypirion/gluten/circuit"
+)
+
+// Classify is the default classification of database errors. Connection
+// errors and timeouts are considered Fatal, as they indicate that the database
+// is unavailable. All other errors – constraint violations, syntax errors,
+// sql.ErrNoRows and so on – are considered Success, as the database itself
+// responded just fine.
+func Classify(err error) circuit.ResponseType {
+	if err == nil {
+		return circuit.Success
+	}
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, sql.ErrConnDone) ||
+		errors.Is(err, context.DeadlineExceeded) {
+		return circuit.Fatal
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return circuit.Fatal
+	}
+	return circuit.Success
+}
+
+// DB is a *sql.DB guarded by a circuit breaker. The embedded *sql.DB is
+// available for calls that should not be guarded.
+type DB struct {
+	*sql.DB
+	breaker  circuit.Breaker
+	classify func(error) circuit.ResponseType
+}
+
+// New returns a DB which guards db with b. If classify is nil, Classify is
+// used to classify errors.
+func New(db *sql.DB, b circuit.Breaker, classify func(error) circuit.ResponseType) *DB {
+	if classify == nil {
+		classify = Classify
+	}
+	return &DB{DB: db, breaker: b, classify: classify}
+}
+
+// Breaker returns the breaker guarding the database.
+func (db *DB) Breaker() circuit.Breaker {
+	return db.breaker
+}
+
+// register registers the outcome of a call. If the call tripped the breaker,
+// the trip error is dropped: Callers are interested in the database error.
+func (db *DB) register(err error) {
+	if errors.Is(err, context.Canceled) {
+		// The caller gave up, which says nothing about the database.
+		return
+	}
+	db.breaker.Register(db.classify(err))
+}
+
+// QueryContext executes a query that returns rows, if the breaker is not
+// tripped.
+func (db *DB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	if err := db.breaker.IsTripped(); err != nil {
+		return nil, err
+	}
+	rows, err := db.DB.QueryContext(ctx, query, args...)
+	db.register(err)
+	return rows, err
+}
+
+// Query executes a query that returns rows, if the breaker is not tripped.
+func (db *DB) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return db.QueryContext(context.Background(), query, args...)
+}
+
+// Row is the result of calling QueryRow. Errors are deferred until Scan is
+// called, which is also when the outcome is registered on the breaker.
+type Row struct {
+	db  *DB
+	row *sql.Row
+	err error
+}
+
+// Scan copies the columns of the row into the values pointed at by dest, and
+// registers the outcome on the breaker. If the breaker was tripped when the
+// row was queried, Scan returns the breaker error.
+func (r *Row) Scan(dest ...interface{}) error {
+	if r.err != nil {
+		return r.err
+	}
+	err := r.row.Scan(dest...)
+	r.db.register(err)
+	return err
+}
+
+// QueryRowContext executes a query that is expected to return at most one row,
+// if the breaker is not tripped.
+func (db *DB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *Row {
+	if err := db.breaker.IsTripped(); err != nil {
+		return &Row{err: err}
+	}
+	return &Row{db: db, row: db.DB.QueryRowContext(ctx, query, args...)}
+}
+
+// QueryRow executes a query that is expected to return at most one row, if
+// the breaker is not tripped.
+func (db *DB) QueryRow(query string, args ...interface{}) *Row {
+	return db.QueryRowContext(context.Background(), query, args...)
+}
+
+// ExecContext executes a query without returning any rows, if the breaker is
+// not tripped.
+func (db *DB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	if err := db.breaker.IsTripped(); err != nil {
+		return nil, err
+	}
+	res, err := db.DB.ExecContext(ctx, query, args...)
+	db.register(err)
+	return res, err
+}
+
+// Exec executes a query without returning any rows, if the breaker is not
+// tripped.
+func (db *DB) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return db.ExecContext(context.Background(), query, args...)
+}
+
+// BeginTx starts a transaction, if the breaker is not tripped.
+func (db *DB) BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error) {
+	if err := db.breaker.IsTripped(); err != nil {
+		return nil, err
+	}
+	tx, err := db.DB.BeginTx(ctx, opts)
+	db.register(err)
+	return tx, err
+}
+
+// Begin starts a transaction, if the breaker is not tripped.
+func (db *DB) Begin() (*sql.Tx, error) {
+	return db.BeginTx(context.Background(), nil)
+}
@@ -0,0 +1,81 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sqlbreaker
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"testing"
+
+	"github.com/hypirion/gluten/circuit"
+)
+
+var errConstraint = errors.New("constraint violation")
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(name string) (driver.Conn, error) {
+	return fakeConn{}, nil
+}
+
+type fakeConn struct{}
+
+func (fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("prepare not supported")
+}
+
+func (fakeConn) Close() error {
+	return nil
+}
+
+func (fakeConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("transactions not supported")
+}
+
+func (fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	switch query {
+	case "down":
+		return nil, driver.ErrBadConn
+	case "constraint":
+		return nil, errConstraint
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func init() {
+	sql.Register("sqlbreakertest", fakeDriver{})
+}
+
+func TestDB(t *testing.T) {
+	raw, err := sql.Open("sqlbreakertest", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer raw.Close()
+	breaker := circuit.NewCountBreaker("db", circuit.CountBreakerParams{MaxFatalities: 1, MaxAnomalies: 1})
+	db := New(raw, breaker, nil)
+
+	for i := 0; i < 10; i++ {
+		if _, err := db.Exec("constraint"); err != errConstraint {
+			t.Fatalf("Expected constraint violation, but got %v", err)
+		}
+	}
+	if err := breaker.IsTripped(); err != nil {
+		t.Fatal("Expected constraint violations to not trip the breaker")
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := db.Exec("down"); !errors.Is(err, driver.ErrBadConn) {
+			t.Fatalf("Expected bad connection error, but got %v", err)
+		}
+	}
+	if _, err := db.Exec("ok"); !circuit.IsErrTripped(err) {
+		t.Fatalf("Expected Exec on tripped breaker to return ErrTripped, but got %v", err)
+	}
+	if err := db.QueryRow("ok").Scan(); !circuit.IsErrTripped(err) {
+		t.Fatalf("Expected Scan on tripped breaker to return ErrTripped, but got %v", err)
+	}
+}
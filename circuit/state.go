@@ -0,0 +1,63 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package circuit
+
+import "strconv"
+
+// State is the state of a circuit breaker. The names follow the conventional
+// circuit breaker terminology, where a closed circuit lets traffic through and
+// an open circuit does not:
+//
+//	Closed    healthy, requests are let through
+//	HalfOpen  recovering, the service is probed after a trip
+//	Open      tripped, requests should not be sent
+//
+// Earlier versions of this package used the inverse naming internally, where
+// "closed" meant tripped. Prefer State over inspecting IsTripped errors or the
+// Tripped and HalfOpen fields of CountBreakerStats when the distinction between
+// half-open and closed matters.
+type State uint32
+
+const (
+	// Closed is the healthy state: The breaker lets requests through.
+	Closed State = iota
+	// HalfOpen is the state after a trip has expired, where the breaker lets
+	// requests through but trips again immediately on failures.
+	HalfOpen
+	// Open is the tripped state: The breaker rejects requests.
+	Open
+)
+
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case HalfOpen:
+		return "half-open"
+	case Open:
+		return "open"
+	}
+	return "State(" + strconv.Itoa(int(s)) + ")"
+}
+
+// Stater is implemented by circuit breakers that expose their State.
+type Stater interface {
+	State() State
+}
+
+// State returns the current state of the count breaker. In shadow mode, the
+// real state is returned even though IsTripped never reports it.
+func (c *CountBreaker) State() State {
+	c.maybeReset()
+	return c.loadState()
+}
+
+func (c *CountBreaker) loadState() State {
+	return State(c.state.Load())
+}
+
+func (c *CountBreaker) storeState(s State) {
+	c.state.Store(uint32(s))
+}
@@ -0,0 +1,118 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package circuit
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/hypirion/gluten/clock"
+	"github.com/hypirion/gluten/iox"
+)
+
+// SuspendGuardParams are the parameters used to create a SuspendGuard.
+type SuspendGuardParams struct {
+	// After is how long the breaker must have been tripped before the
+	// resources are suspended. Short trips thus do not cause a suspend and
+	// resume cycle.
+	After time.Duration
+	// PollInterval is how often Run checks the breaker. If unset, the value is
+	// set to one second.
+	PollInterval time.Duration
+	// OnError, if set, is called with the errors from suspending or resuming
+	// the resources, joined. Failed attempts are retried on the next check.
+	OnError func(error)
+	// Clock is the source of time for the guard. If unset, the value is set to
+	// clock.Real.
+	Clock clock.Clock
+}
+
+// SuspendGuard suspends the resources used to talk to a dependency, such as
+// connection pools wrapped in syncx.SuspendLockers, while the breaker for that
+// dependency has been tripped for a while. The resources are resumed as soon as
+// the breaker lets calls through again, typically when it goes half-open.
+//
+// Resumes triggered by use, as done by SuspendLockers, are not prevented: The
+// guard only makes sure idle resources do not hold on to sockets, file
+// descriptors or memory while the dependency is down.
+type SuspendGuard struct {
+	breaker      Breaker
+	resources    []iox.Suspender
+	params       SuspendGuardParams
+	mut          sync.Mutex
+	trippedSince time.Time
+	suspended    bool
+}
+
+// NewSuspendGuard creates a SuspendGuard which suspends resources based on the
+// state of b. The resources are assumed to be resumed.
+func NewSuspendGuard(b Breaker, params SuspendGuardParams, resources ...iox.Suspender) *SuspendGuard {
+	if params.PollInterval == 0 {
+		params.PollInterval = 1 * time.Second
+	}
+	if params.Clock == nil {
+		params.Clock = clock.Real
+	}
+	return &SuspendGuard{breaker: b, resources: resources, params: params}
+}
+
+// Suspended returns true if the guard has suspended the resources.
+func (g *SuspendGuard) Suspended() bool {
+	g.mut.Lock()
+	defer g.mut.Unlock()
+	return g.suspended
+}
+
+// Check suspends or resumes the resources to match the state of the breaker.
+// It is called periodically by Run.
+func (g *SuspendGuard) Check() {
+	g.mut.Lock()
+	defer g.mut.Unlock()
+	now := g.params.Clock.Now()
+	if g.breaker.IsTripped() == nil {
+		g.trippedSince = time.Time{}
+		if g.suspended {
+			g.apply(iox.Suspender.Resume, false)
+		}
+		return
+	}
+	if g.trippedSince.IsZero() {
+		g.trippedSince = now
+	}
+	if !g.suspended && g.params.After <= now.Sub(g.trippedSince) {
+		g.apply(iox.Suspender.Suspend, true)
+	}
+}
+
+// apply calls f on every resource, and marks the resources as suspended if it
+// succeeded on all of them. Must be called while holding the mutex.
+func (g *SuspendGuard) apply(f func(iox.Suspender) error, suspended bool) {
+	var errs []error
+	for _, r := range g.resources {
+		if err := f(r); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) == 0 {
+		g.suspended = suspended
+		return
+	}
+	if g.params.OnError != nil {
+		g.params.OnError(errors.Join(errs...))
+	}
+}
+
+// Run checks the breaker every PollInterval until ctx is done. It then returns
+// ctx.Err(), leaving the resources in their current state.
+func (g *SuspendGuard) Run(ctx context.Context) error {
+	for {
+		g.Check()
+		if err := clock.Sleep(ctx, g.params.Clock, g.params.PollInterval); err != nil {
+			return err
+		}
+	}
+}
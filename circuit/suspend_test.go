@@ -0,0 +1,61 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package circuit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hypirion/gluten/clock"
+)
+
+type dummySuspender struct {
+	suspended bool
+}
+
+func (ds *dummySuspender) Suspend() error {
+	ds.suspended = true
+	return nil
+}
+
+func (ds *dummySuspender) Resume() error {
+	ds.suspended = false
+	return nil
+}
+
+func (ds *dummySuspender) Close() error {
+	return nil
+}
+
+func TestSuspendGuard(t *testing.T) {
+	sim := clock.NewSim(time.Unix(0, 0))
+	breaker := NewCountBreaker("test", CountBreakerParams{
+		BackoffDuration: 1 * time.Minute,
+		MaxBackoff:      1 * time.Minute,
+		Clock:           sim,
+	})
+	a, b := &dummySuspender{}, &dummySuspender{}
+	guard := NewSuspendGuard(breaker, SuspendGuardParams{After: 30 * time.Second, Clock: sim}, a, b)
+
+	guard.Check()
+	breaker.Register(Anomaly)
+	guard.Check()
+	if guard.Suspended() || a.suspended {
+		t.Fatal("Expected resources not to be suspended right after a trip")
+	}
+	sim.Advance(30 * time.Second)
+	guard.Check()
+	if !guard.Suspended() || !a.suspended || !b.suspended {
+		t.Fatal("Expected resources to be suspended after the breaker was tripped long enough")
+	}
+	sim.Advance(31 * time.Second)
+	guard.Check()
+	if breaker.State() != HalfOpen {
+		t.Fatalf("Expected breaker to be half-open, was %s", breaker.State())
+	}
+	if guard.Suspended() || a.suspended || b.suspended {
+		t.Fatal("Expected resources to be resumed once the breaker half-opened")
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package circuit
+
+import "context"
+
+// Tracer starts spans for distributed tracing. Implement it as a thin adapter
+// over your tracing library of choice, e.g. OpenTelemetry.
+type Tracer interface {
+	// StartSpan starts a span with the given name as a child of any span in ctx,
+	// and returns a context carrying the new span.
+	StartSpan(ctx context.Context, name string) (context.Context, Span)
+}
+
+// Span is a span started by a Tracer.
+type Span interface {
+	// SetAttribute annotates the span with a key/value pair.
+	SetAttribute(key string, value interface{})
+	// End ends the span. err is the error returned from the traced call, if any.
+	End(err error)
+}
+
+// SpanName is the name of the spans started by Do.
+const SpanName = "circuit.Do"
+
+// Attributes set on the spans started by Do.
+const (
+	// AttrOutcome is how the breaker handled the call: OutcomeShed if it was
+	// rejected without calling the service, OutcomeProbe if it was let through
+	// a half-open breaker, and OutcomeNormal otherwise.
+	AttrOutcome = "circuit.outcome"
+	// AttrState is the state of the breaker when the call started, if the
+	// breaker is a Stater.
+	AttrState = "circuit.state"
+	// AttrAttempts is the number of times the service was called.
+	AttrAttempts = "circuit.attempts"
+)
+
+// Values of the AttrOutcome attribute.
+const (
+	OutcomeShed   = "shed"
+	OutcomeProbe  = "probe"
+	OutcomeNormal = "normal"
+)
+
+// startSpan reads the state of b as the call starts, and returns a function
+// which annotates span with the outcome of the call and ends it. The outcome is
+// derived from the call itself, as asking b whether it is tripped could take
+// the probe slot of a half-open breaker.
+func startSpan(span Span, b Breaker) func(attempts int, err error) {
+	var state State
+	st, ok := b.(Stater)
+	if ok {
+		state = st.State()
+	}
+	return func(attempts int, err error) {
+		outcome := OutcomeNormal
+		if ok {
+			span.SetAttribute(AttrState, state.String())
+			if state == HalfOpen {
+				outcome = OutcomeProbe
+			}
+		}
+		if attempts == 0 {
+			outcome = OutcomeShed
+		}
+		span.SetAttribute(AttrOutcome, outcome)
+		span.SetAttribute(AttrAttempts, attempts)
+		span.End(err)
+	}
+}
+
+func countAttempts(f func(context.Context) error, attempts *int) func(context.Context) error {
+	return func(ctx context.Context) error {
+		*attempts++
+		return f(ctx)
+	}
+}
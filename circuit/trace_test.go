@@ -0,0 +1,70 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package circuit
+
+import (
+	"context"
+	"testing"
+)
+
+type testSpan struct {
+	attrs map[string]interface{}
+	ended bool
+	err   error
+}
+
+func (s *testSpan) SetAttribute(key string, value interface{}) {
+	s.attrs[key] = value
+}
+
+func (s *testSpan) End(err error) {
+	s.ended = true
+	s.err = err
+}
+
+type testTracer struct {
+	spans []*testSpan
+}
+
+func (t *testTracer) StartSpan(ctx context.Context, name string) (context.Context, Span) {
+	span := &testSpan{attrs: map[string]interface{}{"name": name}}
+	t.spans = append(t.spans, span)
+	return ctx, span
+}
+
+func TestDoTracing(t *testing.T) {
+	breaker := NewCountBreaker("test", CountBreakerParams{MaxAnomalies: 1})
+	tracer := &testTracer{}
+	policy := &RetryPolicy{MaxAttempts: 5, Backoff: noBackoff, Tracer: tracer}
+	Do(context.Background(), breaker, policy, func(context.Context) error {
+		return errFlaky
+	})
+	Do(context.Background(), breaker, policy, func(context.Context) error {
+		return nil
+	})
+
+	if len(tracer.spans) != 2 {
+		t.Fatalf("Expected 2 spans, got %d", len(tracer.spans))
+	}
+	normal, shed := tracer.spans[0], tracer.spans[1]
+	if !normal.ended || normal.err != errFlaky || normal.attrs[AttrOutcome] != OutcomeNormal ||
+		normal.attrs[AttrAttempts] != 2 || normal.attrs[AttrState] != "closed" || normal.attrs["name"] != SpanName {
+		t.Errorf("Unexpected span for normal call: %+v", normal)
+	}
+	if !shed.ended || !IsErrTripped(shed.err) || shed.attrs[AttrOutcome] != OutcomeShed ||
+		shed.attrs[AttrAttempts] != 0 || shed.attrs[AttrState] != "open" {
+		t.Errorf("Unexpected span for shed call: %+v", shed)
+	}
+
+	breaker.ForceReset()
+	breaker.ForceTrip()
+	breaker.ReportHealth(SignalHealthy)
+	Do(context.Background(), breaker, policy, func(context.Context) error {
+		return nil
+	})
+	if probe := tracer.spans[2]; probe.attrs[AttrOutcome] != OutcomeProbe {
+		t.Errorf("Expected probe outcome through a half-open breaker, got %+v", probe)
+	}
+}
@@ -0,0 +1,60 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package clock provides an abstraction over time, so that time dependent
+// types in this library can be tested and simulated deterministically.
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock is a source of time.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+}
+
+// Real is the Clock of the time package.
+var Real Clock = realClock{}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+// Fake is a Clock which only changes when told to. It is safe for concurrent
+// use.
+type Fake struct {
+	mut sync.Mutex
+	now time.Time
+}
+
+// NewFake creates a new fake clock set to t.
+func NewFake(t time.Time) *Fake {
+	return &Fake{now: t}
+}
+
+// Now returns the time the fake clock is set to.
+func (f *Fake) Now() time.Time {
+	f.mut.Lock()
+	defer f.mut.Unlock()
+	return f.now
+}
+
+// Set sets the fake clock to t.
+func (f *Fake) Set(t time.Time) {
+	f.mut.Lock()
+	defer f.mut.Unlock()
+	f.now = t
+}
+
+// Advance moves the fake clock forward by d.
+func (f *Fake) Advance(d time.Duration) {
+	f.mut.Lock()
+	defer f.mut.Unlock()
+	f.now = f.now.Add(d)
+}
@@ -0,0 +1,180 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Sim is a simulated TimerClock for driving time dependent code through long
+// schedules in tests: Time only moves when told to, and moving it fires every
+// timer that becomes due along the way, in order, with the clock set to the
+// time the timer was due. Verifying a week of hourly runs or a ladder of
+// backoffs thus takes milliseconds:
+//
+//	sim := clock.NewSim(time.Now())
+//	runner := task.NewIdempotentWithOpts(&task.IdempotentOpts{Clock: sim})
+//	ran := make(chan struct{})
+//	go runner.RunAtLeastEvery(ctx, time.Hour, 0, func() error {
+//		ran <- struct{}{}
+//		return check()
+//	})
+//	<-ran
+//	for i := 0; i < 7*24; i++ {
+//		sim.BlockUntil(1) // wait for the runner to schedule its next run
+//		sim.Advance(time.Hour)
+//		<-ran // the run itself happens on another goroutine
+//	}
+//
+// Timer functions run synchronously on the goroutine advancing the clock, and
+// may schedule new timers, which fire within the same advance if they become
+// due. Code running in other goroutines, such as a goroutine blocked in Sleep or
+// a runner reacting to a fired timer, is woken up but not waited for: Use
+// BlockUntil to wait for it to schedule its next timer before advancing the
+// clock past it. Sim is safe for concurrent use.
+type Sim struct {
+	mut sync.Mutex
+	// scheduled is signalled whenever a timer is scheduled.
+	scheduled *sync.Cond
+	now       time.Time
+	seq       uint64
+	timers    []*simTimer
+}
+
+type simTimer struct {
+	sim  *Sim
+	when time.Time
+	seq  uint64
+	f    func()
+}
+
+// NewSim creates a new simulated clock set to t.
+func NewSim(t time.Time) *Sim {
+	s := &Sim{now: t}
+	s.scheduled = sync.NewCond(&s.mut)
+	return s
+}
+
+// Now returns the current simulated time.
+func (s *Sim) Now() time.Time {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	return s.now
+}
+
+// AfterFunc calls f once the simulated clock has advanced by d.
+func (s *Sim) AfterFunc(d time.Duration, f func()) Timer {
+	t := &simTimer{sim: s, f: f}
+	t.Reset(d)
+	return t
+}
+
+// Pending returns the number of timers which have not yet fired.
+func (s *Sim) Pending() int {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	return len(s.timers)
+}
+
+// BlockUntil blocks until at least n timers are pending. Use it to wait for
+// goroutines to schedule their timers before advancing the clock, as Advance
+// does not wait for them.
+func (s *Sim) BlockUntil(n int) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	for len(s.timers) < n {
+		s.scheduled.Wait()
+	}
+}
+
+// Advance moves the clock forward by d, firing the timers that become due.
+func (s *Sim) Advance(d time.Duration) {
+	s.AdvanceTo(s.Now().Add(d))
+}
+
+// AdvanceTo moves the clock forward to t, firing the timers that become due.
+// If t is before the current time, only timers that are already due fire.
+func (s *Sim) AdvanceTo(t time.Time) {
+	for {
+		s.mut.Lock()
+		next := s.next()
+		if next == nil || next.when.After(t) {
+			if s.now.Before(t) {
+				s.now = t
+			}
+			s.mut.Unlock()
+			return
+		}
+		s.fire(next)
+	}
+}
+
+// Step moves the clock forward to the next timer and fires it. It returns false
+// if there are no pending timers.
+func (s *Sim) Step() bool {
+	s.mut.Lock()
+	next := s.next()
+	if next == nil {
+		s.mut.Unlock()
+		return false
+	}
+	s.fire(next)
+	return true
+}
+
+// next returns the next timer to fire. Must be called while holding the mutex.
+func (s *Sim) next() *simTimer {
+	var next *simTimer
+	for _, t := range s.timers {
+		if next == nil || t.when.Before(next.when) ||
+			(t.when.Equal(next.when) && t.seq < next.seq) {
+			next = t
+		}
+	}
+	return next
+}
+
+// fire removes t, sets the clock to its time and calls it. Must be called while
+// holding the mutex, which is released before t is called.
+func (s *Sim) fire(t *simTimer) {
+	s.remove(t)
+	if s.now.Before(t.when) {
+		s.now = t.when
+	}
+	s.mut.Unlock()
+	t.f()
+}
+
+// remove removes t from the pending timers, and returns true if it was
+// pending. Must be called while holding the mutex.
+func (s *Sim) remove(t *simTimer) bool {
+	for i, pending := range s.timers {
+		if pending == t {
+			s.timers = append(s.timers[:i], s.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (t *simTimer) Stop() bool {
+	t.sim.mut.Lock()
+	defer t.sim.mut.Unlock()
+	return t.sim.remove(t)
+}
+
+func (t *simTimer) Reset(d time.Duration) bool {
+	s := t.sim
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	active := s.remove(t)
+	t.when = s.now.Add(d)
+	s.seq++
+	t.seq = s.seq
+	s.timers = append(s.timers, t)
+	s.scheduled.Broadcast()
+	return active
+}
@@ -0,0 +1,103 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package clock
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestSimWeekLongSchedule(t *testing.T) {
+	start := time.Date(2017, 1, 2, 0, 0, 0, 0, time.UTC)
+	sim := NewSim(start)
+	var runs []time.Time
+	var tick func()
+	tick = func() {
+		runs = append(runs, sim.Now())
+		sim.AfterFunc(time.Hour, tick)
+	}
+	sim.AfterFunc(time.Hour, tick)
+	sim.Advance(7 * 24 * time.Hour)
+	if len(runs) != 7*24 {
+		t.Fatalf("Expected %d hourly runs, got %d", 7*24, len(runs))
+	}
+	for i, run := range runs {
+		if want := start.Add(time.Duration(i+1) * time.Hour); !run.Equal(want) {
+			t.Fatalf("Expected run %d at %v, was at %v", i, want, run)
+		}
+	}
+	if !sim.Now().Equal(start.Add(7 * 24 * time.Hour)) {
+		t.Errorf("Expected clock to end at the advanced time, was %v", sim.Now())
+	}
+}
+
+func TestSimTimerStopReset(t *testing.T) {
+	sim := NewSim(time.Unix(0, 0))
+	var order []int
+	a := sim.AfterFunc(time.Second, func() { order = append(order, 1) })
+	sim.AfterFunc(2*time.Second, func() { order = append(order, 2) })
+	c := sim.AfterFunc(3*time.Second, func() { order = append(order, 3) })
+	if !c.Stop() || c.Stop() {
+		t.Fatal("Expected only the first Stop to stop the timer")
+	}
+	if !a.Reset(5 * time.Second) {
+		t.Fatal("Expected Reset of a pending timer to return true")
+	}
+	if sim.Pending() != 2 {
+		t.Fatalf("Expected 2 pending timers, got %d", sim.Pending())
+	}
+	for sim.Step() {
+	}
+	if len(order) != 2 || order[0] != 2 || order[1] != 1 {
+		t.Fatalf("Expected timers to fire in order [2 1], got %v", order)
+	}
+	if !sim.Now().Equal(time.Unix(5, 0)) {
+		t.Fatalf("Expected Step to move the clock to the last timer, was %v", sim.Now())
+	}
+}
+
+func TestSimSleep(t *testing.T) {
+	sim := NewSim(time.Unix(0, 0))
+	done := make(chan error)
+	go func() { done <- Sleep(context.Background(), sim, time.Hour) }()
+	sim.BlockUntil(1)
+	sim.Advance(time.Hour)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() { done <- Sleep(ctx, sim, time.Hour) }()
+	sim.BlockUntil(1)
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Fatalf("Expected Canceled, got %v", err)
+	}
+	if sim.Pending() != 0 {
+		t.Fatal("Expected canceled sleep to stop its timer")
+	}
+}
+
+func TestSimBlockUntil(t *testing.T) {
+	sim := NewSim(time.Unix(0, 0))
+	blocked := make(chan struct{})
+	go func() {
+		sim.BlockUntil(2)
+		close(blocked)
+	}()
+	sim.AfterFunc(time.Hour, func() {})
+	select {
+	case <-blocked:
+		t.Fatal("Expected BlockUntil to wait for the second timer")
+	case <-time.After(10 * time.Millisecond):
+	}
+	go sim.AfterFunc(time.Hour, func() {})
+	select {
+	case <-blocked:
+	case <-time.After(time.Second):
+		t.Fatal("Expected BlockUntil to return once two timers were pending")
+	}
+}
@@ -0,0 +1,60 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package clock
+
+import (
+	"context"
+	"time"
+)
+
+// Timer is a timer created through AfterFunc. *time.Timer implements it.
+type Timer interface {
+	// Stop prevents the timer from firing. It returns true if the call stops
+	// the timer, false if the timer has already fired or been stopped.
+	Stop() bool
+	// Reset changes the timer to fire after d. It returns true if the timer had
+	// been active, false if the timer had fired or been stopped.
+	Reset(d time.Duration) bool
+}
+
+// TimerClock is a Clock which can also schedule functions to run in the
+// future, on its own notion of time.
+type TimerClock interface {
+	Clock
+	// AfterFunc waits for d to elapse on the clock, and then calls f. It
+	// returns a Timer that can be used to cancel the call.
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+func (realClock) AfterFunc(d time.Duration, f func()) Timer {
+	return time.AfterFunc(d, f)
+}
+
+// AfterFunc calls f after d has elapsed on c. If c is not a TimerClock, real
+// time is used instead.
+func AfterFunc(c Clock, d time.Duration, f func()) Timer {
+	if tc, ok := c.(TimerClock); ok {
+		return tc.AfterFunc(d, f)
+	}
+	return time.AfterFunc(d, f)
+}
+
+// Sleep pauses the current goroutine until d has elapsed on c, or ctx is
+// done. It returns ctx.Err() if ctx was done first, and nil otherwise. If c is
+// not a TimerClock, real time is used instead.
+func Sleep(ctx context.Context, c Clock, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	done := make(chan struct{})
+	t := AfterFunc(c, d, func() { close(done) })
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		t.Stop()
+		return ctx.Err()
+	}
+}
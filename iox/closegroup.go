@@ -0,0 +1,69 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package iox
+
+import (
+	"errors"
+	"io"
+	"sync"
+)
+
+// CloseGroup is a collection of io.Closers which are closed together, in the
+// reverse order they were added. This matches the typical shutdown order of a
+// program, where resources depend on the ones opened before them:
+//
+//	var resources iox.CloseGroup
+//	defer resources.Close()
+//	db, err := sql.Open(...)
+//	...
+//	resources.Add(db)
+//
+// A CloseGroup is itself an idempotent io.Closer, safe for concurrent use. The
+// zero value is an empty group, ready to use.
+type CloseGroup struct {
+	mut     sync.Mutex
+	closers []io.Closer
+	closed  bool
+}
+
+// Add adds c to the group. If the group is already closed, c is not added and
+// ErrClosed is returned; the caller is then responsible for closing c.
+func (g *CloseGroup) Add(c io.Closer) error {
+	g.mut.Lock()
+	defer g.mut.Unlock()
+	if g.closed {
+		return ErrClosed
+	}
+	g.closers = append(g.closers, c)
+	return nil
+}
+
+// AddFunc adds f to the group as an io.Closer, see Add.
+func (g *CloseGroup) AddFunc(f func() error) error {
+	return g.Add(CloserFunc(f))
+}
+
+// Close closes all closers in the group in reverse order, and returns all their
+// errors joined with errors.Join. Every closer is closed exactly once, even if
+// some of them fail. Subsequent calls to Close return nil.
+func (g *CloseGroup) Close() error {
+	g.mut.Lock()
+	if g.closed {
+		g.mut.Unlock()
+		return nil
+	}
+	g.closed = true
+	closers := g.closers
+	g.closers = nil
+	g.mut.Unlock()
+
+	var errs []error
+	for i := len(closers) - 1; i >= 0; i-- {
+		if err := closers[i].Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
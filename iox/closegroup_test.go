@@ -0,0 +1,37 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package iox
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestCloseGroup(t *testing.T) {
+	var g CloseGroup
+	var order []int
+	errA, errB := errors.New("a"), errors.New("b")
+	g.AddFunc(func() error { order = append(order, 1); return errA })
+	g.AddFunc(func() error { order = append(order, 2); return nil })
+	g.AddFunc(func() error { order = append(order, 3); return errB })
+
+	err := g.Close()
+	if !errors.Is(err, errA) || !errors.Is(err, errB) {
+		t.Errorf("Expected all errors to be returned, got %v", err)
+	}
+	if !reflect.DeepEqual(order, []int{3, 2, 1}) {
+		t.Errorf("Expected closers to run in LIFO order, got %v", order)
+	}
+	if err := g.Close(); err != nil {
+		t.Errorf("Expected second Close to return nil, got %v", err)
+	}
+	if len(order) != 3 {
+		t.Errorf("Expected closers to run once, got %v", order)
+	}
+	if err := g.AddFunc(func() error { return nil }); err != ErrClosed {
+		t.Errorf("Expected ErrClosed when adding to a closed group, got %v", err)
+	}
+}
@@ -0,0 +1,229 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package iox
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+)
+
+// SuspendableConnOpts is a struct of options you can provide when creating a
+// SuspendableConn. You can provide nil if you want the default behaviour.
+type SuspendableConnOpts struct {
+	// Handshake, if set, is called with every connection dialed, before it is
+	// used. Use it for protocol handshakes or authentication that must be
+	// redone on every new connection. If it fails, the connection is closed.
+	Handshake func(conn net.Conn) error
+	// DialTimeout bounds how long Resume waits for a connection to be dialed
+	// and handshaked. If zero, Resume waits as long as the dial function does.
+	DialTimeout time.Duration
+}
+
+// SuspendableConn is a net.Conn which can be suspended: Suspending it closes
+// the underlying connection, and resuming dials and handshakes a new one.
+// Together with a syncx.SuspendLocker, this reaps idle connections and
+// transparently reconnects when they are needed again. As the connection is
+// replaced, it only suits protocols where no state is kept on the connection
+// between requests, other than what the handshake sets up.
+//
+// Reading from or writing to a suspended connection returns ErrSuspended.
+// Deadlines are remembered and applied to new connections. Reads and writes
+// may be called concurrently, but not concurrently with Suspend or Resume.
+type SuspendableConn struct {
+	dial    func(ctx context.Context) (net.Conn, error)
+	opts    SuspendableConnOpts
+	mut     sync.Mutex
+	conn    net.Conn
+	local   net.Addr
+	remote  net.Addr
+	readDl  time.Time
+	writeDl time.Time
+	closed  bool
+}
+
+// DialSuspendable dials a connection with dial, and returns it as a
+// SuspendableConn. dial is called again with a background context, bounded by
+// DialTimeout, whenever the connection is resumed. The handshake is bounded by
+// the deadline of the context, if any.
+func DialSuspendable(ctx context.Context, dial func(ctx context.Context) (net.Conn, error), opts *SuspendableConnOpts) (*SuspendableConn, error) {
+	sc := &SuspendableConn{dial: dial}
+	if opts != nil {
+		sc.opts = *opts
+	}
+	if err := sc.connect(ctx); err != nil {
+		return nil, err
+	}
+	return sc, nil
+}
+
+// connect dials and handshakes a new connection. Must be called while holding
+// the mutex, or before the connection is shared.
+func (sc *SuspendableConn) connect(ctx context.Context) error {
+	conn, err := sc.dial(ctx)
+	if err != nil {
+		return err
+	}
+	if sc.opts.Handshake != nil {
+		if dl, ok := ctx.Deadline(); ok {
+			// Bound the handshake by the dial deadline as well. The deadline
+			// is replaced by the remembered ones below.
+			conn.SetDeadline(dl)
+		}
+		if err := sc.opts.Handshake(conn); err != nil {
+			conn.Close()
+			return err
+		}
+	}
+	if err := sc.applyDeadlines(conn); err != nil {
+		conn.Close()
+		return err
+	}
+	sc.conn = conn
+	sc.local = conn.LocalAddr()
+	sc.remote = conn.RemoteAddr()
+	return nil
+}
+
+func (sc *SuspendableConn) applyDeadlines(conn net.Conn) error {
+	if err := conn.SetReadDeadline(sc.readDl); err != nil {
+		return err
+	}
+	return conn.SetWriteDeadline(sc.writeDl)
+}
+
+// active returns the current connection, or an error if it is suspended or
+// closed.
+func (sc *SuspendableConn) active() (net.Conn, error) {
+	sc.mut.Lock()
+	defer sc.mut.Unlock()
+	if sc.closed {
+		return nil, ErrClosed
+	}
+	if sc.conn == nil {
+		return nil, ErrSuspended
+	}
+	return sc.conn, nil
+}
+
+// Read reads from the connection.
+func (sc *SuspendableConn) Read(p []byte) (int, error) {
+	conn, err := sc.active()
+	if err != nil {
+		return 0, err
+	}
+	return conn.Read(p)
+}
+
+// Write writes to the connection.
+func (sc *SuspendableConn) Write(p []byte) (int, error) {
+	conn, err := sc.active()
+	if err != nil {
+		return 0, err
+	}
+	return conn.Write(p)
+}
+
+// LocalAddr returns the local address of the current connection, or of the
+// last one if the connection is suspended.
+func (sc *SuspendableConn) LocalAddr() net.Addr {
+	sc.mut.Lock()
+	defer sc.mut.Unlock()
+	return sc.local
+}
+
+// RemoteAddr returns the remote address of the current connection, or of the
+// last one if the connection is suspended.
+func (sc *SuspendableConn) RemoteAddr() net.Addr {
+	sc.mut.Lock()
+	defer sc.mut.Unlock()
+	return sc.remote
+}
+
+// SetDeadline sets the read and write deadlines, see net.Conn.
+func (sc *SuspendableConn) SetDeadline(t time.Time) error {
+	return sc.setDeadlines(&t, &t)
+}
+
+// SetReadDeadline sets the read deadline, see net.Conn.
+func (sc *SuspendableConn) SetReadDeadline(t time.Time) error {
+	return sc.setDeadlines(&t, nil)
+}
+
+// SetWriteDeadline sets the write deadline, see net.Conn.
+func (sc *SuspendableConn) SetWriteDeadline(t time.Time) error {
+	return sc.setDeadlines(nil, &t)
+}
+
+func (sc *SuspendableConn) setDeadlines(read, write *time.Time) error {
+	sc.mut.Lock()
+	defer sc.mut.Unlock()
+	if sc.closed {
+		return ErrClosed
+	}
+	if read != nil {
+		sc.readDl = *read
+	}
+	if write != nil {
+		sc.writeDl = *write
+	}
+	if sc.conn == nil {
+		return nil
+	}
+	return sc.applyDeadlines(sc.conn)
+}
+
+// Close closes the connection. Closing a closed connection returns ErrClosed.
+func (sc *SuspendableConn) Close() error {
+	sc.mut.Lock()
+	defer sc.mut.Unlock()
+	if sc.closed {
+		return ErrClosed
+	}
+	sc.closed = true
+	if sc.conn == nil {
+		return nil
+	}
+	err := sc.conn.Close()
+	sc.conn = nil
+	return err
+}
+
+// Suspend closes the underlying connection. Suspending a suspended connection
+// does nothing.
+func (sc *SuspendableConn) Suspend() error {
+	sc.mut.Lock()
+	defer sc.mut.Unlock()
+	if sc.closed {
+		return ErrClosed
+	}
+	if sc.conn == nil {
+		return nil
+	}
+	err := sc.conn.Close()
+	sc.conn = nil
+	return err
+}
+
+// Resume dials and handshakes a new connection. Resuming a connection which is
+// not suspended does nothing.
+func (sc *SuspendableConn) Resume() error {
+	sc.mut.Lock()
+	defer sc.mut.Unlock()
+	if sc.closed {
+		return ErrClosed
+	}
+	if sc.conn != nil {
+		return nil
+	}
+	ctx := context.Background()
+	if sc.opts.DialTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, sc.opts.DialTimeout)
+		defer cancel()
+	}
+	return sc.connect(ctx)
+}
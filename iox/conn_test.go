@@ -0,0 +1,98 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package iox
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func echoServer(t *testing.T) net.Listener {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return l
+}
+
+func echo(t *testing.T, conn net.Conn, s string) {
+	t.Helper()
+	if _, err := io.WriteString(conn, s); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, len(s))
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != s {
+		t.Fatalf("Expected echo %q, got %q", s, buf)
+	}
+}
+
+func TestSuspendableConn(t *testing.T) {
+	l := echoServer(t)
+	var dialer net.Dialer
+	dial := func(ctx context.Context) (net.Conn, error) {
+		return dialer.DialContext(ctx, "tcp", l.Addr().String())
+	}
+	handshakes := 0
+	sc, err := DialSuspendable(context.Background(), dial, &SuspendableConnOpts{
+		Handshake: func(conn net.Conn) error {
+			handshakes++
+			return nil
+		},
+		DialTimeout: 1 * time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var _ net.Conn = sc
+	var _ Suspender = sc
+	if err := sc.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	echo(t, sc, "ping")
+
+	if err := sc.Suspend(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sc.Write([]byte("ping")); err != ErrSuspended {
+		t.Fatalf("Expected ErrSuspended, got %v", err)
+	}
+	if sc.RemoteAddr().String() != l.Addr().String() {
+		t.Errorf("Expected remote address to be kept while suspended, got %v", sc.RemoteAddr())
+	}
+	if err := sc.Resume(); err != nil {
+		t.Fatal(err)
+	}
+	echo(t, sc, "pong")
+	if handshakes != 2 {
+		t.Fatalf("Expected a handshake per connection, got %d", handshakes)
+	}
+
+	if err := sc.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := sc.Resume(); err != ErrClosed {
+		t.Fatalf("Expected ErrClosed, got %v", err)
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package iox
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// CopyOpts are options that can be passed to Copy.
+type CopyOpts struct {
+	// BytesPerSecond limits the copy rate. If zero, the rate is not limited.
+	BytesPerSecond int64
+	// ChunkSize is the amount of bytes copied between each check of the context
+	// and the rate limit. If unset, the value is set to one tenth of
+	// BytesPerSecond if it is set, and 1 MiB otherwise.
+	ChunkSize int64
+}
+
+// Copy copies from src to dst until EOF is reached on src, an error occurs or
+// ctx is done, and returns the amount of bytes copied. If the copy is stopped
+// because ctx is done, ctx.Err() is returned.
+//
+// Like io.Copy, Copy uses dst's ReadFrom method if it has one, which lets the
+// standard library use zero-copy paths such as splice and sendfile between
+// files and network connections. Otherwise, a single buffer is reused for the
+// entire copy. In both cases, the data is copied in chunks of ChunkSize bytes,
+// and the context and rate limit are checked between chunks, so the first
+// chunk is copied without delay. A single blocked read or write is not
+// interrupted when ctx is done; set deadlines on src and dst if that is
+// required.
+//
+// If opts is nil, the default options are used.
+func Copy(ctx context.Context, dst io.Writer, src io.Reader, opts *CopyOpts) (int64, error) {
+	var o CopyOpts
+	if opts != nil {
+		o = *opts
+	}
+	if o.ChunkSize <= 0 {
+		o.ChunkSize = 1 << 20
+		if o.BytesPerSecond > 0 {
+			o.ChunkSize = o.BytesPerSecond / 10
+			if o.ChunkSize < 1 {
+				o.ChunkSize = 1
+			}
+		}
+	}
+	var buf []byte
+	if _, ok := dst.(io.ReaderFrom); !ok {
+		size := o.ChunkSize
+		if 32*1024 < size {
+			size = 32 * 1024
+		}
+		buf = make([]byte, size)
+	}
+
+	start := time.Now()
+	var written int64
+	for {
+		if err := ctx.Err(); err != nil {
+			return written, err
+		}
+		if o.BytesPerSecond > 0 {
+			due := start.Add(time.Duration(float64(written) / float64(o.BytesPerSecond) * float64(time.Second)))
+			if wait := time.Until(due); wait > 0 {
+				timer := time.NewTimer(wait)
+				select {
+				case <-ctx.Done():
+					timer.Stop()
+					return written, ctx.Err()
+				case <-timer.C:
+				}
+			}
+		}
+		// io.LimitedReader is recognised by the zero-copy paths of the standard
+		// library, unlike most other wrappers.
+		n, err := io.CopyBuffer(dst, &io.LimitedReader{R: src, N: o.ChunkSize}, buf)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		if n < o.ChunkSize {
+			return written, nil
+		}
+	}
+}
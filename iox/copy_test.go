@@ -0,0 +1,65 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package iox
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCopy(t *testing.T) {
+	data := strings.Repeat("gluten", 1000)
+	var buf bytes.Buffer
+	n, err := Copy(context.Background(), &buf, strings.NewReader(data), &CopyOpts{ChunkSize: 100})
+	if err != nil || n != int64(len(data)) || buf.String() != data {
+		t.Fatalf("Expected full copy of %d bytes, got (%d, %v)", len(data), n, err)
+	}
+
+	// os.File implements ReaderFrom, which takes the zero-copy path on Linux
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	if err := os.WriteFile(src, []byte(data), 0666); err != nil {
+		t.Fatal(err)
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+	out, err := os.Create(filepath.Join(dir, "dst"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	if n, err := Copy(context.Background(), out, in, nil); err != nil || n != int64(len(data)) {
+		t.Fatalf("Expected full file copy, got (%d, %v)", n, err)
+	}
+}
+
+func TestCopyRateLimit(t *testing.T) {
+	data := strings.Repeat("x", 3000)
+	var buf bytes.Buffer
+	start := time.Now()
+	n, err := Copy(context.Background(), &buf, strings.NewReader(data), &CopyOpts{BytesPerSecond: 50000, ChunkSize: 500})
+	if err != nil || n != 3000 {
+		t.Fatalf("Expected full copy, got (%d, %v)", n, err)
+	}
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Errorf("Expected rate limited copy to take ~50ms, took %s", elapsed)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	buf.Reset()
+	n, err = Copy(ctx, &buf, strings.NewReader(data), &CopyOpts{BytesPerSecond: 10000})
+	if err != context.DeadlineExceeded || n >= 3000 {
+		t.Fatalf("Expected copy to be cancelled, got (%d, %v)", n, err)
+	}
+}
@@ -0,0 +1,155 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package iox
+
+import (
+	"io"
+	"os"
+	"sync"
+)
+
+// SuspendableFile is a file which can be suspended: Suspending it closes the
+// OS file handle while remembering the path, offset and flags it was opened
+// with, and resuming reopens the file and seeks back. This lets a process keep
+// thousands of files open without holding as many file descriptors.
+//
+// Reading, writing or seeking in a suspended file returns ErrSuspended, so wrap
+// it in a syncx.SuspendLocker if you want automatic resumes. The file is safe
+// for concurrent use, but concurrent reads and writes share the same offset.
+type SuspendableFile struct {
+	path   string
+	flag   int
+	perm   os.FileMode
+	mut    sync.Mutex
+	file   *os.File
+	offset int64
+	closed bool
+}
+
+// OpenSuspendable opens the file at path like os.OpenFile, and returns it as a
+// SuspendableFile. os.O_CREATE, os.O_EXCL and os.O_TRUNC only apply to the
+// first open, not when the file is resumed.
+func OpenSuspendable(path string, flag int, perm os.FileMode) (*SuspendableFile, error) {
+	f, err := os.OpenFile(path, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return &SuspendableFile{
+		path: path,
+		flag: flag &^ (os.O_CREATE | os.O_EXCL | os.O_TRUNC),
+		perm: perm,
+		file: f,
+	}, nil
+}
+
+// Name returns the path the file was opened with.
+func (sf *SuspendableFile) Name() string {
+	return sf.path
+}
+
+// active returns the open file, or an error if it is suspended or closed.
+// Must be called while holding the mutex.
+func (sf *SuspendableFile) active() (*os.File, error) {
+	if sf.closed {
+		return nil, ErrClosed
+	}
+	if sf.file == nil {
+		return nil, ErrSuspended
+	}
+	return sf.file, nil
+}
+
+// Read reads from the file.
+func (sf *SuspendableFile) Read(p []byte) (int, error) {
+	sf.mut.Lock()
+	defer sf.mut.Unlock()
+	f, err := sf.active()
+	if err != nil {
+		return 0, err
+	}
+	return f.Read(p)
+}
+
+// Write writes to the file.
+func (sf *SuspendableFile) Write(p []byte) (int, error) {
+	sf.mut.Lock()
+	defer sf.mut.Unlock()
+	f, err := sf.active()
+	if err != nil {
+		return 0, err
+	}
+	return f.Write(p)
+}
+
+// Seek sets the offset for the next read or write on the file.
+func (sf *SuspendableFile) Seek(offset int64, whence int) (int64, error) {
+	sf.mut.Lock()
+	defer sf.mut.Unlock()
+	f, err := sf.active()
+	if err != nil {
+		return 0, err
+	}
+	return f.Seek(offset, whence)
+}
+
+// Close closes the file. Closing a closed file returns ErrClosed.
+func (sf *SuspendableFile) Close() error {
+	sf.mut.Lock()
+	defer sf.mut.Unlock()
+	if sf.closed {
+		return ErrClosed
+	}
+	sf.closed = true
+	if sf.file == nil {
+		return nil
+	}
+	err := sf.file.Close()
+	sf.file = nil
+	return err
+}
+
+// Suspend closes the OS file handle, but remembers the offset to resume from.
+// Suspending a suspended file does nothing.
+func (sf *SuspendableFile) Suspend() error {
+	sf.mut.Lock()
+	defer sf.mut.Unlock()
+	if sf.closed {
+		return ErrClosed
+	}
+	if sf.file == nil {
+		return nil
+	}
+	offset, err := sf.file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	sf.offset = offset
+	err = sf.file.Close()
+	sf.file = nil
+	return err
+}
+
+// Resume reopens the file and seeks back to the offset it was suspended at.
+// Resuming a file which is not suspended does nothing.
+func (sf *SuspendableFile) Resume() error {
+	sf.mut.Lock()
+	defer sf.mut.Unlock()
+	if sf.closed {
+		return ErrClosed
+	}
+	if sf.file != nil {
+		return nil
+	}
+	f, err := os.OpenFile(sf.path, sf.flag, sf.perm)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Seek(sf.offset, io.SeekStart); err != nil {
+		f.Close()
+		return err
+	}
+	sf.file = f
+	return nil
+}
@@ -0,0 +1,57 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package iox
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSuspendableFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data")
+	sf, err := OpenSuspendable(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var _ Suspender = sf
+	if _, err := io.WriteString(sf, "hello "); err != nil {
+		t.Fatal(err)
+	}
+	if err := sf.Suspend(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.WriteString(sf, "world"); err != ErrSuspended {
+		t.Fatalf("Expected ErrSuspended, got %v", err)
+	}
+	if err := sf.Resume(); err != nil {
+		t.Fatal(err)
+	}
+	// resuming must neither truncate the file nor lose the offset
+	if _, err := io.WriteString(sf, "world"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sf.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(sf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "hello world" {
+		t.Fatalf("Expected %q, got %q", "hello world", data)
+	}
+
+	if err := sf.Suspend(); err != nil {
+		t.Fatal(err)
+	}
+	if err := sf.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := sf.Resume(); err != ErrClosed {
+		t.Fatalf("Expected ErrClosed, got %v", err)
+	}
+}
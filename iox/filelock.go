@@ -0,0 +1,104 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package iox
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"time"
+)
+
+// ErrLockHeld is returned when locking a FileLock which is already held by the
+// same FileLock.
+var ErrLockHeld = errors.New("file lock already held")
+
+// fileLockPollInterval is how often Lock retries to acquire a contested lock.
+const fileLockPollInterval = 50 * time.Millisecond
+
+// FileLock is an advisory, exclusive lock on a file, used to coordinate
+// multiple processes on a single host. It is implemented with flock on Unix
+// systems and LockFileEx on Windows. The file is created if it does not exist,
+// and is left in place after unlocking.
+//
+// The lock is held by the FileLock value, not by the process or goroutine: Two
+// FileLocks on the same path exclude each other even within a single process.
+type FileLock struct {
+	path string
+	mut  sync.Mutex
+	f    *os.File
+}
+
+// NewFileLock returns a FileLock on the file at path. The file is not opened
+// until the lock is acquired.
+func NewFileLock(path string) *FileLock {
+	return &FileLock{path: path}
+}
+
+// Path returns the path of the lock file.
+func (fl *FileLock) Path() string {
+	return fl.path
+}
+
+// TryLock tries to acquire the lock without blocking. It returns true if the
+// lock was acquired, and false if it is held by someone else.
+func (fl *FileLock) TryLock() (bool, error) {
+	fl.mut.Lock()
+	defer fl.mut.Unlock()
+	if fl.f != nil {
+		return false, ErrLockHeld
+	}
+	f, err := os.OpenFile(fl.path, os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		return false, err
+	}
+	ok, err := tryLockFile(f)
+	if !ok || err != nil {
+		f.Close()
+		return false, err
+	}
+	fl.f = f
+	return true, nil
+}
+
+// Lock acquires the lock, waiting for it to become available. If ctx is done
+// before the lock is acquired, ctx.Err() is returned. Contested locks are
+// polled, so Lock may return a little while after the lock has been released
+// by someone else.
+func (fl *FileLock) Lock(ctx context.Context) error {
+	var ticker *time.Ticker
+	for {
+		ok, err := fl.TryLock()
+		if ok || err != nil {
+			return err
+		}
+		if ticker == nil {
+			ticker = time.NewTicker(fileLockPollInterval)
+			defer ticker.Stop()
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Unlock releases the lock. Unlocking a FileLock which is not held returns
+// ErrClosed.
+func (fl *FileLock) Unlock() error {
+	fl.mut.Lock()
+	defer fl.mut.Unlock()
+	if fl.f == nil {
+		return ErrClosed
+	}
+	err := unlockFile(fl.f)
+	if cerr := fl.f.Close(); err == nil {
+		err = cerr
+	}
+	fl.f = nil
+	return err
+}
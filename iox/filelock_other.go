@@ -0,0 +1,20 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !unix && !windows
+
+package iox
+
+import (
+	"errors"
+	"os"
+)
+
+func tryLockFile(f *os.File) (bool, error) {
+	return false, &os.PathError{Op: "lock", Path: f.Name(), Err: errors.ErrUnsupported}
+}
+
+func unlockFile(f *os.File) error {
+	return &os.PathError{Op: "unlock", Path: f.Name(), Err: errors.ErrUnsupported}
+}
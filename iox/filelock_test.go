@@ -0,0 +1,47 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package iox
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lock")
+	a, b := NewFileLock(path), NewFileLock(path)
+
+	if ok, err := a.TryLock(); !ok || err != nil {
+		t.Fatalf("Expected first TryLock to succeed, got (%v, %v)", ok, err)
+	}
+	if ok, err := a.TryLock(); ok || err != ErrLockHeld {
+		t.Fatalf("Expected ErrLockHeld when relocking, got (%v, %v)", ok, err)
+	}
+	if ok, err := b.TryLock(); ok || err != nil {
+		t.Fatalf("Expected second lock to be contested, got (%v, %v)", ok, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := b.Lock(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("Expected DeadlineExceeded, got %v", err)
+	}
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		a.Unlock()
+	}()
+	if err := b.Lock(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Unlock(); !IsErrClosed(err) {
+		t.Fatalf("Expected ErrClosed when unlocking twice, got %v", err)
+	}
+}
@@ -0,0 +1,243 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package iox
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// ErrSuspended is returned when using a suspended resource.
+var ErrSuspended = errors.New("resource is suspended")
+
+// FollowReaderOpts is a struct of options you can provide when creating a
+// FollowReader. You can provide nil if you want the default behaviour.
+type FollowReaderOpts struct {
+	// PollInterval is the duration between each check for new data, truncation
+	// or rotation when the reader has reached the end of the file. If unset, the
+	// value is set to 250 milliseconds.
+	PollInterval time.Duration
+	// FromEnd makes the reader start at the end of the file instead of at the
+	// start.
+	FromEnd bool
+}
+
+// FollowReader reads a file like tail -F: When it reaches the end of the file,
+// it waits for more data instead of returning io.EOF. If the file is truncated,
+// the reader starts from the beginning again, and if the file is rotated (the
+// path refers to a new file), the reader continues with the new file once it
+// has read the remainder of the old one.
+//
+// A FollowReader is a Suspender: Suspending it closes the underlying file
+// while remembering the offset, and resuming reopens the file and seeks back.
+// Reading from a suspended FollowReader returns ErrSuspended, so wrap it in a
+// syncx.SuspendLocker if you want automatic resumes.
+//
+// Reads must not be called concurrently, but Close, Suspend and Resume may be
+// called while a read is waiting for data.
+type FollowReader struct {
+	path   string
+	poll   time.Duration
+	mut    sync.Mutex
+	file   *os.File
+	info   os.FileInfo
+	offset int64
+	closed chan struct{}
+}
+
+// NewFollowReader opens the file at path and returns a FollowReader on top of
+// it.
+func NewFollowReader(path string, opts *FollowReaderOpts) (*FollowReader, error) {
+	if opts == nil {
+		opts = &FollowReaderOpts{}
+	}
+	poll := opts.PollInterval
+	if poll == 0 {
+		poll = 250 * time.Millisecond
+	}
+	fr := &FollowReader{
+		path:   path,
+		poll:   poll,
+		closed: make(chan struct{}),
+	}
+	if err := fr.open(); err != nil {
+		return nil, err
+	}
+	if opts.FromEnd {
+		offset, err := fr.file.Seek(0, io.SeekEnd)
+		if err != nil {
+			fr.file.Close()
+			return nil, err
+		}
+		fr.offset = offset
+	}
+	return fr, nil
+}
+
+// open opens the file at the path, and seeks to the current offset if it is
+// the same file as the last one opened.
+func (fr *FollowReader) open() error {
+	f, err := os.Open(fr.path)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	if fr.info == nil || !os.SameFile(fr.info, info) || info.Size() < fr.offset {
+		fr.offset = 0
+	}
+	if fr.offset != 0 {
+		if _, err := f.Seek(fr.offset, io.SeekStart); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	fr.file = f
+	fr.info = info
+	return nil
+}
+
+// Read reads from the file, waiting for more data if the reader has reached
+// the end of it.
+func (fr *FollowReader) Read(p []byte) (int, error) {
+	return fr.ReadContext(context.Background(), p)
+}
+
+// ReadContext reads from the file, waiting for more data if the reader has
+// reached the end of it. If ctx is done before any data is available, the
+// context error is returned.
+func (fr *FollowReader) ReadContext(ctx context.Context, p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	for {
+		n, err := fr.tryRead(p)
+		if n != 0 || err != nil {
+			return n, err
+		}
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-fr.closed:
+			return 0, ErrClosed
+		case <-time.After(fr.poll):
+		}
+	}
+}
+
+// tryRead reads available data. If there is none, it checks for truncation
+// and rotation and returns 0, nil.
+func (fr *FollowReader) tryRead(p []byte) (int, error) {
+	fr.mut.Lock()
+	defer fr.mut.Unlock()
+	select {
+	case <-fr.closed:
+		return 0, ErrClosed
+	default:
+	}
+	if fr.file == nil {
+		return 0, ErrSuspended
+	}
+	n, err := fr.file.Read(p)
+	fr.offset += int64(n)
+	if n != 0 || (err != nil && err != io.EOF) {
+		return n, err
+	}
+	// At the end of the file: Check whether it has been truncated or rotated.
+	info, err := fr.file.Stat()
+	if err != nil {
+		return 0, err
+	}
+	if info.Size() < fr.offset {
+		_, err := fr.file.Seek(0, io.SeekStart)
+		fr.offset = 0
+		return 0, err
+	}
+	pathInfo, err := os.Stat(fr.path)
+	if os.IsNotExist(err) {
+		// Rotation in progress, wait for the new file to appear.
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	if !os.SameFile(info, pathInfo) {
+		// Only let go of the old file once the new one has been opened, so that
+		// a failed open is retried on the next read.
+		old := fr.file
+		if err := fr.open(); err != nil {
+			return 0, err
+		}
+		old.Close()
+	}
+	return 0, nil
+}
+
+// Offset returns the offset in the current file.
+func (fr *FollowReader) Offset() int64 {
+	fr.mut.Lock()
+	defer fr.mut.Unlock()
+	return fr.offset
+}
+
+// Close closes the reader, and makes any pending reads return ErrClosed.
+func (fr *FollowReader) Close() error {
+	fr.mut.Lock()
+	defer fr.mut.Unlock()
+	select {
+	case <-fr.closed:
+		return ErrClosed
+	default:
+	}
+	close(fr.closed)
+	if fr.file == nil {
+		return nil
+	}
+	err := fr.file.Close()
+	fr.file = nil
+	return err
+}
+
+// Suspend closes the underlying file, but remembers the offset to resume
+// from. Suspending a suspended reader does nothing.
+func (fr *FollowReader) Suspend() error {
+	fr.mut.Lock()
+	defer fr.mut.Unlock()
+	select {
+	case <-fr.closed:
+		return ErrClosed
+	default:
+	}
+	if fr.file == nil {
+		return nil
+	}
+	err := fr.file.Close()
+	fr.file = nil
+	return err
+}
+
+// Resume reopens the file and seeks back to the offset it was suspended at. If
+// the file was rotated while suspended, the reader starts at the beginning of
+// the new file. Resuming a reader which is not suspended does nothing.
+func (fr *FollowReader) Resume() error {
+	fr.mut.Lock()
+	defer fr.mut.Unlock()
+	select {
+	case <-fr.closed:
+		return ErrClosed
+	default:
+	}
+	if fr.file != nil {
+		return nil
+	}
+	return fr.open()
+}
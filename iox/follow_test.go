@@ -0,0 +1,135 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package iox
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func readString(t *testing.T, fr *FollowReader) string {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	buf := make([]byte, 64)
+	n, err := fr.ReadContext(ctx, buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(buf[:n])
+}
+
+func appendString(t *testing.T, path, s string) {
+	t.Helper()
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(s); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFollowReader(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log")
+	appendString(t, path, "hello")
+	fr, err := NewFollowReader(path, &FollowReaderOpts{PollInterval: 1 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fr.Close()
+
+	if s := readString(t, fr); s != "hello" {
+		t.Fatalf("Expected hello, but got %q", s)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+	if _, err := fr.ReadContext(ctx, make([]byte, 1)); err != context.DeadlineExceeded {
+		t.Fatalf("Expected read at end of file to time out, but got %v", err)
+	}
+
+	appendString(t, path, "world")
+	if s := readString(t, fr); s != "world" {
+		t.Fatalf("Expected world, but got %q", s)
+	}
+
+	// Truncation
+	if err := os.Truncate(path, 0); err != nil {
+		t.Fatal(err)
+	}
+	appendString(t, path, "abc")
+	if s := readString(t, fr); s != "abc" {
+		t.Fatalf("Expected abc after truncation, but got %q", s)
+	}
+
+	// Rotation
+	appendString(t, path, "old")
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	appendString(t, path, "new")
+	if s := readString(t, fr); s != "old" {
+		t.Fatalf("Expected remainder of rotated file, but got %q", s)
+	}
+	if s := readString(t, fr); s != "new" {
+		t.Fatalf("Expected new file after rotation, but got %q", s)
+	}
+
+	// Suspension
+	if err := fr.Suspend(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fr.Read(make([]byte, 1)); err != ErrSuspended {
+		t.Fatalf("Expected ErrSuspended, but got %v", err)
+	}
+	appendString(t, path, "resumed")
+	if err := fr.Resume(); err != nil {
+		t.Fatal(err)
+	}
+	if s := readString(t, fr); s != "resumed" {
+		t.Fatalf("Expected resumed, but got %q", s)
+	}
+}
+
+func TestFollowReaderRotationOpenFailure(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("opening a unix socket file does not fail on windows")
+	}
+	path := filepath.Join(t.TempDir(), "log")
+	appendString(t, path, "old")
+	fr, err := NewFollowReader(path, &FollowReaderOpts{PollInterval: 1 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fr.Close()
+	if s := readString(t, fr); s != "old" {
+		t.Fatalf("Expected old, but got %q", s)
+	}
+
+	// Rotate to a unix socket, which cannot be opened.
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Skip("unix sockets not supported:", err)
+	}
+	if _, err := fr.Read(make([]byte, 1)); err == nil {
+		t.Fatal("Expected reopening the rotated file to fail")
+	}
+
+	l.Close()
+	os.Remove(path)
+	appendString(t, path, "new")
+	if s := readString(t, fr); s != "new" {
+		t.Fatalf("Expected new file after a failed reopen, but got %q", s)
+	}
+}
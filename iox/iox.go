@@ -6,16 +6,20 @@
 package iox
 
 import (
+	"context"
 	"errors"
-	"os"
+	"io/fs"
+	"net"
 )
 
 // ErrClosed is a generalization of os.ErrClosed.
 var ErrClosed = errors.New("resource is closed")
 
-// IsErrClosed returns true if the error is ErrClosed or os.ErrClosed.
+// IsErrClosed returns true if the error is or wraps ErrClosed, fs.ErrClosed
+// (which os.ErrClosed is an alias of) or net.ErrClosed.
 func IsErrClosed(err error) bool {
-	return err == ErrClosed || err == os.ErrClosed
+	return errors.Is(err, ErrClosed) || errors.Is(err, fs.ErrClosed) ||
+		errors.Is(err, net.ErrClosed)
 }
 
 // Suspender is an interface implemented by types that can be temporarily
@@ -35,3 +39,123 @@ type Suspender interface {
 	// implementations.
 	Resume() error
 }
+
+// ContextSuspender is like Suspender, but every call takes a context bounding
+// it. Implement it for resources that may take long to suspend, resume or
+// close, such as ones that have to reconnect to a remote service when resumed.
+// syncx.SuspendLocker uses the context variants when its resource implements
+// both interfaces.
+type ContextSuspender interface {
+	// CloseContext closes the resource, see Suspender.Close.
+	CloseContext(ctx context.Context) error
+	// SuspendContext suspends the resource, see Suspender.Suspend.
+	SuspendContext(ctx context.Context) error
+	// ResumeContext resumes the resource, see Suspender.Resume. If ctx is done
+	// before the resource is resumed, it should give up and leave the resource
+	// suspended.
+	ResumeContext(ctx context.Context) error
+}
+
+// ToContextSuspender returns s as a ContextSuspender. If s already implements
+// ContextSuspender, it is returned as is. Otherwise, the calls return ctx.Err()
+// if ctx is already done, and call through to s if not. They are not
+// interrupted if ctx is done while they run.
+func ToContextSuspender(s Suspender) ContextSuspender {
+	if cs, ok := s.(ContextSuspender); ok {
+		return cs
+	}
+	return contextSuspender{s}
+}
+
+type contextSuspender struct {
+	s Suspender
+}
+
+func (cs contextSuspender) CloseContext(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return cs.s.Close()
+}
+
+func (cs contextSuspender) SuspendContext(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return cs.s.Suspend()
+}
+
+func (cs contextSuspender) ResumeContext(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return cs.s.Resume()
+}
+
+// FromContextSuspender returns cs as a Suspender, calling the context variants
+// with context.Background(). If cs already implements Suspender, it is
+// returned as is. The returned Suspender still implements ContextSuspender,
+// so wrapping it in a syncx.SuspendLocker keeps the context variants in use.
+func FromContextSuspender(cs ContextSuspender) Suspender {
+	if s, ok := cs.(Suspender); ok {
+		return s
+	}
+	return backgroundSuspender{cs}
+}
+
+type backgroundSuspender struct {
+	ContextSuspender
+}
+
+func (bs backgroundSuspender) Close() error {
+	return bs.CloseContext(context.Background())
+}
+
+func (bs backgroundSuspender) Suspend() error {
+	return bs.SuspendContext(context.Background())
+}
+
+func (bs backgroundSuspender) Resume() error {
+	return bs.ResumeContext(context.Background())
+}
+
+// CloserFunc is a function implementing io.Closer.
+type CloserFunc func() error
+
+// Close calls f().
+func (f CloserFunc) Close() error {
+	return f()
+}
+
+// SuspenderFuncs implements Suspender through functions, so that ad-hoc
+// resources can be suspended without defining a new type. Functions left nil
+// do nothing and return nil.
+type SuspenderFuncs struct {
+	SuspendFunc func() error
+	ResumeFunc  func() error
+	CloseFunc   func() error
+}
+
+// Suspend calls SuspendFunc, if set.
+func (sf SuspenderFuncs) Suspend() error {
+	if sf.SuspendFunc == nil {
+		return nil
+	}
+	return sf.SuspendFunc()
+}
+
+// Resume calls ResumeFunc, if set.
+func (sf SuspenderFuncs) Resume() error {
+	if sf.ResumeFunc == nil {
+		return nil
+	}
+	return sf.ResumeFunc()
+}
+
+// Close calls CloseFunc, if set.
+func (sf SuspenderFuncs) Close() error {
+	if sf.CloseFunc == nil {
+		return nil
+	}
+	return sf.CloseFunc()
+}
@@ -0,0 +1,85 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package iox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestIsErrClosed(t *testing.T) {
+	closed := []error{
+		ErrClosed,
+		os.ErrClosed,
+		net.ErrClosed,
+		fmt.Errorf("reading: %w", ErrClosed),
+		&os.PathError{Op: "read", Path: "/tmp/file", Err: os.ErrClosed},
+		&net.OpError{Op: "read", Net: "tcp", Err: net.ErrClosed},
+	}
+	for _, err := range closed {
+		if !IsErrClosed(err) {
+			t.Errorf("Expected %v to be a closed error", err)
+		}
+	}
+	for _, err := range []error{nil, errors.New("resource is closed"), os.ErrNotExist} {
+		if IsErrClosed(err) {
+			t.Errorf("Expected %v to not be a closed error", err)
+		}
+	}
+}
+
+func TestSuspenderFuncs(t *testing.T) {
+	var calls []string
+	record := func(name string) func() error {
+		return func() error {
+			calls = append(calls, name)
+			return nil
+		}
+	}
+	var s Suspender = SuspenderFuncs{
+		SuspendFunc: record("suspend"),
+		ResumeFunc:  record("resume"),
+	}
+	s.Suspend()
+	s.Resume()
+	if err := s.Close(); err != nil {
+		t.Fatalf("Expected unset CloseFunc to return nil, got %v", err)
+	}
+	var c io.Closer = CloserFunc(record("close"))
+	c.Close()
+	if strings.Join(calls, ",") != "suspend,resume,close" {
+		t.Fatalf("Unexpected calls %v", calls)
+	}
+}
+
+func TestContextSuspenderAdapters(t *testing.T) {
+	var resumed int
+	s := SuspenderFuncs{ResumeFunc: func() error {
+		resumed++
+		return nil
+	}}
+	cs := ToContextSuspender(s)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := cs.ResumeContext(ctx); err != context.Canceled || resumed != 0 {
+		t.Fatalf("Expected Canceled without resuming, got %v", err)
+	}
+	if err := cs.ResumeContext(context.Background()); err != nil || resumed != 1 {
+		t.Fatalf("Expected resume, got %v", err)
+	}
+	back := FromContextSuspender(cs)
+	if _, ok := back.(ContextSuspender); !ok {
+		t.Fatal("Expected adapted suspender to keep the context variants")
+	}
+	if err := back.Resume(); err != nil || resumed != 2 {
+		t.Fatalf("Expected resume, got %v", err)
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package iox
+
+import (
+	"errors"
+	"sync"
+)
+
+// MultiSuspender returns a Suspender suspending, resuming and closing all of
+// the given suspenders, for composite resources. Suspenders are suspended in
+// the given order and resumed in reverse order, so a resource should be listed
+// before the ones it depends on.
+//
+// On partial failures, the multi suspender keeps track of which children are
+// suspended:
+//
+// Suspend is best-effort: It suspends every child even if some fail, and
+// returns their errors joined with errors.Join. Children that failed are
+// considered not suspended, so calling Suspend again only retries those.
+//
+// Resume rolls back: If a child fails to resume, the children already resumed
+// by this call are suspended again, and the errors are returned joined. The
+// multi suspender is then fully suspended again, and Resume may be retried.
+//
+// Close closes every child in reverse order, regardless of failures, and
+// returns their errors joined.
+func MultiSuspender(s ...Suspender) Suspender {
+	children := make([]Suspender, len(s))
+	copy(children, s)
+	return &multiSuspender{
+		children:  children,
+		suspended: make([]bool, len(s)),
+	}
+}
+
+type multiSuspender struct {
+	mut       sync.Mutex
+	children  []Suspender
+	suspended []bool
+}
+
+func (ms *multiSuspender) Suspend() error {
+	ms.mut.Lock()
+	defer ms.mut.Unlock()
+	var errs []error
+	for i, child := range ms.children {
+		if ms.suspended[i] {
+			continue
+		}
+		if err := child.Suspend(); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		ms.suspended[i] = true
+	}
+	return errors.Join(errs...)
+}
+
+func (ms *multiSuspender) Resume() error {
+	ms.mut.Lock()
+	defer ms.mut.Unlock()
+	var resumed []int
+	for i := len(ms.children) - 1; i >= 0; i-- {
+		if !ms.suspended[i] {
+			continue
+		}
+		err := ms.children[i].Resume()
+		if err == nil {
+			ms.suspended[i] = false
+			resumed = append(resumed, i)
+			continue
+		}
+		// Roll back, suspending in the reverse order of resumption.
+		errs := []error{err}
+		for j := len(resumed) - 1; j >= 0; j-- {
+			idx := resumed[j]
+			if err := ms.children[idx].Suspend(); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			ms.suspended[idx] = true
+		}
+		return errors.Join(errs...)
+	}
+	return nil
+}
+
+func (ms *multiSuspender) Close() error {
+	ms.mut.Lock()
+	defer ms.mut.Unlock()
+	var errs []error
+	for i := len(ms.children) - 1; i >= 0; i-- {
+		if err := ms.children[i].Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
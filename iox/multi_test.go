@@ -0,0 +1,74 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package iox
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// recordingSuspender records calls in a shared log, and fails the ones listed
+// in fail.
+type recordingSuspender struct {
+	name string
+	log  *[]string
+	fail map[string]error
+}
+
+func (rs *recordingSuspender) call(op string) error {
+	*rs.log = append(*rs.log, op+" "+rs.name)
+	return rs.fail[op]
+}
+
+func (rs *recordingSuspender) Suspend() error { return rs.call("suspend") }
+func (rs *recordingSuspender) Resume() error  { return rs.call("resume") }
+func (rs *recordingSuspender) Close() error   { return rs.call("close") }
+
+func TestMultiSuspender(t *testing.T) {
+	var log []string
+	errFailed := errors.New("failed")
+	conn := &recordingSuspender{name: "conn", log: &log, fail: map[string]error{}}
+	cache := &recordingSuspender{name: "cache", log: &log, fail: map[string]error{}}
+	file := &recordingSuspender{name: "file", log: &log, fail: map[string]error{}}
+	ms := MultiSuspender(conn, cache, file)
+
+	cache.fail["suspend"] = errFailed
+	if err := ms.Suspend(); !errors.Is(err, errFailed) {
+		t.Fatalf("Expected suspend failure, got %v", err)
+	}
+	delete(cache.fail, "suspend")
+	// only the failed child is retried
+	if err := ms.Suspend(); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"suspend conn", "suspend cache", "suspend file", "suspend cache"}
+	if !reflect.DeepEqual(log, expected) {
+		t.Fatalf("Expected %v, got %v", expected, log)
+	}
+
+	log = nil
+	conn.fail["resume"] = errFailed
+	if err := ms.Resume(); !errors.Is(err, errFailed) {
+		t.Fatalf("Expected resume failure, got %v", err)
+	}
+	expected = []string{"resume file", "resume cache", "resume conn", "suspend cache", "suspend file"}
+	if !reflect.DeepEqual(log, expected) {
+		t.Fatalf("Expected resume to roll back, got %v", log)
+	}
+
+	log = nil
+	delete(conn.fail, "resume")
+	if err := ms.Resume(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ms.Close(); err != nil {
+		t.Fatal(err)
+	}
+	expected = []string{"resume file", "resume cache", "resume conn", "close file", "close cache", "close conn"}
+	if !reflect.DeepEqual(log, expected) {
+		t.Fatalf("Expected %v, got %v", expected, log)
+	}
+}
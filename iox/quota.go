@@ -0,0 +1,133 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package iox
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+// ErrQuotaExceeded is returned by a QuotaWriter when a write exceeds the
+// quota.
+var ErrQuotaExceeded = errors.New("quota exceeded")
+
+// QuotaWriterOpts are the options used to create a QuotaWriter.
+type QuotaWriterOpts struct {
+	// Limit is the maximal amount of bytes written per window.
+	Limit int64
+	// Window is the duration of a quota window. If unset, the value is set to
+	// one second.
+	Window time.Duration
+	// Block makes writes exceeding the quota wait for the next window instead of
+	// returning ErrQuotaExceeded.
+	Block bool
+}
+
+// QuotaStats are usage statistics of a QuotaWriter.
+type QuotaStats struct {
+	// Used is the amount of bytes written in the current window.
+	Used int64
+	// Remaining is the amount of bytes left in the current window.
+	Remaining int64
+	// Written is the total amount of bytes written.
+	Written int64
+	// Rejected is the total amount of bytes rejected with ErrQuotaExceeded.
+	Rejected int64
+	// Blocked is the total duration writes have waited for quota.
+	Blocked time.Duration
+}
+
+// QuotaWriter is an io.Writer which enforces a quota of bytes per time window
+// on an underlying writer. The windows are fixed, and the first one starts at
+// the first write. Writes exceeding the quota are either partially written and
+// fail with ErrQuotaExceeded, or block until the quota is renewed.
+//
+// A QuotaWriter is safe for concurrent use. Concurrent writes are serialized,
+// so a blocked write will also block subsequent writes.
+type QuotaWriter struct {
+	w        io.Writer
+	opts     QuotaWriterOpts
+	writeMut sync.Mutex
+	mut      sync.Mutex
+	start    time.Time
+	stats    QuotaStats
+}
+
+// NewQuotaWriter returns a QuotaWriter on top of w.
+func NewQuotaWriter(w io.Writer, opts QuotaWriterOpts) *QuotaWriter {
+	if opts.Window == 0 {
+		opts.Window = 1 * time.Second
+	}
+	return &QuotaWriter{w: w, opts: opts}
+}
+
+// refresh starts a new window if the current one has ended, and returns the
+// remaining quota along with the end of the current window. Must be called
+// while holding mut.
+func (qw *QuotaWriter) refresh(now time.Time) (int64, time.Time) {
+	end := qw.start.Add(qw.opts.Window)
+	if qw.start.IsZero() || !now.Before(end) {
+		qw.start = now
+		qw.stats.Used = 0
+		end = now.Add(qw.opts.Window)
+	}
+	return qw.opts.Limit - qw.stats.Used, end
+}
+
+// Write writes p to the underlying writer, as far as the quota permits.
+func (qw *QuotaWriter) Write(p []byte) (int, error) {
+	qw.writeMut.Lock()
+	defer qw.writeMut.Unlock()
+	written := 0
+	for len(p) > 0 {
+		qw.mut.Lock()
+		now := time.Now()
+		remaining, end := qw.refresh(now)
+		if remaining <= 0 {
+			if !qw.opts.Block {
+				qw.stats.Rejected += int64(len(p))
+				qw.mut.Unlock()
+				return written, ErrQuotaExceeded
+			}
+			wait := end.Sub(now)
+			qw.stats.Blocked += wait
+			qw.mut.Unlock()
+			time.Sleep(wait)
+			continue
+		}
+		qw.mut.Unlock()
+
+		chunk := p
+		if remaining < int64(len(chunk)) {
+			chunk = chunk[:remaining]
+		}
+		n, err := qw.w.Write(chunk)
+		qw.mut.Lock()
+		qw.stats.Used += int64(n)
+		qw.stats.Written += int64(n)
+		qw.mut.Unlock()
+		written += n
+		p = p[n:]
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// Stats returns the usage statistics of the writer.
+func (qw *QuotaWriter) Stats() QuotaStats {
+	qw.mut.Lock()
+	defer qw.mut.Unlock()
+	qw.refresh(time.Now())
+	stats := qw.stats
+	stats.Remaining = qw.opts.Limit - stats.Used
+	if stats.Remaining < 0 {
+		stats.Remaining = 0
+	}
+	return stats
+}
@@ -0,0 +1,46 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package iox
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestQuotaWriterReject(t *testing.T) {
+	var buf bytes.Buffer
+	qw := NewQuotaWriter(&buf, QuotaWriterOpts{Limit: 5, Window: 1 * time.Hour})
+	n, err := qw.Write([]byte("hello world"))
+	if err != ErrQuotaExceeded {
+		t.Fatalf("Expected ErrQuotaExceeded, but got %v", err)
+	}
+	if n != 5 || buf.String() != "hello" {
+		t.Fatalf("Expected partial write of 5 bytes, but wrote %d bytes: %q", n, buf.String())
+	}
+	stats := qw.Stats()
+	if stats.Used != 5 || stats.Remaining != 0 || stats.Rejected != 6 {
+		t.Fatalf("Unexpected stats: %+v", stats)
+	}
+}
+
+func TestQuotaWriterBlock(t *testing.T) {
+	var buf bytes.Buffer
+	qw := NewQuotaWriter(&buf, QuotaWriterOpts{Limit: 5, Window: 20 * time.Millisecond, Block: true})
+	start := time.Now()
+	n, err := qw.Write([]byte("hello world"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 11 || buf.String() != "hello world" {
+		t.Fatalf("Expected full write, but wrote %d bytes: %q", n, buf.String())
+	}
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Fatalf("Expected write to span three windows, but took %s", elapsed)
+	}
+	if stats := qw.Stats(); stats.Written != 11 || stats.Blocked == 0 {
+		t.Fatalf("Unexpected stats: %+v", stats)
+	}
+}
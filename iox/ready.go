@@ -0,0 +1,150 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package iox
+
+import (
+	"context"
+	"strings"
+	"sync"
+)
+
+// Readier is implemented by resources that can tell whether they are ready to
+// serve requests. Ready may wait for the resource to become ready, for example
+// by resuming it, until ctx is done. It returns nil if the resource is ready,
+// and preferably a *ReadyError describing why it is not otherwise.
+type Readier interface {
+	Ready(ctx context.Context) error
+}
+
+// ReadyFunc is a function implementing Readier, typically a health probe.
+type ReadyFunc func(ctx context.Context) error
+
+// Ready calls f(ctx).
+func (f ReadyFunc) Ready(ctx context.Context) error {
+	return f(ctx)
+}
+
+// ReadyError describes why a resource is not ready.
+type ReadyError struct {
+	// Name is the name of the resource, if known.
+	Name string
+	// Stage is the stage where the readiness check failed, such as "closed",
+	// "resume" or "probe", if known.
+	Stage string
+	// Err is the underlying error.
+	Err error
+}
+
+func (e *ReadyError) Error() string {
+	var sb strings.Builder
+	if e.Name != "" {
+		sb.WriteString(e.Name)
+		sb.WriteString(": ")
+	}
+	if e.Stage != "" {
+		sb.WriteString(e.Stage)
+		sb.WriteString(": ")
+	}
+	sb.WriteString(e.Err.Error())
+	return sb.String()
+}
+
+func (e *ReadyError) Unwrap() error {
+	return e.Err
+}
+
+// NotReadyError is returned by ReadyGate.Ready if one or more resources are
+// not ready.
+type NotReadyError struct {
+	// Failures contains one error per resource that is not ready, in the order
+	// the resources were added to the gate.
+	Failures []*ReadyError
+}
+
+func (e *NotReadyError) Error() string {
+	msgs := make([]string, len(e.Failures))
+	for i, f := range e.Failures {
+		msgs[i] = f.Error()
+	}
+	return "not ready: " + strings.Join(msgs, "; ")
+}
+
+func (e *NotReadyError) Unwrap() []error {
+	errs := make([]error, len(e.Failures))
+	for i, f := range e.Failures {
+		errs[i] = f
+	}
+	return errs
+}
+
+// ReadyGate combines the readiness of multiple named resources, so that a
+// server can gate its readiness endpoint on all of them:
+//
+//	var gate iox.ReadyGate
+//	gate.Add("db", dbLocker)
+//	gate.Add("cache", iox.ReadyFunc(pingCache))
+//	...
+//	if err := gate.Ready(r.Context()); err != nil {
+//		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+//	}
+//
+// The zero value is an empty gate, which is always ready. A ReadyGate is safe
+// for concurrent use.
+type ReadyGate struct {
+	mut     sync.Mutex
+	names   []string
+	readies []Readier
+}
+
+// Add adds the resource r with the given name to the gate.
+func (g *ReadyGate) Add(name string, r Readier) {
+	g.mut.Lock()
+	defer g.mut.Unlock()
+	g.names = append(g.names, name)
+	g.readies = append(g.readies, r)
+}
+
+// Ready checks all resources concurrently, and waits until every check has
+// returned. It returns nil if all resources are ready, and a *NotReadyError
+// otherwise.
+func (g *ReadyGate) Ready(ctx context.Context) error {
+	g.mut.Lock()
+	names := g.names
+	readies := g.readies
+	g.mut.Unlock()
+
+	errs := make([]error, len(readies))
+	var wg sync.WaitGroup
+	for i, r := range readies {
+		wg.Add(1)
+		go func(i int, r Readier) {
+			defer wg.Done()
+			errs[i] = r.Ready(ctx)
+		}(i, r)
+	}
+	wg.Wait()
+
+	var failures []*ReadyError
+	for i, err := range errs {
+		if err == nil {
+			continue
+		}
+		re, ok := err.(*ReadyError)
+		if !ok {
+			re = &ReadyError{Err: err}
+		} else {
+			copied := *re
+			re = &copied
+		}
+		if re.Name == "" {
+			re.Name = names[i]
+		}
+		failures = append(failures, re)
+	}
+	if len(failures) == 0 {
+		return nil
+	}
+	return &NotReadyError{Failures: failures}
+}
@@ -0,0 +1,44 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package iox
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestReadyGate(t *testing.T) {
+	var g ReadyGate
+	if err := g.Ready(context.Background()); err != nil {
+		t.Fatalf("Expected empty gate to be ready, got %v", err)
+	}
+	errDown := errors.New("down")
+	g.Add("ok", ReadyFunc(func(ctx context.Context) error { return nil }))
+	g.Add("plain", ReadyFunc(func(ctx context.Context) error { return errDown }))
+	g.Add("staged", ReadyFunc(func(ctx context.Context) error {
+		return &ReadyError{Stage: "resume", Err: ErrClosed}
+	}))
+	err := g.Ready(context.Background())
+	var nre *NotReadyError
+	if !errors.As(err, &nre) {
+		t.Fatalf("Expected NotReadyError, got %v", err)
+	}
+	if len(nre.Failures) != 2 {
+		t.Fatalf("Expected two failures, got %v", nre.Failures)
+	}
+	if f := nre.Failures[0]; f.Name != "plain" || f.Err != errDown {
+		t.Errorf("Unexpected first failure %+v", f)
+	}
+	if f := nre.Failures[1]; f.Name != "staged" || f.Stage != "resume" {
+		t.Errorf("Unexpected second failure %+v", f)
+	}
+	if !errors.Is(err, errDown) || !errors.Is(err, ErrClosed) {
+		t.Errorf("Expected NotReadyError to wrap the failures")
+	}
+	if msg := err.Error(); msg != "not ready: plain: down; staged: resume: "+ErrClosed.Error() {
+		t.Errorf("Unexpected error message %q", msg)
+	}
+}
@@ -0,0 +1,133 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package iox
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"sync"
+)
+
+// SuspendableDB adapts a *sql.DB to a Suspender, for services holding many
+// rarely used database handles. It works in one of two modes:
+//
+// Created with NewSuspendableDB, suspending it drops the idle connections of
+// the database handle and keeps it from pooling new ones, while resuming
+// restores the idle connection limit. The handle stays usable while suspended,
+// it just opens a new connection for every use.
+//
+// Created with OpenSuspendableDB, suspending it closes the database handle
+// entirely, and resuming opens a new one through the connector. DB returns
+// ErrSuspended while suspended.
+type SuspendableDB struct {
+	mut       sync.Mutex
+	db        *sql.DB
+	connector driver.Connector
+	configure func(db *sql.DB)
+	maxIdle   int
+	suspended bool
+	closed    bool
+}
+
+// NewSuspendableDB returns a SuspendableDB suspending db by dropping its idle
+// connections. maxIdle is the idle connection limit restored on resume, and is
+// set on db right away.
+func NewSuspendableDB(db *sql.DB, maxIdle int) *SuspendableDB {
+	db.SetMaxIdleConns(maxIdle)
+	return &SuspendableDB{db: db, maxIdle: maxIdle}
+}
+
+// OpenSuspendableDB opens a database handle through c, and returns a
+// SuspendableDB suspending it by closing the handle. If configure is non-nil,
+// it is called with every new handle, e.g. to set connection limits, as every
+// resume opens a fresh handle with the default settings.
+func OpenSuspendableDB(c driver.Connector, configure func(db *sql.DB)) *SuspendableDB {
+	sd := &SuspendableDB{connector: c, configure: configure}
+	sd.open()
+	return sd
+}
+
+// open opens a new database handle through the connector.
+func (sd *SuspendableDB) open() {
+	sd.db = sql.OpenDB(sd.connector)
+	if sd.configure != nil {
+		sd.configure(sd.db)
+	}
+}
+
+// DB returns the current database handle. It returns ErrSuspended if the
+// handle is closed while suspended, and ErrClosed if the SuspendableDB is
+// closed. Handles must not be kept around across suspends.
+func (sd *SuspendableDB) DB() (*sql.DB, error) {
+	sd.mut.Lock()
+	defer sd.mut.Unlock()
+	if sd.closed {
+		return nil, ErrClosed
+	}
+	if sd.db == nil {
+		return nil, ErrSuspended
+	}
+	return sd.db, nil
+}
+
+// Close closes the database handle. Closing a closed SuspendableDB returns
+// ErrClosed.
+func (sd *SuspendableDB) Close() error {
+	sd.mut.Lock()
+	defer sd.mut.Unlock()
+	if sd.closed {
+		return ErrClosed
+	}
+	sd.closed = true
+	if sd.db == nil {
+		return nil
+	}
+	err := sd.db.Close()
+	sd.db = nil
+	return err
+}
+
+// Suspend drops the idle connections or closes the database handle, depending
+// on how the SuspendableDB was created. Suspending a suspended SuspendableDB
+// does nothing.
+func (sd *SuspendableDB) Suspend() error {
+	sd.mut.Lock()
+	defer sd.mut.Unlock()
+	if sd.closed {
+		return ErrClosed
+	}
+	if sd.suspended {
+		return nil
+	}
+	sd.suspended = true
+	if sd.connector == nil {
+		sd.db.SetMaxIdleConns(0)
+		return nil
+	}
+	err := sd.db.Close()
+	sd.db = nil
+	return err
+}
+
+// Resume restores the idle connection limit or opens a new database handle,
+// depending on how the SuspendableDB was created. Resuming a SuspendableDB
+// which is not suspended does nothing.
+func (sd *SuspendableDB) Resume() error {
+	sd.mut.Lock()
+	defer sd.mut.Unlock()
+	if sd.closed {
+		return ErrClosed
+	}
+	if !sd.suspended {
+		return nil
+	}
+	sd.suspended = false
+	if sd.connector == nil {
+		sd.db.SetMaxIdleConns(sd.maxIdle)
+		return nil
+	}
+	sd.open()
+	return nil
+}
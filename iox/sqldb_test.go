@@ -0,0 +1,121 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package iox
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"sync/atomic"
+	"testing"
+)
+
+// countingConnector is a database connector keeping track of open
+// connections.
+type countingConnector struct {
+	open atomic.Int32
+}
+
+func (c *countingConnector) Connect(context.Context) (driver.Conn, error) {
+	c.open.Add(1)
+	return &countingConn{c}, nil
+}
+
+func (c *countingConnector) Driver() driver.Driver {
+	return nil
+}
+
+type countingConn struct {
+	c *countingConnector
+}
+
+func (cc *countingConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("not supported")
+}
+
+func (cc *countingConn) Close() error {
+	cc.c.open.Add(-1)
+	return nil
+}
+
+func (cc *countingConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("not supported")
+}
+
+// useConn makes db open a connection and return it to the idle pool.
+func useConn(t *testing.T, db *sql.DB) {
+	t.Helper()
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+}
+
+func TestSuspendableDBLimits(t *testing.T) {
+	c := &countingConnector{}
+	db := sql.OpenDB(c)
+	sd := NewSuspendableDB(db, 2)
+	var _ Suspender = sd
+	useConn(t, db)
+	if n := c.open.Load(); n != 1 {
+		t.Fatalf("Expected an idle connection, got %d", n)
+	}
+	if err := sd.Suspend(); err != nil {
+		t.Fatal(err)
+	}
+	if n := c.open.Load(); n != 0 {
+		t.Fatalf("Expected idle connections to be closed, got %d", n)
+	}
+	useConn(t, db)
+	if n := c.open.Load(); n != 0 {
+		t.Fatalf("Expected no connections to be pooled while suspended, got %d", n)
+	}
+	if err := sd.Resume(); err != nil {
+		t.Fatal(err)
+	}
+	useConn(t, db)
+	if n := c.open.Load(); n != 1 {
+		t.Fatalf("Expected connections to be pooled after resume, got %d", n)
+	}
+	sd.Close()
+}
+
+func TestSuspendableDBReopen(t *testing.T) {
+	c := &countingConnector{}
+	configured := 0
+	sd := OpenSuspendableDB(c, func(db *sql.DB) { configured++ })
+	db, err := sd.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	useConn(t, db)
+	if err := sd.Suspend(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sd.DB(); err != ErrSuspended {
+		t.Fatalf("Expected ErrSuspended, got %v", err)
+	}
+	if n := c.open.Load(); n != 0 {
+		t.Fatalf("Expected connections to be closed, got %d", n)
+	}
+	if err := sd.Resume(); err != nil {
+		t.Fatal(err)
+	}
+	if db, err = sd.DB(); err != nil {
+		t.Fatal(err)
+	}
+	useConn(t, db)
+	if configured != 2 {
+		t.Fatalf("Expected every handle to be configured, got %d", configured)
+	}
+	if err := sd.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sd.DB(); err != ErrClosed {
+		t.Fatalf("Expected ErrClosed, got %v", err)
+	}
+}
@@ -0,0 +1,190 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package syncx
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// The atomic types in this file are small, typed wrappers around sync/atomic.
+// As with sync/atomic, all operations are sequentially consistent: If the
+// effect of an atomic operation A is observed by atomic operation B, then A is
+// synchronized before B, and all writes done before A are visible after B. This
+// means you can use them as memory barriers for other, non-atomic writes.
+//
+// The zero value of every type is ready to use, and none of them must be copied
+// after first use.
+
+// AtomicTime is a time.Time which can be loaded and stored atomically. The
+// whole time value is kept, including its location and monotonic clock
+// reading. The zero value holds the zero time.
+type AtomicTime struct {
+	p atomic.Pointer[time.Time]
+}
+
+func derefTime(p *time.Time) time.Time {
+	if p == nil {
+		return time.Time{}
+	}
+	return *p
+}
+
+// Load atomically loads the time.
+func (at *AtomicTime) Load() time.Time {
+	return derefTime(at.p.Load())
+}
+
+// Store atomically stores t.
+func (at *AtomicTime) Store(t time.Time) {
+	at.p.Store(&t)
+}
+
+// Swap atomically stores t and returns the previous time.
+func (at *AtomicTime) Swap(t time.Time) time.Time {
+	return derefTime(at.p.Swap(&t))
+}
+
+// CompareAndSwap stores new if the current time is equal to old, as reported
+// by time.Time.Equal, and reports whether the swap happened.
+func (at *AtomicTime) CompareAndSwap(old, new time.Time) bool {
+	for {
+		p := at.p.Load()
+		if !derefTime(p).Equal(old) {
+			return false
+		}
+		if at.p.CompareAndSwap(p, &new) {
+			return true
+		}
+	}
+}
+
+// AtomicDuration is a time.Duration which can be loaded and stored atomically.
+type AtomicDuration struct {
+	d atomic.Int64
+}
+
+// Load atomically loads the duration.
+func (ad *AtomicDuration) Load() time.Duration {
+	return time.Duration(ad.d.Load())
+}
+
+// Store atomically stores d.
+func (ad *AtomicDuration) Store(d time.Duration) {
+	ad.d.Store(int64(d))
+}
+
+// Swap atomically stores d and returns the previous duration.
+func (ad *AtomicDuration) Swap(d time.Duration) time.Duration {
+	return time.Duration(ad.d.Swap(int64(d)))
+}
+
+// CompareAndSwap stores new if the current duration is equal to old, and
+// reports whether the swap happened.
+func (ad *AtomicDuration) CompareAndSwap(old, new time.Duration) bool {
+	return ad.d.CompareAndSwap(int64(old), int64(new))
+}
+
+// Add atomically adds delta to the duration and returns the new duration.
+func (ad *AtomicDuration) Add(delta time.Duration) time.Duration {
+	return time.Duration(ad.d.Add(int64(delta)))
+}
+
+// AtomicEnum is a small, unsigned enumeration value – typically a state in a
+// state machine – which can be loaded and stored atomically.
+type AtomicEnum struct {
+	v atomic.Uint32
+}
+
+// Load atomically loads the value.
+func (ae *AtomicEnum) Load() uint32 {
+	return ae.v.Load()
+}
+
+// Store atomically stores v.
+func (ae *AtomicEnum) Store(v uint32) {
+	ae.v.Store(v)
+}
+
+// Swap atomically stores v and returns the previous value.
+func (ae *AtomicEnum) Swap(v uint32) uint32 {
+	return ae.v.Swap(v)
+}
+
+// CompareAndSwap stores new if the current value is equal to old, and reports
+// whether the swap happened. This is typically used to perform a state
+// transition exactly once.
+func (ae *AtomicEnum) CompareAndSwap(old, new uint32) bool {
+	return ae.v.CompareAndSwap(old, new)
+}
+
+// Atomic is a value of type T which can be loaded and stored atomically. It is
+// a typed alternative to atomic.Value: There are no type assertions, and
+// storing values of different concrete types is fine when T is an interface
+// type. The zero value holds the zero value of T.
+type Atomic[T any] struct {
+	p atomic.Pointer[T]
+}
+
+// Load atomically loads the value.
+func (a *Atomic[T]) Load() T {
+	if p := a.p.Load(); p != nil {
+		return *p
+	}
+	var zero T
+	return zero
+}
+
+// Store atomically stores v.
+func (a *Atomic[T]) Store(v T) {
+	a.p.Store(&v)
+}
+
+// Swap atomically stores v and returns the previous value.
+func (a *Atomic[T]) Swap(v T) T {
+	if p := a.p.Swap(&v); p != nil {
+		return *p
+	}
+	var zero T
+	return zero
+}
+
+// CompareAndSwap stores new if the current value is equal to old, and reports
+// whether the swap happened. Values are compared like interface values with
+// ==, so CompareAndSwap panics if T is not comparable, like
+// atomic.Value.CompareAndSwap.
+func (a *Atomic[T]) CompareAndSwap(old, new T) bool {
+	for {
+		p := a.p.Load()
+		var cur T
+		if p != nil {
+			cur = *p
+		}
+		if any(cur) != any(old) {
+			return false
+		}
+		if a.p.CompareAndSwap(p, &new) {
+			return true
+		}
+	}
+}
+
+// Update atomically replaces the value with f applied to it, and returns the
+// new value. f may be called multiple times if the value is concurrently
+// modified, so it must not have side effects. Update works for any T, including
+// types that are not comparable.
+func (a *Atomic[T]) Update(f func(T) T) T {
+	for {
+		p := a.p.Load()
+		var cur T
+		if p != nil {
+			cur = *p
+		}
+		v := f(cur)
+		if a.p.CompareAndSwap(p, &v) {
+			return v
+		}
+	}
+}
@@ -0,0 +1,135 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package syncx
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAtomicTime(t *testing.T) {
+	var at AtomicTime
+	if !at.Load().IsZero() {
+		t.Fatalf("Expected zero value to hold the zero time, but was %s", at.Load())
+	}
+	now := time.Now()
+	at.Store(now)
+	if !at.Load().Equal(now) {
+		t.Fatalf("Expected %s, but was %s", now, at.Load())
+	}
+	later := now.Add(time.Second)
+	if at.CompareAndSwap(later, now) {
+		t.Fatal("CompareAndSwap swapped with wrong old value")
+	}
+	if !at.CompareAndSwap(now, later) {
+		t.Fatal("CompareAndSwap did not swap with correct old value")
+	}
+	if prev := at.Swap(time.Time{}); !prev.Equal(later) {
+		t.Fatalf("Expected Swap to return %s, but was %s", later, prev)
+	}
+	if !at.Load().IsZero() {
+		t.Fatalf("Expected zero time after swap, but was %s", at.Load())
+	}
+}
+
+func TestAtomicTimeEpoch(t *testing.T) {
+	var at AtomicTime
+	epoch := time.Unix(0, 0)
+	at.Store(epoch)
+	if got := at.Load(); !got.Equal(epoch) {
+		t.Fatalf("Expected the Unix epoch, but was %s", got)
+	}
+	now := time.Now()
+	at.Store(now)
+	if got := at.Load(); got != now {
+		t.Fatalf("Expected the monotonic clock reading to be kept, but was %s", got)
+	}
+}
+
+func TestAtomicDurationConcurrentAdd(t *testing.T) {
+	var ad AtomicDuration
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			ad.Add(time.Millisecond)
+			wg.Done()
+		}()
+	}
+	wg.Wait()
+	if ad.Load() != 100*time.Millisecond {
+		t.Fatalf("Expected 100ms, but was %s", ad.Load())
+	}
+}
+
+func TestAtomicEnumTransition(t *testing.T) {
+	var ae AtomicEnum
+	var wg sync.WaitGroup
+	var mut sync.Mutex
+	transitions := 0
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			if ae.CompareAndSwap(0, 1) {
+				mut.Lock()
+				transitions++
+				mut.Unlock()
+			}
+			wg.Done()
+		}()
+	}
+	wg.Wait()
+	if transitions != 1 {
+		t.Fatalf("Expected exactly one transition, but got %d", transitions)
+	}
+	if ae.Load() != 1 {
+		t.Fatalf("Expected state 1, but was %d", ae.Load())
+	}
+}
+
+func TestAtomic(t *testing.T) {
+	var a Atomic[error]
+	if a.Load() != nil {
+		t.Fatal("Expected zero value to hold nil")
+	}
+	errA := errTest("a")
+	a.Store(errA)
+	if old := a.Swap(timeoutErr{}); old != errA {
+		t.Fatalf("Expected Swap to return %v, got %v", errA, old)
+	}
+	if a.CompareAndSwap(errA, nil) {
+		t.Fatal("Expected CompareAndSwap with a stale value to fail")
+	}
+	if !a.CompareAndSwap(timeoutErr{}, nil) || a.Load() != nil {
+		t.Fatal("Expected CompareAndSwap with the current value to succeed")
+	}
+}
+
+type errTest string
+
+func (e errTest) Error() string { return string(e) }
+
+type timeoutErr struct{}
+
+func (timeoutErr) Error() string { return "timeout" }
+
+func TestAtomicUpdate(t *testing.T) {
+	var a Atomic[[]int]
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			a.Update(func(s []int) []int {
+				return append(s[:len(s):len(s)], i)
+			})
+		}(i)
+	}
+	wg.Wait()
+	if n := len(a.Load()); n != 100 {
+		t.Fatalf("Expected 100 updates, got %d", n)
+	}
+}
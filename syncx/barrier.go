@@ -0,0 +1,82 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package syncx
+
+import (
+	"context"
+	"sync"
+)
+
+// Barrier is a reusable cyclic barrier: It lets a fixed number of participants
+// wait for each other, then releases them all at once and resets for the next
+// generation. This is typically used for lock-step workers.
+type Barrier struct {
+	parties int
+	action  func()
+	mut     sync.Mutex
+	waiting int
+	gen     chan struct{}
+}
+
+// NewBarrier returns a Barrier for n participants. If action is not nil, it is
+// called once per generation by the last participant to arrive, before any
+// participant is released. NewBarrier panics if n is less than 1.
+func NewBarrier(n int, action func()) *Barrier {
+	if n < 1 {
+		panic("syncx: barrier needs at least one participant")
+	}
+	return &Barrier{
+		parties: n,
+		action:  action,
+		gen:     make(chan struct{}),
+	}
+}
+
+// Await waits until all participants have called Await, then returns nil. If
+// ctx is done before that, the participant withdraws from the current
+// generation and Await returns the context error; the generation then waits
+// for another participant to take its place.
+func (b *Barrier) Await(ctx context.Context) error {
+	b.mut.Lock()
+	gen := b.gen
+	b.waiting++
+	if b.waiting == b.parties {
+		defer b.mut.Unlock()
+		if b.action != nil {
+			b.action()
+		}
+		b.waiting = 0
+		b.gen = make(chan struct{})
+		close(gen)
+		return nil
+	}
+	b.mut.Unlock()
+	select {
+	case <-gen:
+		return nil
+	case <-ctx.Done():
+		b.mut.Lock()
+		defer b.mut.Unlock()
+		if b.gen != gen {
+			// released while we were giving up
+			return nil
+		}
+		b.waiting--
+		return ctx.Err()
+	}
+}
+
+// Parties returns the number of participants required to release the barrier.
+func (b *Barrier) Parties() int {
+	return b.parties
+}
+
+// Waiting returns the number of participants currently waiting at the
+// barrier.
+func (b *Barrier) Waiting() int {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+	return b.waiting
+}
@@ -0,0 +1,70 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package syncx
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBarrierGenerations(t *testing.T) {
+	const workers, rounds = 4, 10
+	generations := 0
+	b := NewBarrier(workers, func() { generations++ })
+	var mut sync.Mutex
+	steps := make([]int, workers)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for r := 0; r < rounds; r++ {
+				mut.Lock()
+				steps[i]++
+				for j, s := range steps {
+					if s < r || r+1 < s {
+						t.Errorf("Worker %d is at step %d while worker %d is at %d", j, s, i, r+1)
+					}
+				}
+				mut.Unlock()
+				if err := b.Await(context.Background()); err != nil {
+					t.Error(err)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	if generations != rounds {
+		t.Errorf("Expected action to run %d times, ran %d times", rounds, generations)
+	}
+	if b.Waiting() != 0 {
+		t.Errorf("Expected no waiters, got %d", b.Waiting())
+	}
+}
+
+func TestBarrierCancel(t *testing.T) {
+	b := NewBarrier(2, nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := b.Await(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("Expected DeadlineExceeded, got %v", err)
+	}
+	if b.Waiting() != 0 {
+		t.Fatalf("Expected canceled participant to withdraw, but %d are waiting", b.Waiting())
+	}
+	done := make(chan error)
+	go func() { done <- b.Await(context.Background()) }()
+	for b.Waiting() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	if err := b.Await(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
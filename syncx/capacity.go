@@ -0,0 +1,97 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package syncx
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrCapacityExceeded is returned by RLockN if the cost of the read lock
+// exceeds the total capacity of the locker, so that it could never be granted.
+var ErrCapacityExceeded = errors.New("syncx: cost exceeds locker capacity")
+
+// capacityGate is a weighted semaphore granting capacity in FIFO order, so
+// that large requests are not starved by small ones. A zero capacity means no
+// limit.
+type capacityGate struct {
+	mut     sync.Mutex
+	cap     int64
+	used    int64
+	waiters []*capacityWaiter
+}
+
+type capacityWaiter struct {
+	n     int64
+	ready chan struct{}
+}
+
+func (cg *capacityGate) acquire(ctx context.Context, n int64) error {
+	if cg.cap == 0 {
+		return nil
+	}
+	if n > cg.cap {
+		return ErrCapacityExceeded
+	}
+	cg.mut.Lock()
+	if len(cg.waiters) == 0 && cg.used+n <= cg.cap {
+		cg.used += n
+		cg.mut.Unlock()
+		return nil
+	}
+	w := &capacityWaiter{n: n, ready: make(chan struct{})}
+	cg.waiters = append(cg.waiters, w)
+	cg.mut.Unlock()
+
+	select {
+	case <-w.ready:
+		return nil
+	case <-ctx.Done():
+		cg.mut.Lock()
+		defer cg.mut.Unlock()
+		select {
+		case <-w.ready:
+			// granted while we gave up, give it back
+			cg.used -= n
+		default:
+			for i, other := range cg.waiters {
+				if other == w {
+					cg.waiters = append(cg.waiters[:i], cg.waiters[i+1:]...)
+					break
+				}
+			}
+		}
+		cg.grant()
+		return ctx.Err()
+	}
+}
+
+func (cg *capacityGate) release(n int64) {
+	if cg.cap == 0 {
+		return
+	}
+	cg.mut.Lock()
+	defer cg.mut.Unlock()
+	cg.used -= n
+	if cg.used < 0 {
+		panic("syncx: released more capacity than acquired")
+	}
+	cg.grant()
+}
+
+// grant hands out capacity to waiters in order. Must be called while holding
+// the mutex.
+func (cg *capacityGate) grant() {
+	for len(cg.waiters) > 0 {
+		w := cg.waiters[0]
+		if cg.used+w.n > cg.cap {
+			return
+		}
+		cg.used += w.n
+		cg.waiters = cg.waiters[1:]
+		close(w.ready)
+	}
+}
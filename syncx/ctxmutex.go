@@ -0,0 +1,163 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package syncx
+
+import (
+	"context"
+	"sync"
+)
+
+// ContextRWMutex is a reader/writer mutual exclusion lock where acquiring the
+// lock can be abandoned through a context. Like sync.RWMutex, a blocked writer
+// excludes new readers, so that writers are not starved.
+//
+// The zero value is an unlocked mutex. A ContextRWMutex must not be copied
+// after first use.
+type ContextRWMutex struct {
+	mut            sync.Mutex
+	readers        int
+	writer         bool
+	waitingWriters int
+	changed        chan struct{}
+}
+
+// wait returns a channel that is closed on the next state change. Must be
+// called while holding mut.
+func (m *ContextRWMutex) wait() <-chan struct{} {
+	if m.changed == nil {
+		m.changed = make(chan struct{})
+	}
+	return m.changed
+}
+
+// broadcast wakes up all waiters. Must be called while holding mut.
+func (m *ContextRWMutex) broadcast() {
+	if m.changed != nil {
+		close(m.changed)
+		m.changed = nil
+	}
+}
+
+// LockContext acquires the write lock, or returns ctx.Err() if ctx is done
+// before the lock could be acquired.
+func (m *ContextRWMutex) LockContext(ctx context.Context) error {
+	m.mut.Lock()
+	m.waitingWriters++
+	for m.writer || m.readers > 0 {
+		ch := m.wait()
+		m.mut.Unlock()
+		select {
+		case <-ch:
+		case <-ctx.Done():
+			m.mut.Lock()
+			m.waitingWriters--
+			// readers may have been waiting for us
+			m.broadcast()
+			m.mut.Unlock()
+			return ctx.Err()
+		}
+		m.mut.Lock()
+	}
+	m.waitingWriters--
+	m.writer = true
+	m.mut.Unlock()
+	return nil
+}
+
+// Lock acquires the write lock, blocking until it is available.
+func (m *ContextRWMutex) Lock() {
+	m.LockContext(context.Background())
+}
+
+// TryLock tries to acquire the write lock without blocking, and reports
+// whether it succeeded.
+func (m *ContextRWMutex) TryLock() bool {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	if m.writer || m.readers > 0 {
+		return false
+	}
+	m.writer = true
+	return true
+}
+
+// Unlock releases the write lock.
+func (m *ContextRWMutex) Unlock() {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	if !m.writer {
+		panic("syncx: Unlock of unlocked ContextRWMutex")
+	}
+	m.writer = false
+	m.broadcast()
+}
+
+// RLockContext acquires a read lock, or returns ctx.Err() if ctx is done
+// before the lock could be acquired.
+func (m *ContextRWMutex) RLockContext(ctx context.Context) error {
+	m.mut.Lock()
+	for m.writer || m.waitingWriters > 0 {
+		ch := m.wait()
+		m.mut.Unlock()
+		select {
+		case <-ch:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		m.mut.Lock()
+	}
+	m.readers++
+	m.mut.Unlock()
+	return nil
+}
+
+// RLock acquires a read lock, blocking until it is available.
+func (m *ContextRWMutex) RLock() {
+	m.RLockContext(context.Background())
+}
+
+// RUnlock releases a read lock.
+func (m *ContextRWMutex) RUnlock() {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	if m.readers == 0 {
+		panic("syncx: RUnlock of unlocked ContextRWMutex")
+	}
+	m.readers--
+	if m.readers == 0 {
+		m.broadcast()
+	}
+}
+
+// ContextMutex is a mutual exclusion lock where acquiring the lock can be
+// abandoned through a context.
+//
+// The zero value is an unlocked mutex. A ContextMutex must not be copied after
+// first use.
+type ContextMutex struct {
+	rw ContextRWMutex
+}
+
+// LockContext acquires the lock, or returns ctx.Err() if ctx is done before
+// the lock could be acquired.
+func (m *ContextMutex) LockContext(ctx context.Context) error {
+	return m.rw.LockContext(ctx)
+}
+
+// Lock acquires the lock, blocking until it is available.
+func (m *ContextMutex) Lock() {
+	m.rw.Lock()
+}
+
+// TryLock tries to acquire the lock without blocking, and reports whether it
+// succeeded.
+func (m *ContextMutex) TryLock() bool {
+	return m.rw.TryLock()
+}
+
+// Unlock releases the lock.
+func (m *ContextMutex) Unlock() {
+	m.rw.Unlock()
+}
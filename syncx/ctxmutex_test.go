@@ -0,0 +1,83 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package syncx
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestContextMutex(t *testing.T) {
+	var m ContextMutex
+	m.Lock()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := m.LockContext(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("Expected DeadlineExceeded on contested lock, got %v", err)
+	}
+	if m.TryLock() {
+		t.Fatal("Expected TryLock to fail on locked mutex")
+	}
+	m.Unlock()
+	if err := m.LockContext(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	m.Unlock()
+
+	var wg sync.WaitGroup
+	counter := 0
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m.Lock()
+			counter++
+			m.Unlock()
+		}()
+	}
+	wg.Wait()
+	if counter != 50 {
+		t.Errorf("Expected counter to be 50, was %d", counter)
+	}
+}
+
+func TestContextRWMutex(t *testing.T) {
+	var m ContextRWMutex
+	m.RLock()
+	m.RLock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := m.LockContext(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("Expected DeadlineExceeded with readers present, got %v", err)
+	}
+	// the abandoned writer must not block new readers
+	if err := m.RLockContext(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	locked := make(chan struct{})
+	go func() {
+		m.Lock()
+		close(locked)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := m.RLockContext(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("Expected waiting writer to block new readers, got %v", err)
+	}
+	m.RUnlock()
+	m.RUnlock()
+	m.RUnlock()
+	select {
+	case <-locked:
+	case <-time.After(1 * time.Second):
+		t.Fatal("Writer did not acquire lock after readers left")
+	}
+	m.Unlock()
+}
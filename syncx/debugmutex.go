@@ -0,0 +1,108 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package syncx
+
+import (
+	"bytes"
+	"runtime"
+	"strconv"
+	"sync"
+)
+
+// DebugMutex is a mutual exclusion lock which knows which goroutine holds it.
+// It is a debugging aid for code that accidentally calls back into itself
+// while holding a lock: Instead of hanging forever, a DebugMutex panics with
+// the stack trace of where the lock was first acquired. Optionally, it can be
+// made reentrant instead, so the holder can lock it again.
+//
+// Goroutine identities are found by parsing stack traces, which makes every
+// Lock and Unlock orders of magnitude slower than those of a sync.Mutex. Go
+// deliberately has no goroutine-local state, so do not use a DebugMutex
+// outside of debugging sessions and tests.
+//
+// The zero value is an unlocked, non-reentrant DebugMutex.
+type DebugMutex struct {
+	reentrant bool
+	mut       sync.Mutex
+	state     sync.Mutex
+	owner     uint64
+	depth     int
+	stack     []byte
+}
+
+// NewDebugMutex returns a new DebugMutex. If reentrant is true, the goroutine
+// holding the lock may lock it again, and must unlock it as many times as it
+// locked it. Otherwise, locking it again panics.
+func NewDebugMutex(reentrant bool) *DebugMutex {
+	return &DebugMutex{reentrant: reentrant}
+}
+
+// Lock locks m. If m is held by the calling goroutine, Lock either panics or
+// increments the lock depth, depending on whether m is reentrant.
+func (m *DebugMutex) Lock() {
+	stack := callerStack()
+	id := goroutineID(stack)
+	m.state.Lock()
+	if m.depth > 0 && m.owner == id {
+		defer m.state.Unlock()
+		if m.reentrant {
+			m.depth++
+			return
+		}
+		panic("syncx: self-deadlock: DebugMutex locked again by goroutine " +
+			strconv.FormatUint(id, 10) + ", which locked it at:\n" + string(m.stack))
+	}
+	m.state.Unlock()
+
+	m.mut.Lock()
+	m.state.Lock()
+	m.owner = id
+	m.depth = 1
+	m.stack = stack
+	m.state.Unlock()
+}
+
+// Unlock unlocks m. It panics if m is not held by the calling goroutine.
+func (m *DebugMutex) Unlock() {
+	id := goroutineID(callerStack())
+	m.state.Lock()
+	defer m.state.Unlock()
+	if m.depth == 0 || m.owner != id {
+		panic("syncx: DebugMutex unlocked by goroutine " + strconv.FormatUint(id, 10) +
+			", which does not hold it")
+	}
+	m.depth--
+	if m.depth == 0 {
+		m.owner = 0
+		m.stack = nil
+		m.mut.Unlock()
+	}
+}
+
+// callerStack returns the stack trace of the calling goroutine.
+func callerStack() []byte {
+	buf := make([]byte, 4096)
+	for {
+		n := runtime.Stack(buf, false)
+		if n < len(buf) {
+			return buf[:n]
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+}
+
+// goroutineID parses the goroutine ID from the first line of a stack trace,
+// which reads "goroutine 123 [running]:".
+func goroutineID(stack []byte) uint64 {
+	stack = bytes.TrimPrefix(stack, []byte("goroutine "))
+	if i := bytes.IndexByte(stack, ' '); i >= 0 {
+		stack = stack[:i]
+	}
+	id, err := strconv.ParseUint(string(stack), 10, 64)
+	if err != nil {
+		panic("syncx: cannot parse goroutine ID: " + err.Error())
+	}
+	return id
+}
@@ -0,0 +1,77 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package syncx
+
+import (
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestDebugMutexSelfDeadlock(t *testing.T) {
+	var m DebugMutex
+	m.Lock()
+	defer m.Unlock()
+	defer func() {
+		msg, _ := recover().(string)
+		if !strings.Contains(msg, "self-deadlock") || !strings.Contains(msg, "TestDebugMutexSelfDeadlock") {
+			t.Fatalf("Expected self-deadlock panic with the locking stack, got %q", msg)
+		}
+	}()
+	m.Lock()
+}
+
+func TestDebugMutexReentrant(t *testing.T) {
+	m := NewDebugMutex(true)
+	m.Lock()
+	m.Lock()
+	m.Unlock()
+	locked := make(chan struct{})
+	go func() {
+		m.Lock()
+		close(locked)
+		m.Unlock()
+	}()
+	select {
+	case <-locked:
+		t.Fatal("Expected lock to be held until unlocked as many times as locked")
+	default:
+	}
+	m.Unlock()
+	<-locked
+}
+
+func TestDebugMutexExclusion(t *testing.T) {
+	var m DebugMutex
+	var wg sync.WaitGroup
+	n := 0
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m.Lock()
+			n++
+			m.Unlock()
+		}()
+	}
+	wg.Wait()
+	if n != 20 {
+		t.Fatalf("Expected 20 increments, got %d", n)
+	}
+}
+
+func TestDebugMutexForeignUnlock(t *testing.T) {
+	var m DebugMutex
+	m.Lock()
+	defer m.Unlock()
+	done := make(chan interface{})
+	go func() {
+		defer func() { done <- recover() }()
+		m.Unlock()
+	}()
+	if <-done == nil {
+		t.Fatal("Expected unlock from another goroutine to panic")
+	}
+}
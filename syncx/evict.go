@@ -0,0 +1,45 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package syncx
+
+import (
+	"context"
+	"sync"
+)
+
+// evicter implements reader eviction for the lockers in this package. The
+// reader context is created lazily, and replaced once the locker's write lock
+// has been acquired after an eviction: At that point, all evicted readers have
+// released their read locks.
+type evicter struct {
+	mut    sync.Mutex
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+}
+
+func (e *evicter) readerContext() context.Context {
+	e.mut.Lock()
+	defer e.mut.Unlock()
+	if e.ctx == nil {
+		e.ctx, e.cancel = context.WithCancelCause(context.Background())
+	}
+	return e.ctx
+}
+
+func (e *evicter) evict(reason error) {
+	e.readerContext()
+	e.mut.Lock()
+	e.cancel(reason)
+	e.mut.Unlock()
+}
+
+// reset must be called while holding the write lock of the locker.
+func (e *evicter) reset() {
+	e.mut.Lock()
+	if e.ctx != nil && e.ctx.Err() != nil {
+		e.ctx, e.cancel = nil, nil
+	}
+	e.mut.Unlock()
+}
@@ -0,0 +1,65 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package syncx
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestEvictReaders(t *testing.T) {
+	errShutdown := errors.New("shutting down")
+	lockers := map[string]interface {
+		RLock() error
+		RUnlock()
+		Close() error
+		EvictReaders(error)
+		ReaderContext() context.Context
+	}{
+		"CloseLocker":   testCloseLocker(&dummyCloser{}),
+		"SuspendLocker": testSuspendLocker(&dummySuspender{}, nil),
+	}
+	for name, locker := range lockers {
+		if err := locker.RLock(); err != nil {
+			t.Fatal(err)
+		}
+		ctx := locker.ReaderContext()
+		if ctx.Err() != nil {
+			t.Fatalf("%s: Expected reader context to be live before eviction", name)
+		}
+		closed := make(chan error)
+		go func() {
+			locker.EvictReaders(errShutdown)
+			closed <- locker.Close()
+		}()
+		select {
+		case <-ctx.Done():
+		case <-time.After(1 * time.Second):
+			t.Fatalf("%s: Expected reader context to be cancelled on eviction", name)
+		}
+		if cause := context.Cause(ctx); cause != errShutdown {
+			t.Fatalf("%s: Expected eviction cause to be %v, but was %v", name, errShutdown, cause)
+		}
+		locker.RUnlock()
+		if err := <-closed; err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestEvictionResetOnLock(t *testing.T) {
+	cl := testCloseLocker(&dummyCloser{})
+	cl.EvictReaders(nil)
+	if cl.ReaderContext().Err() == nil {
+		t.Fatal("Expected reader context to be cancelled after eviction")
+	}
+	cl.Lock()
+	cl.Unlock()
+	if cl.ReaderContext().Err() != nil {
+		t.Fatal("Expected eviction to be reset after acquiring the write lock")
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package syncx
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// Group is a collection of goroutines working on subtasks of a common task. In
+// contrast to errgroup, a Group collects the errors of all subtasks rather than
+// only the first one.
+//
+// The zero value is a valid Group without a context and without a limit on
+// the number of active goroutines.
+type Group struct {
+	wg     sync.WaitGroup
+	sem    chan struct{}
+	ctx    context.Context
+	cancel context.CancelFunc
+	mut    sync.Mutex
+	errs   []error
+}
+
+// NewGroup returns a new Group and an associated context derived from ctx. The
+// derived context is cancelled when ctx is, or when Wait returns. Subtasks
+// posted through Go after the derived context is done are not run, and
+// contribute the context's error instead.
+func NewGroup(ctx context.Context) (*Group, context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	return &Group{ctx: ctx, cancel: cancel}, ctx
+}
+
+// SetLimit limits the number of active goroutines in the group to at most n.
+// A negative value indicates no limit. SetLimit must not be called while any
+// goroutines in the group are active.
+func (g *Group) SetLimit(n int) {
+	if n < 0 {
+		g.sem = nil
+		return
+	}
+	if len(g.sem) != 0 {
+		panic("syncx: SetLimit called while goroutines are active")
+	}
+	g.sem = make(chan struct{}, n)
+}
+
+func (g *Group) done() <-chan struct{} {
+	if g.ctx == nil {
+		return nil
+	}
+	return g.ctx.Done()
+}
+
+func (g *Group) addErr(err error) {
+	g.mut.Lock()
+	g.errs = append(g.errs, err)
+	g.mut.Unlock()
+}
+
+// Go calls f in a new goroutine. If the group has a limit, Go blocks until f
+// can be started without exceeding it. Any error returned by f is collected,
+// and returned by Wait.
+func (g *Group) Go(f func() error) {
+	if g.sem != nil {
+		select {
+		case g.sem <- struct{}{}:
+		case <-g.done():
+			g.addErr(g.ctx.Err())
+			return
+		}
+	} else if g.ctx != nil && g.ctx.Err() != nil {
+		g.addErr(g.ctx.Err())
+		return
+	}
+	g.wg.Add(1)
+	go func() {
+		defer func() {
+			if g.sem != nil {
+				<-g.sem
+			}
+			g.wg.Done()
+		}()
+		if err := f(); err != nil {
+			g.addErr(err)
+		}
+	}()
+}
+
+// Wait blocks until all subtasks posted through Go have finished, and returns
+// their errors joined with errors.Join, in the order they were returned. If no
+// subtask failed, Wait returns nil.
+func (g *Group) Wait() error {
+	g.wg.Wait()
+	if g.cancel != nil {
+		g.cancel()
+	}
+	g.mut.Lock()
+	defer g.mut.Unlock()
+	return errors.Join(g.errs...)
+}
@@ -0,0 +1,85 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package syncx
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGroupCollectsAllErrors(t *testing.T) {
+	var g Group
+	errA, errB := errors.New("a"), errors.New("b")
+	g.Go(func() error { return errA })
+	g.Go(func() error { return nil })
+	g.Go(func() error { return errB })
+	err := g.Wait()
+	if !errors.Is(err, errA) || !errors.Is(err, errB) {
+		t.Errorf("Expected both errors to be reported, got %v", err)
+	}
+
+	var empty Group
+	if err := empty.Wait(); err != nil {
+		t.Errorf("Expected nil error from empty group, got %v", err)
+	}
+}
+
+func TestGroupLimit(t *testing.T) {
+	var g Group
+	g.SetLimit(2)
+	var active, maxActive int32
+	for i := 0; i < 10; i++ {
+		g.Go(func() error {
+			n := atomic.AddInt32(&active, 1)
+			for {
+				m := atomic.LoadInt32(&maxActive)
+				if n <= m || atomic.CompareAndSwapInt32(&maxActive, m, n) {
+					break
+				}
+			}
+			time.Sleep(5 * time.Millisecond)
+			atomic.AddInt32(&active, -1)
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	if maxActive != 2 {
+		t.Errorf("Expected at most 2 active goroutines, but saw %d", maxActive)
+	}
+}
+
+func TestGroupContext(t *testing.T) {
+	parent, cancel := context.WithCancel(context.Background())
+	g, ctx := NewGroup(parent)
+	g.SetLimit(1)
+	g.Go(func() error {
+		<-ctx.Done()
+		return nil
+	})
+	cancel()
+	var ran bool
+	g.Go(func() error {
+		ran = true
+		return nil
+	})
+	err := g.Wait()
+	if ran {
+		t.Error("Expected subtask not to run after cancellation")
+	}
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+
+	g, ctx = NewGroup(context.Background())
+	g.Wait()
+	if ctx.Err() == nil {
+		t.Error("Expected context to be cancelled when Wait returns")
+	}
+}
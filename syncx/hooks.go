@@ -0,0 +1,61 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package syncx
+
+import "sync"
+
+// closeHooks keeps the hooks registered through OnClose and OnCloseFailure.
+// It is guarded by its own mutex, so that hooks can be registered without
+// waiting for the locker's write lock.
+type closeHooks struct {
+	mut     sync.Mutex
+	closed  bool
+	success []func()
+	failure []func(error)
+}
+
+func (ch *closeHooks) onClose(f func()) {
+	ch.mut.Lock()
+	if ch.closed {
+		ch.mut.Unlock()
+		f()
+		return
+	}
+	ch.success = append(ch.success, f)
+	ch.mut.Unlock()
+}
+
+func (ch *closeHooks) onCloseFailure(f func(error)) {
+	ch.mut.Lock()
+	defer ch.mut.Unlock()
+	if !ch.closed {
+		ch.failure = append(ch.failure, f)
+	}
+}
+
+// run calls the hooks for the outcome of a close attempt. It must be called
+// without holding the locker's write lock.
+func (ch *closeHooks) run(err error) {
+	ch.mut.Lock()
+	if ch.closed {
+		ch.mut.Unlock()
+		return
+	}
+	if err != nil {
+		failure := ch.failure
+		ch.mut.Unlock()
+		for _, f := range failure {
+			f(err)
+		}
+		return
+	}
+	ch.closed = true
+	success := ch.success
+	ch.success, ch.failure = nil, nil
+	ch.mut.Unlock()
+	for _, f := range success {
+		f()
+	}
+}
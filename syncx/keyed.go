@@ -0,0 +1,80 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package syncx
+
+import "sync"
+
+// KeyedMutex is a set of read-write mutexes, one per key. Mutexes are created
+// on demand and removed when no goroutine holds or waits for them, so a
+// KeyedMutex can be used with an unbounded key space, e.g. to serialize work
+// per user or per file.
+//
+// The zero value is ready to use. A KeyedMutex must not be copied after first
+// use.
+type KeyedMutex[K comparable] struct {
+	mut   sync.Mutex
+	locks map[K]*keyedLock
+}
+
+type keyedLock struct {
+	mut  sync.RWMutex
+	refs int
+}
+
+func (km *KeyedMutex[K]) acquire(key K) *keyedLock {
+	km.mut.Lock()
+	defer km.mut.Unlock()
+	if km.locks == nil {
+		km.locks = make(map[K]*keyedLock)
+	}
+	kl, ok := km.locks[key]
+	if !ok {
+		kl = &keyedLock{}
+		km.locks[key] = kl
+	}
+	kl.refs++
+	return kl
+}
+
+func (km *KeyedMutex[K]) release(key K) *keyedLock {
+	km.mut.Lock()
+	defer km.mut.Unlock()
+	kl, ok := km.locks[key]
+	if !ok {
+		panic("syncx: unlock of unlocked key")
+	}
+	kl.refs--
+	if kl.refs == 0 {
+		delete(km.locks, key)
+	}
+	return kl
+}
+
+// Lock acquires the write lock for key.
+func (km *KeyedMutex[K]) Lock(key K) {
+	km.acquire(key).mut.Lock()
+}
+
+// Unlock releases the write lock for key.
+func (km *KeyedMutex[K]) Unlock(key K) {
+	km.release(key).mut.Unlock()
+}
+
+// RLock acquires a read lock for key.
+func (km *KeyedMutex[K]) RLock(key K) {
+	km.acquire(key).mut.RLock()
+}
+
+// RUnlock releases a read lock for key.
+func (km *KeyedMutex[K]) RUnlock(key K) {
+	km.release(key).mut.RUnlock()
+}
+
+// Len returns the number of keys currently held or waited for.
+func (km *KeyedMutex[K]) Len() int {
+	km.mut.Lock()
+	defer km.mut.Unlock()
+	return len(km.locks)
+}
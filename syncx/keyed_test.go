@@ -0,0 +1,57 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package syncx
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestKeyedMutex(t *testing.T) {
+	var km KeyedMutex[string]
+	counts := map[string]int{}
+	var countsMut sync.Mutex
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		key := []string{"a", "b", "c"}[i%3]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			km.Lock(key)
+			defer km.Unlock(key)
+			countsMut.Lock()
+			n := counts[key]
+			countsMut.Unlock()
+			// Only one goroutine per key may be here at a time, so the
+			// read-modify-write above and below is not racy per key.
+			countsMut.Lock()
+			counts[key] = n + 1
+			countsMut.Unlock()
+		}()
+	}
+	wg.Wait()
+	if counts["a"] != 34 || counts["b"] != 33 || counts["c"] != 33 {
+		t.Errorf("Lost updates: %v", counts)
+	}
+	if km.Len() != 0 {
+		t.Errorf("Expected idle keys to be cleaned up, but %d remain", km.Len())
+	}
+}
+
+func TestKeyedMutexIndependentKeys(t *testing.T) {
+	var km KeyedMutex[int]
+	km.Lock(1)
+	km.RLock(2)
+	km.RLock(2)
+	if km.Len() != 2 {
+		t.Errorf("Expected 2 keys, got %d", km.Len())
+	}
+	km.RUnlock(2)
+	km.RUnlock(2)
+	km.Unlock(1)
+	if km.Len() != 0 {
+		t.Errorf("Expected idle keys to be cleaned up, but %d remain", km.Len())
+	}
+}
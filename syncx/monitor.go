@@ -0,0 +1,470 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package syncx
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// LockStats is a snapshot of the contention on a monitored locker.
+type LockStats struct {
+	// Name is the name the locker was registered with.
+	Name string `json:"name"`
+	// Readers is the number of read lock holders.
+	Readers int `json:"readers"`
+	// Writer is true if the write lock is held through Lock.
+	Writer bool `json:"writer"`
+	// WaitingReaders and WaitingWriters are the number of goroutines waiting for
+	// a read or write lock. Close, CloseWait, Suspend and Resume acquire the
+	// write lock internally, and are counted as waiting writers until they
+	// return.
+	WaitingReaders int `json:"waiting_readers"`
+	WaitingWriters int `json:"waiting_writers"`
+	// LongestWait is how long the longest current waiter has waited.
+	LongestWait time.Duration `json:"longest_wait"`
+	// MaxWait is the longest wait observed since the locker was registered.
+	MaxWait time.Duration `json:"max_wait"`
+	// TotalWait is the summed time spent waiting for the locker.
+	TotalWait time.Duration `json:"total_wait"`
+	// Acquisitions is the number of times a read or write lock was acquired.
+	Acquisitions uint64 `json:"acquisitions"`
+	// MaxHold is the longest completed hold observed since the locker was
+	// registered. For read locks, a hold lasts as long as at least one reader
+	// holds the read lock, as that is what writers have to wait for.
+	MaxHold time.Duration `json:"max_hold"`
+	// TotalHold is the summed duration of completed holds.
+	TotalHold time.Duration `json:"total_hold"`
+}
+
+// LongHold describes a lock which has been held longer than the hold
+// threshold of a LockMonitor.
+type LongHold struct {
+	// Name is the name the locker was registered with.
+	Name string
+	// Write is true if the write lock is held, and false if the read lock is.
+	Write bool
+	// Held is how long the lock has been held.
+	Held time.Duration
+	// Stack is the stack trace of the goroutine which acquired the lock, if
+	// LockMonitorOpts.Stacks is set. For read locks, it is the stack of the
+	// first reader.
+	Stack []byte
+}
+
+// LockMonitorOpts are options that can be passed to NewLockMonitorWithOpts.
+type LockMonitorOpts struct {
+	// HoldThreshold is the duration a lock may be held before OnLongHold is
+	// called. If zero, long holds are not reported.
+	HoldThreshold time.Duration
+	// OnLongHold is called once per hold that exceeds HoldThreshold, while the
+	// lock is still held. It is called on its own goroutine.
+	OnLongHold func(LongHold)
+	// Stacks makes the monitor capture the stack trace of every goroutine
+	// acquiring a lock, so that OnLongHold can report who holds it. This is
+	// expensive, and only done if HoldThreshold and OnLongHold are set.
+	Stacks bool
+}
+
+// LockMonitor tracks contention on a set of named lockers, to diagnose live
+// systems where a lock appears stuck. Lockers are registered by wrapping them
+// with MonitorCloseLocker or MonitorSuspendLocker, and the wrapped locker must
+// be used in place of the original.
+//
+// Monitoring adds some overhead to every lock operation, so it is typically
+// only enabled for lockers suspected of contention.
+type LockMonitor struct {
+	mut     sync.Mutex
+	lockers map[string]*lockCounter
+	opts    LockMonitorOpts
+}
+
+// NewLockMonitor returns a new, empty LockMonitor.
+func NewLockMonitor() *LockMonitor {
+	return NewLockMonitorWithOpts(nil)
+}
+
+// NewLockMonitorWithOpts returns a new, empty LockMonitor with the provided
+// options. If opts is nil, the default options are used.
+func NewLockMonitorWithOpts(opts *LockMonitorOpts) *LockMonitor {
+	m := &LockMonitor{lockers: make(map[string]*lockCounter)}
+	if opts != nil {
+		m.opts = *opts
+	}
+	if m.opts.HoldThreshold <= 0 {
+		m.opts.OnLongHold = nil
+	}
+	return m
+}
+
+func (m *LockMonitor) add(name string) *lockCounter {
+	lc := &lockCounter{name: name, opts: &m.opts, waits: make(map[uint64]time.Time)}
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	m.lockers[name] = lc
+	return lc
+}
+
+// MonitorCloseLocker registers cl under name, replacing any locker previously
+// registered under that name, and returns a monitored CloseLocker wrapping cl.
+//
+// The monitored locker implements TryLocker and CloseWaiter on top of cl. If
+// cl does not implement them, TryLock and TryRLock always fail, and CloseWait
+// returns errors.ErrUnsupported. The other optional interfaces of cl are not
+// monitored, and are available through the Unwrap method of the monitored
+// locker.
+func (m *LockMonitor) MonitorCloseLocker(name string, cl CloseLocker) CloseLocker {
+	return &monitoredCloseLocker{CloseLocker: cl, lc: m.add(name)}
+}
+
+// MonitorSuspendLocker registers sl under name, replacing any locker previously
+// registered under that name, and returns a monitored SuspendLocker wrapping sl.
+//
+// The monitored locker implements ContextRLocker and CapacityLocker on top of
+// sl. If sl does not implement them, RLockContext and RLockN return
+// errors.ErrUnsupported. The other optional interfaces of sl are not
+// monitored, and are available through the Unwrap method of the monitored
+// locker.
+func (m *LockMonitor) MonitorSuspendLocker(name string, sl SuspendLocker) SuspendLocker {
+	return &monitoredSuspendLocker{SuspendLocker: sl, lc: m.add(name)}
+}
+
+// Remove unregisters the locker registered under name. The monitored locker
+// can still be used after it has been removed.
+func (m *LockMonitor) Remove(name string) {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	delete(m.lockers, name)
+}
+
+// Stats returns the contention statistics of all registered lockers, sorted by
+// name.
+func (m *LockMonitor) Stats() []LockStats {
+	m.mut.Lock()
+	stats := make([]LockStats, 0, len(m.lockers))
+	for name, lc := range m.lockers {
+		s := lc.stats()
+		s.Name = name
+		stats = append(stats, s)
+	}
+	m.mut.Unlock()
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Name < stats[j].Name })
+	return stats
+}
+
+type lockCounter struct {
+	mut            sync.Mutex
+	name           string
+	opts           *LockMonitorOpts
+	next           uint64
+	waits          map[uint64]time.Time
+	readers        int
+	writer         bool
+	waitingReaders int
+	waitingWriters int
+	maxWait        time.Duration
+	totalWait      time.Duration
+	acquisitions   uint64
+	maxHold        time.Duration
+	totalHold      time.Duration
+	write          holdTracker
+	read           holdTracker
+}
+
+// holdTracker tracks an ongoing hold of the read or write lock.
+type holdTracker struct {
+	since time.Time
+	timer *time.Timer
+}
+
+// wait registers a waiter, and returns its id.
+func (lc *lockCounter) wait(write bool) uint64 {
+	lc.mut.Lock()
+	defer lc.mut.Unlock()
+	id := lc.next
+	lc.next++
+	lc.waits[id] = time.Now()
+	if write {
+		lc.waitingWriters++
+	} else {
+		lc.waitingReaders++
+	}
+	return id
+}
+
+// acquired ends the wait id, and marks the lock as held if held is true.
+func (lc *lockCounter) acquired(id uint64, write, held bool) {
+	var stack []byte
+	if held {
+		stack = lc.stack()
+	}
+	lc.mut.Lock()
+	defer lc.mut.Unlock()
+	d := time.Since(lc.waits[id])
+	if d > lc.maxWait {
+		lc.maxWait = d
+	}
+	lc.totalWait += d
+	delete(lc.waits, id)
+	if write {
+		lc.waitingWriters--
+	} else {
+		lc.waitingReaders--
+	}
+	if held {
+		lc.hold(write, stack)
+	}
+}
+
+// tried marks the lock as held after a successful non-blocking acquire.
+func (lc *lockCounter) tried(write bool) {
+	stack := lc.stack()
+	lc.mut.Lock()
+	defer lc.mut.Unlock()
+	lc.hold(write, stack)
+}
+
+// stack returns the stack of the calling goroutine if stacks are captured.
+func (lc *lockCounter) stack() []byte {
+	if !lc.opts.Stacks || lc.opts.OnLongHold == nil {
+		return nil
+	}
+	return callerStack()
+}
+
+// hold marks the lock as held. Must be called while holding the mutex.
+func (lc *lockCounter) hold(write bool, stack []byte) {
+	lc.acquisitions++
+	if write {
+		lc.writer = true
+		lc.startHold(&lc.write, true, stack)
+		return
+	}
+	lc.readers++
+	if lc.readers == 1 {
+		lc.startHold(&lc.read, false, stack)
+	}
+}
+
+// startHold starts tracking a hold. Must be called while holding the mutex.
+func (lc *lockCounter) startHold(ht *holdTracker, write bool, stack []byte) {
+	ht.since = time.Now()
+	if lc.opts.OnLongHold == nil {
+		return
+	}
+	since := ht.since
+	ht.timer = time.AfterFunc(lc.opts.HoldThreshold, func() {
+		lc.opts.OnLongHold(LongHold{
+			Name:  lc.name,
+			Write: write,
+			Held:  time.Since(since),
+			Stack: stack,
+		})
+	})
+}
+
+// endHold stops tracking a hold. Must be called while holding the mutex.
+func (lc *lockCounter) endHold(ht *holdTracker) {
+	if ht.timer != nil {
+		ht.timer.Stop()
+		ht.timer = nil
+	}
+	d := time.Since(ht.since)
+	if d > lc.maxHold {
+		lc.maxHold = d
+	}
+	lc.totalHold += d
+}
+
+func (lc *lockCounter) released(write bool) {
+	lc.mut.Lock()
+	defer lc.mut.Unlock()
+	if write {
+		lc.writer = false
+		lc.endHold(&lc.write)
+		return
+	}
+	lc.readers--
+	if lc.readers == 0 {
+		lc.endHold(&lc.read)
+	}
+}
+
+// blocking tracks a call which acquires and releases the write lock
+// internally.
+func (lc *lockCounter) blocking(f func() error) error {
+	id := lc.wait(true)
+	defer lc.acquired(id, true, false)
+	return f()
+}
+
+func (lc *lockCounter) stats() LockStats {
+	lc.mut.Lock()
+	defer lc.mut.Unlock()
+	s := LockStats{
+		Readers:        lc.readers,
+		Writer:         lc.writer,
+		WaitingReaders: lc.waitingReaders,
+		WaitingWriters: lc.waitingWriters,
+		MaxWait:        lc.maxWait,
+		TotalWait:      lc.totalWait,
+		Acquisitions:   lc.acquisitions,
+		MaxHold:        lc.maxHold,
+		TotalHold:      lc.totalHold,
+	}
+	for _, start := range lc.waits {
+		if d := time.Since(start); d > s.LongestWait {
+			s.LongestWait = d
+		}
+	}
+	return s
+}
+
+type monitoredCloseLocker struct {
+	CloseLocker
+	lc *lockCounter
+}
+
+func (mcl *monitoredCloseLocker) Close() error {
+	return mcl.lc.blocking(mcl.CloseLocker.Close)
+}
+
+// Unwrap returns the wrapped locker.
+func (mcl *monitoredCloseLocker) Unwrap() CloseLocker {
+	return mcl.CloseLocker
+}
+
+func (mcl *monitoredCloseLocker) CloseWait(ctx context.Context) (int, error) {
+	cw, ok := mcl.CloseLocker.(CloseWaiter)
+	if !ok {
+		return 0, errors.ErrUnsupported
+	}
+	id := mcl.lc.wait(true)
+	defer mcl.lc.acquired(id, true, false)
+	return cw.CloseWait(ctx)
+}
+
+func (mcl *monitoredCloseLocker) Lock() {
+	id := mcl.lc.wait(true)
+	mcl.CloseLocker.Lock()
+	mcl.lc.acquired(id, true, true)
+}
+
+func (mcl *monitoredCloseLocker) Unlock() {
+	mcl.lc.released(true)
+	mcl.CloseLocker.Unlock()
+}
+
+func (mcl *monitoredCloseLocker) RLock() error {
+	id := mcl.lc.wait(false)
+	err := mcl.CloseLocker.RLock()
+	mcl.lc.acquired(id, false, err == nil)
+	return err
+}
+
+func (mcl *monitoredCloseLocker) RUnlock() {
+	mcl.lc.released(false)
+	mcl.CloseLocker.RUnlock()
+}
+
+func (mcl *monitoredCloseLocker) TryLock() bool {
+	tl, ok := mcl.CloseLocker.(TryLocker)
+	if !ok {
+		return false
+	}
+	ok = tl.TryLock()
+	if ok {
+		mcl.lc.tried(true)
+	}
+	return ok
+}
+
+func (mcl *monitoredCloseLocker) TryRLock() (bool, error) {
+	tl, ok := mcl.CloseLocker.(TryLocker)
+	if !ok {
+		return false, nil
+	}
+	ok, err := tl.TryRLock()
+	if ok {
+		mcl.lc.tried(false)
+	}
+	return ok, err
+}
+
+type monitoredSuspendLocker struct {
+	SuspendLocker
+	lc *lockCounter
+}
+
+// Unwrap returns the wrapped locker.
+func (msl *monitoredSuspendLocker) Unwrap() SuspendLocker {
+	return msl.SuspendLocker
+}
+
+func (msl *monitoredSuspendLocker) Close() error {
+	return msl.lc.blocking(msl.SuspendLocker.Close)
+}
+
+func (msl *monitoredSuspendLocker) Suspend() error {
+	return msl.lc.blocking(msl.SuspendLocker.Suspend)
+}
+
+func (msl *monitoredSuspendLocker) Resume() error {
+	return msl.lc.blocking(msl.SuspendLocker.Resume)
+}
+
+func (msl *monitoredSuspendLocker) Lock() {
+	id := msl.lc.wait(true)
+	msl.SuspendLocker.Lock()
+	msl.lc.acquired(id, true, true)
+}
+
+func (msl *monitoredSuspendLocker) Unlock() {
+	msl.lc.released(true)
+	msl.SuspendLocker.Unlock()
+}
+
+func (msl *monitoredSuspendLocker) RLock() error {
+	id := msl.lc.wait(false)
+	err := msl.SuspendLocker.RLock()
+	msl.lc.acquired(id, false, err == nil)
+	return err
+}
+
+func (msl *monitoredSuspendLocker) RUnlock() {
+	msl.lc.released(false)
+	msl.SuspendLocker.RUnlock()
+}
+
+func (msl *monitoredSuspendLocker) RLockContext(ctx context.Context) error {
+	cl, ok := msl.SuspendLocker.(ContextRLocker)
+	if !ok {
+		return errors.ErrUnsupported
+	}
+	id := msl.lc.wait(false)
+	err := cl.RLockContext(ctx)
+	msl.lc.acquired(id, false, err == nil)
+	return err
+}
+
+func (msl *monitoredSuspendLocker) RLockN(ctx context.Context, n int64) error {
+	cl, ok := msl.SuspendLocker.(CapacityLocker)
+	if !ok {
+		return errors.ErrUnsupported
+	}
+	id := msl.lc.wait(false)
+	err := cl.RLockN(ctx, n)
+	msl.lc.acquired(id, false, err == nil)
+	return err
+}
+
+func (msl *monitoredSuspendLocker) RUnlockN(n int64) {
+	msl.lc.released(false)
+	// RLockN only succeeds if the wrapped locker is a CapacityLocker.
+	msl.SuspendLocker.(CapacityLocker).RUnlockN(n)
+}
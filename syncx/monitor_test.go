@@ -0,0 +1,113 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package syncx
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLockMonitor(t *testing.T) {
+	m := NewLockMonitor()
+	cl := m.MonitorCloseLocker("file", testCloseLocker(&dummyCloser{}))
+
+	if err := cl.RLock(); err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		cl.Lock()
+		cl.Unlock()
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	stats := m.Stats()
+	if len(stats) != 1 || stats[0].Name != "file" {
+		t.Fatalf("Unexpected stats: %+v", stats)
+	}
+	s := stats[0]
+	if s.Readers != 1 || s.Writer || s.WaitingWriters != 1 || s.LongestWait < 10*time.Millisecond {
+		t.Fatalf("Expected one reader and one waiting writer, but got %+v", s)
+	}
+
+	cl.RUnlock()
+	time.Sleep(10 * time.Millisecond)
+	s = m.Stats()[0]
+	if s.Readers != 0 || s.WaitingWriters != 0 || s.LongestWait != 0 || s.MaxWait < 20*time.Millisecond {
+		t.Fatalf("Expected no contention after release, but got %+v", s)
+	}
+
+	m.Remove("file")
+	if len(m.Stats()) != 0 {
+		t.Fatal("Expected locker to be removed")
+	}
+}
+
+func TestLockMonitorLongHold(t *testing.T) {
+	holds := make(chan LongHold, 1)
+	m := NewLockMonitorWithOpts(&LockMonitorOpts{
+		HoldThreshold: 10 * time.Millisecond,
+		OnLongHold:    func(h LongHold) { holds <- h },
+		Stacks:        true,
+	})
+	sl := m.MonitorSuspendLocker("conn", testSuspendLocker(&dummySuspender{}, nil))
+
+	sl.Lock()
+	sl.Unlock()
+	sl.Lock()
+	select {
+	case h := <-holds:
+		if h.Name != "conn" || !h.Write || h.Held < 10*time.Millisecond {
+			t.Errorf("Unexpected long hold %+v", h)
+		}
+		if !strings.Contains(string(h.Stack), "TestLockMonitorLongHold") {
+			t.Errorf("Expected stack of the lock holder, got %s", h.Stack)
+		}
+	case <-time.After(1 * time.Second):
+		t.Fatal("Expected long hold to be reported")
+	}
+	sl.Unlock()
+
+	if err := sl.RLock(); err != nil {
+		t.Fatal(err)
+	}
+	sl.RUnlock()
+	s := m.Stats()[0]
+	if s.Acquisitions != 3 || s.MaxHold < 10*time.Millisecond || s.TotalHold < s.MaxHold {
+		t.Fatalf("Unexpected hold stats %+v", s)
+	}
+	select {
+	case h := <-holds:
+		t.Fatalf("Expected short holds not to be reported, got %+v", h)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+func TestLockMonitorOptionalInterfaces(t *testing.T) {
+	m := NewLockMonitor()
+	// Embedding hides the optional methods, like a CloseLocker implemented
+	// outside of this package.
+	bare := m.MonitorCloseLocker("bare", struct{ CloseLocker }{NewCloseLocker(&dummyCloser{})})
+	if bare.(TryLocker).TryLock() {
+		t.Fatal("Expected TryLock to fail on a locker without TryLock")
+	}
+	if _, err := bare.(CloseWaiter).CloseWait(context.Background()); err != errors.ErrUnsupported {
+		t.Fatalf("Expected ErrUnsupported, got %v", err)
+	}
+
+	cl := m.MonitorCloseLocker("full", NewCloseLocker(&dummyCloser{}))
+	if !cl.(TryLocker).TryLock() {
+		t.Fatal("Expected TryLock to succeed on an unlocked locker")
+	}
+	cl.Unlock()
+	if _, ok := cl.(interface{ Unwrap() CloseLocker }).Unwrap().(ReaderEvicter); !ok {
+		t.Fatal("Expected the unwrapped locker to be a ReaderEvicter")
+	}
+	if s := m.Stats()[1]; s.Name != "full" || s.Acquisitions != 1 {
+		t.Fatalf("Expected TryLock to be monitored, got %+v", s)
+	}
+}
@@ -0,0 +1,50 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package syncx
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// OnceSuccess is like sync.Once, except that a failed call does not count:
+// Do keeps calling its function until it succeeds once, and never calls it
+// again afterwards. This is typically used for lazy initialisation that may
+// fail, like setting up a connection.
+//
+// The zero value is ready to use. An OnceSuccess must not be copied after first
+// use.
+type OnceSuccess struct {
+	done atomic.Bool
+	mut  sync.Mutex
+}
+
+// Do calls f if no previous call to Do has succeeded, and returns its error.
+// If a previous call succeeded, Do returns nil without calling f. Concurrent
+// calls are serialised, so f is never run concurrently with itself, and calls
+// waiting on a successful call return nil without calling f.
+//
+// Like with sync.Once, f must not call Do on the same OnceSuccess, as that
+// deadlocks. If f panics, Do considers the call failed.
+func (o *OnceSuccess) Do(f func() error) error {
+	if o.done.Load() {
+		return nil
+	}
+	o.mut.Lock()
+	defer o.mut.Unlock()
+	if o.done.Load() {
+		return nil
+	}
+	err := f()
+	if err == nil {
+		o.done.Store(true)
+	}
+	return err
+}
+
+// Done returns true if a call to Do has succeeded.
+func (o *OnceSuccess) Done() bool {
+	return o.done.Load()
+}
@@ -0,0 +1,46 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package syncx
+
+import (
+	"errors"
+	"sync"
+	"testing"
+)
+
+func TestOnceSuccess(t *testing.T) {
+	var once OnceSuccess
+	errFailed := errors.New("failed")
+	calls := 0
+	for i := 0; i < 3; i++ {
+		err := once.Do(func() error {
+			calls++
+			return errFailed
+		})
+		if err != errFailed {
+			t.Fatalf("Expected failed call to return its error, got %v", err)
+		}
+	}
+	if once.Done() {
+		t.Fatal("Expected OnceSuccess not to be done after failures")
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := once.Do(func() error { calls++; return nil }); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if calls != 4 {
+		t.Fatalf("Expected 3 failed calls and one successful call, got %d calls", calls)
+	}
+	if !once.Done() {
+		t.Fatal("Expected OnceSuccess to be done after a success")
+	}
+}
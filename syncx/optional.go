@@ -0,0 +1,132 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package syncx
+
+import (
+	"context"
+	"time"
+)
+
+// The interfaces in this file are optional capabilities of CloseLockers and
+// SuspendLockers. The lockers from this package implement them, but other
+// implementations don't have to: Check for them with a type assertion.
+
+// TryLocker is implemented by lockers which can be locked without blocking.
+type TryLocker interface {
+	// TryLock tries to acquire the write lock without blocking, and reports
+	// whether it succeeded.
+	TryLock() bool
+	// TryRLock tries to acquire a read lock without blocking. It returns true if
+	// the read lock was acquired, and false if acquiring it would block. If the
+	// resource is closed, it returns false along with an error.
+	TryRLock() (bool, error)
+}
+
+// ReaderEvicter is implemented by lockers which can ask their readers to
+// release the read lock.
+type ReaderEvicter interface {
+	// EvictReaders asks the current read lock holders to finish quickly,
+	// typically ahead of a Suspend or Close. Readers observe the eviction through
+	// ReaderContext. The eviction lasts until the write lock is next acquired, so
+	// readers acquiring the read lock in the meantime are also evicted.
+	EvictReaders(reason error)
+	// ReaderContext returns a context for read lock holders, which is cancelled
+	// with reason as its cause when EvictReaders is called. Call it after the
+	// read lock has been acquired.
+	ReaderContext() context.Context
+}
+
+// CloseNotifier is implemented by lockers which can notify others when their
+// resource is closed.
+type CloseNotifier interface {
+	// OnClose registers f to be called exactly once, after the resource has been
+	// closed successfully. If the resource is already closed, f is called
+	// immediately. Hooks are called in registration order on the goroutine
+	// calling Close, after the write lock has been released.
+	OnClose(f func())
+	// OnCloseFailure registers f to be called with the error of every failed
+	// attempt to close the resource, until the resource has been closed
+	// successfully. Hooks are called like OnClose hooks.
+	OnCloseFailure(f func(err error))
+}
+
+// CloseWaiter is implemented by lockers which can give up closing their
+// resource.
+type CloseWaiter interface {
+	// CloseWait is like Close, but gives up waiting for the outstanding read
+	// locks to be released when ctx is done. It then returns the number of
+	// readers still holding the read lock along with ctx.Err(), and leaves the
+	// resource open. Unlike Close, CloseWait does not block new readers while
+	// waiting, so a steady stream of readers may keep it from closing.
+	CloseWait(ctx context.Context) (int, error)
+}
+
+// SuspendInspector is implemented by SuspendLockers which expose the state and
+// usage of their resource.
+type SuspendInspector interface {
+	// LastUsed returns the last time a lock was acquired on this locker, or the
+	// zero time if it has never been locked.
+	LastUsed() time.Time
+	// SuspendCount returns the number of times the resource has been suspended.
+	SuspendCount() uint64
+	// ResumeCount returns the number of times the resource has been resumed.
+	ResumeCount() uint64
+	// State returns the current state of the resource. It does not wait for the
+	// write lock, so the state may change right after it is returned.
+	State() SuspendState
+}
+
+// Warmer is implemented by SuspendLockers which can resume their resource
+// ahead of time.
+type Warmer interface {
+	// NeedsResume reports whether the next RLock would have to resume the
+	// resource. Like State, the answer may change right after it is returned.
+	NeedsResume() bool
+	// Warm resumes the resource ahead of anticipated load, so that the first
+	// RLock does not pay the resume latency. If ctx is done before the resume
+	// has finished, Warm returns ctx.Err() and the resume continues in the
+	// background, unless the resource is an iox.ContextSuspender: The resume is
+	// then bounded by ctx through ResumeContext.
+	Warm(ctx context.Context) error
+}
+
+// ContextRLocker is implemented by SuspendLockers which can bound the wait for
+// a read lock by a context.
+type ContextRLocker interface {
+	// RLockContext is like RLock, but gives up when ctx is done, returning
+	// ctx.Err() without acquiring the read lock. This bounds the time spent
+	// waiting for the lock and for the implicit resume of a cold resource. A
+	// resume which has already started continues in the background, unless
+	// the resource is an iox.ContextSuspender, in which case ctx is passed on
+	// to ResumeContext.
+	RLockContext(ctx context.Context) error
+}
+
+// CapacityLocker is implemented by SuspendLockers which let readers declare a
+// capacity cost, as set by SuspendLockerOpts.Capacity.
+type CapacityLocker interface {
+	// RLockN is like RLock, but the reader declares a capacity cost of n. If the
+	// locker was created with a Capacity, RLockN first waits until the summed
+	// cost of the readers holding the read lock through RLockN leaves room for
+	// n, in FIFO order. It returns ctx.Err() if ctx is done before that, and
+	// ErrCapacityExceeded if n exceeds the capacity itself. Read locks acquired
+	// through RLock have no cost. Release the lock with RUnlockN(n).
+	RLockN(ctx context.Context, n int64) error
+	// RUnlockN releases a read lock acquired through RLockN with cost n.
+	RUnlockN(n int64)
+}
+
+// Leaser is implemented by SuspendLockers which suspend their resource
+// automatically when it is idle, as the ones created with a MaxIdleTime do.
+type Leaser interface {
+	// NextSuspendAt returns the time the resource will be suspended if it stays
+	// idle, or the zero time if it is not resumed.
+	NextSuspendAt() time.Time
+	// Extend keeps the resource from being suspended automatically for at least
+	// d, like a lease. Use it for long-running operations that do not hold a
+	// lock between steps, such as paginated exports. Extend does not resume a
+	// suspended resource.
+	Extend(d time.Duration)
+}
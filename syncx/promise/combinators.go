@@ -0,0 +1,127 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package promise
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrNoPromises is returned by Race and Any when they are given no promises.
+var ErrNoPromises = errors.New("no promises to wait for")
+
+// outcome is the outcome of the promise at index i.
+type outcome struct {
+	i   int
+	val interface{}
+	err error
+}
+
+// collect observes ps, and returns a channel receiving their outcomes as they
+// are delivered. The channel is buffered, so observers never block.
+func collect(ps []*Promise) <-chan outcome {
+	outcomes := make(chan outcome, len(ps))
+	for i, p := range ps {
+		i := i
+		p.Observe(func(val interface{}, err error) {
+			outcomes <- outcome{i: i, val: val, err: err}
+		})
+	}
+	return outcomes
+}
+
+// All waits for every promise in ps to be delivered, and returns their values
+// in the same order as ps. If a promise is delivered with an error, All returns
+// that error right away without waiting for the rest. If ctx is done first, All
+// returns ctx.Err().
+func All(ctx context.Context, ps ...*Promise) ([]interface{}, error) {
+	vals := make([]interface{}, len(ps))
+	outcomes := collect(ps)
+	for range ps {
+		select {
+		case o := <-outcomes:
+			if o.err != nil {
+				return nil, o.err
+			}
+			vals[o.i] = o.val
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	return vals, nil
+}
+
+// Result is the value and error a promise was delivered with.
+type Result struct {
+	Val interface{}
+	Err error
+}
+
+// AllSettled waits for every promise in ps to be delivered, and returns their
+// results in the same order as ps. Unlike All, errors do not make AllSettled
+// return early. If ctx is done first, AllSettled returns ctx.Err() along with
+// the results, where the promises not yet delivered have ctx.Err() as their
+// error.
+func AllSettled(ctx context.Context, ps ...*Promise) ([]Result, error) {
+	results := make([]Result, len(ps))
+	settled := make([]bool, len(ps))
+	outcomes := collect(ps)
+	for range ps {
+		select {
+		case o := <-outcomes:
+			results[o.i] = Result{Val: o.val, Err: o.err}
+			settled[o.i] = true
+		case <-ctx.Done():
+			for i := range results {
+				if !settled[i] {
+					results[i].Err = ctx.Err()
+				}
+			}
+			return results, ctx.Err()
+		}
+	}
+	return results, nil
+}
+
+// Race waits for the first promise in ps to be delivered, and returns its index
+// along with its value and error. If ctx is done first, Race returns -1 and
+// ctx.Err(). If ps is empty, Race returns -1 and ErrNoPromises right away.
+func Race(ctx context.Context, ps ...*Promise) (int, interface{}, error) {
+	if len(ps) == 0 {
+		return -1, nil, ErrNoPromises
+	}
+	select {
+	case o := <-collect(ps):
+		return o.i, o.val, o.err
+	case <-ctx.Done():
+		return -1, nil, ctx.Err()
+	}
+}
+
+// Any waits for the first promise in ps to be delivered with a value, and
+// returns its index and value. Promises delivered with an error are skipped.
+// This is typically used for hedged requests across replicas. If all promises
+// fail, Any returns -1 and the error of the last one to fail. If ctx is done
+// first, Any returns -1 and ctx.Err(). If ps is empty, Any returns -1 and
+// ErrNoPromises right away.
+func Any(ctx context.Context, ps ...*Promise) (int, interface{}, error) {
+	if len(ps) == 0 {
+		return -1, nil, ErrNoPromises
+	}
+	outcomes := collect(ps)
+	var err error
+	for range ps {
+		select {
+		case o := <-outcomes:
+			if o.err == nil {
+				return o.i, o.val, nil
+			}
+			err = o.err
+		case <-ctx.Done():
+			return -1, nil, ctx.Err()
+		}
+	}
+	return -1, nil, err
+}
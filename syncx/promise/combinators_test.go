@@ -0,0 +1,111 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package promise
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestAll(t *testing.T) {
+	ps := []*Promise{New(), New(), New()}
+	go func() {
+		for i := len(ps) - 1; i >= 0; i-- {
+			ps[i].Deliver(i)
+		}
+	}()
+	vals, err := All(context.Background(), ps...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(vals, []interface{}{0, 1, 2}) {
+		t.Fatalf("Expected values in promise order, got %v", vals)
+	}
+
+	errFailed := errors.New("failed")
+	failing := []*Promise{New(), New()}
+	failing[1].DeliverError(errFailed)
+	if _, err := All(context.Background(), failing...); err != errFailed {
+		t.Fatalf("Expected All to fail fast with %v, got %v", errFailed, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := All(ctx, New()); err != context.DeadlineExceeded {
+		t.Fatalf("Expected DeadlineExceeded, got %v", err)
+	}
+}
+
+func TestAllSettled(t *testing.T) {
+	errFailed := errors.New("failed")
+	ps := []*Promise{New(), New(), New()}
+	ps[0].Deliver(0)
+	ps[1].DeliverError(errFailed)
+	ps[2].Deliver(2)
+	results, err := AllSettled(context.Background(), ps...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Result{{Val: 0}, {Err: errFailed}, {Val: 2}}
+	if !reflect.DeepEqual(results, expected) {
+		t.Fatalf("Expected %v, got %v", expected, results)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	results, err = AllSettled(ctx, ps[0], New())
+	if err != context.DeadlineExceeded {
+		t.Fatalf("Expected DeadlineExceeded, got %v", err)
+	}
+	expected = []Result{{Val: 0}, {Err: context.DeadlineExceeded}}
+	if !reflect.DeepEqual(results, expected) {
+		t.Fatalf("Expected partial results %v, got %v", expected, results)
+	}
+}
+
+func TestRace(t *testing.T) {
+	ps := []*Promise{New(), New(), New()}
+	errFailed := errors.New("failed")
+	ps[1].DeliverError(errFailed)
+	if i, _, err := Race(context.Background(), ps...); i != 1 || err != errFailed {
+		t.Fatalf("Expected the failed promise to win the race, got (%d, %v)", i, err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if i, _, err := Race(ctx, New()); i != -1 || err != context.DeadlineExceeded {
+		t.Fatalf("Expected (-1, DeadlineExceeded), got (%d, %v)", i, err)
+	}
+	if i, _, err := Race(context.Background()); i != -1 || err != ErrNoPromises {
+		t.Fatalf("Expected (-1, ErrNoPromises) without promises, got (%d, %v)", i, err)
+	}
+}
+
+func TestAny(t *testing.T) {
+	ps := []*Promise{New(), New(), New()}
+	errFailed := errors.New("failed")
+	ps[1].DeliverError(errFailed)
+	go func() {
+		time.Sleep(5 * time.Millisecond)
+		ps[2].Deliver("replica 2")
+	}()
+	i, val, err := Any(context.Background(), ps...)
+	if i != 2 || val != "replica 2" || err != nil {
+		t.Fatalf("Expected the first successful promise to win, got (%d, %v, %v)", i, val, err)
+	}
+
+	failing := []*Promise{New(), New()}
+	failing[0].DeliverError(errors.New("first"))
+	failing[1].DeliverError(errFailed)
+	time.Sleep(time.Millisecond)
+	if i, _, err := Any(context.Background(), failing...); i != -1 || err == nil {
+		t.Fatalf("Expected Any to fail when all promises fail, got (%d, %v)", i, err)
+	}
+	if i, _, err := Any(context.Background()); i != -1 || err != ErrNoPromises {
+		t.Fatalf("Expected (-1, ErrNoPromises) without promises, got (%d, %v)", i, err)
+	}
+}
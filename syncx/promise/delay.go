@@ -0,0 +1,54 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package promise
+
+import (
+	"context"
+	"sync"
+)
+
+// Delay is a value computed lazily, at most once, the first time it is needed.
+// It is the sibling of Clojure's promise: Where a promise is delivered by
+// someone else, a delay knows how to compute its own value.
+type Delay struct {
+	once sync.Once
+	f    func() (interface{}, error)
+	p    *Promise
+}
+
+// NewDelay creates a delay computing its value with f. f is not called until
+// the value is requested through Force or Get.
+func NewDelay(f func() (interface{}, error)) *Delay {
+	return &Delay{f: f, p: New()}
+}
+
+func (d *Delay) compute(context.Context) (interface{}, error) {
+	return d.f()
+}
+
+// Force computes the value of the delay on the calling goroutine if it has not
+// been computed yet, and returns the memoized value and error. Concurrent calls
+// wait for the first one to finish. If f panics, the error is a *PanicError.
+func (d *Delay) Force() (interface{}, error) {
+	d.once.Do(func() {
+		run(context.Background(), d.p, d.compute)
+	})
+	return d.p.Get(context.Background())
+}
+
+// Get is like Force, but waits at most until ctx is done. If the value has not
+// been computed yet, it is computed in a new goroutine, which carries on even if
+// ctx is done before it finishes.
+func (d *Delay) Get(ctx context.Context) (interface{}, error) {
+	d.once.Do(func() {
+		go run(context.Background(), d.p, d.compute)
+	})
+	return d.p.Get(ctx)
+}
+
+// Realized returns true if the value of the delay has been computed.
+func (d *Delay) Realized() bool {
+	return d.p.Realized()
+}
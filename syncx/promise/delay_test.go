@@ -0,0 +1,62 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package promise
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestDelay(t *testing.T) {
+	var calls atomic.Int32
+	d := NewDelay(func() (interface{}, error) {
+		calls.Add(1)
+		return 10, nil
+	})
+	if d.Realized() {
+		t.Fatal("Delay realized before it was forced")
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if val, err := d.Force(); val != 10 || err != nil {
+				t.Errorf("Expected (10, nil), got (%v, %v)", val, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if val, err := d.Get(context.Background()); val != 10 || err != nil {
+		t.Fatalf("Expected (10, nil), got (%v, %v)", val, err)
+	}
+	if n := calls.Load(); n != 1 {
+		t.Fatalf("Expected f to be called once, was called %d times", n)
+	}
+}
+
+func TestDelayError(t *testing.T) {
+	failure := errors.New("failure")
+	d := NewDelay(func() (interface{}, error) {
+		return nil, failure
+	})
+	if _, err := d.Get(context.Background()); err != failure {
+		t.Fatalf("Expected failure, got %v", err)
+	}
+	if _, err := d.Force(); err != failure {
+		t.Fatalf("Expected memoized failure, got %v", err)
+	}
+
+	panicky := NewDelay(func() (interface{}, error) {
+		panic("boom")
+	})
+	_, err := panicky.Force()
+	if perr, ok := err.(*PanicError); !ok || perr.Value != "boom" {
+		t.Fatalf("Expected a *PanicError, got %v", err)
+	}
+}
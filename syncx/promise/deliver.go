@@ -0,0 +1,75 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package promise
+
+import (
+	"sync"
+	"time"
+)
+
+// Winner describes which producer delivered the promise of a DeliverGroup.
+type Winner struct {
+	// Source is the name the winning producer delivered with.
+	Source string
+	// At is the time the promise was delivered.
+	At time.Time
+}
+
+// DeliverGroup is a promise which multiple producers race to deliver, and
+// which records which producer won. This is useful when racing different
+// sources for the same value, e.g. a cache and a database, to know which one
+// answered.
+type DeliverGroup struct {
+	p      *Promise
+	mut    sync.Mutex
+	winner Winner
+}
+
+// NewDeliverGroup creates a new DeliverGroup.
+func NewDeliverGroup() *DeliverGroup {
+	return &DeliverGroup{p: New()}
+}
+
+// Promise returns the promise delivered by the winning producer. It must only
+// be delivered through the group, or the winner is not recorded.
+func (g *DeliverGroup) Promise() *Promise {
+	return g.p
+}
+
+// Deliver delivers val on behalf of source if no other producer has delivered
+// yet, and reports whether source won.
+func (g *DeliverGroup) Deliver(source string, val interface{}) bool {
+	return g.deliver(source, val, nil)
+}
+
+// DeliverError delivers err on behalf of source if no other producer has
+// delivered yet, and reports whether source won. Producers that can fail
+// without the others failing should usually not deliver their errors.
+func (g *DeliverGroup) DeliverError(source string, err error) bool {
+	return g.deliver(source, nil, err)
+}
+
+func (g *DeliverGroup) deliver(source string, val interface{}, err error) bool {
+	// The winner is recorded before the promise is delivered, so that it is
+	// visible to anyone woken up by the delivery.
+	g.mut.Lock()
+	defer g.mut.Unlock()
+	if g.p.Realized() {
+		return false
+	}
+	g.winner = Winner{Source: source, At: time.Now()}
+	return g.p.deliver(val, err)
+}
+
+// Winner returns the producer which delivered the promise, and false if the
+// promise has not been delivered yet.
+func (g *DeliverGroup) Winner() (Winner, bool) {
+	g.mut.Lock()
+	defer g.mut.Unlock()
+	if !g.p.Realized() {
+		return Winner{}, false
+	}
+	return g.winner, true
+}
@@ -0,0 +1,43 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package promise
+
+import (
+	"context"
+	"sync"
+	"testing"
+)
+
+func TestDeliverGroup(t *testing.T) {
+	g := NewDeliverGroup()
+	if _, ok := g.Winner(); ok {
+		t.Fatal("Expected no winner before delivery")
+	}
+	var wg sync.WaitGroup
+	wins := make(chan string, 2)
+	for _, source := range []string{"cache", "database"} {
+		wg.Add(1)
+		go func(source string) {
+			defer wg.Done()
+			if g.Deliver(source, source+" value") {
+				wins <- source
+			}
+		}(source)
+	}
+	wg.Wait()
+	close(wins)
+	if len(wins) != 1 {
+		t.Fatalf("Expected exactly one winner, got %d", len(wins))
+	}
+	source := <-wins
+	val, err := g.Promise().Get(context.Background())
+	if val != source+" value" || err != nil {
+		t.Fatalf("Expected value from %s, got (%v, %v)", source, val, err)
+	}
+	winner, ok := g.Winner()
+	if !ok || winner.Source != source || winner.At.IsZero() {
+		t.Fatalf("Expected %s to be recorded as winner, got %+v", source, winner)
+	}
+}
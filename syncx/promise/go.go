@@ -0,0 +1,49 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package promise
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+)
+
+// PanicError is the error a promise is delivered with if the function computing
+// its value panicked.
+type PanicError struct {
+	// Value is the value passed to panic.
+	Value interface{}
+	// Stack is the stack trace of the panicking goroutine.
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("promise: computation panicked: %v", e.Value)
+}
+
+// Unwrap returns the panic value if it is an error.
+func (e *PanicError) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
+}
+
+// Go runs f in a new goroutine, and returns a promise delivered with its
+// result. If f panics, the promise is delivered with a *PanicError instead of
+// crashing the program.
+func Go(ctx context.Context, f func(ctx context.Context) (interface{}, error)) *Promise {
+	p := New()
+	go run(ctx, p, f)
+	return p
+}
+
+// run delivers the result of f to p, turning panics into a *PanicError.
+func run(ctx context.Context, p *Promise, f func(ctx context.Context) (interface{}, error)) {
+	defer func() {
+		if r := recover(); r != nil {
+			p.deliver(nil, &PanicError{Value: r, Stack: debug.Stack()})
+		}
+	}()
+	p.deliver(f(ctx))
+}
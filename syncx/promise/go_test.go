@@ -0,0 +1,30 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package promise
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestGo(t *testing.T) {
+	p := Go(context.Background(), func(ctx context.Context) (interface{}, error) {
+		return 42, nil
+	})
+	if val, err := p.Get(context.Background()); val != 42 || err != nil {
+		t.Fatalf("Expected (42, nil), got (%v, %v)", val, err)
+	}
+
+	errBoom := errors.New("boom")
+	p = Go(context.Background(), func(ctx context.Context) (interface{}, error) {
+		panic(errBoom)
+	})
+	_, err := p.Get(context.Background())
+	var pe *PanicError
+	if !errors.As(err, &pe) || !errors.Is(err, errBoom) || len(pe.Stack) == 0 {
+		t.Fatalf("Expected a PanicError wrapping %v, got %v", errBoom, err)
+	}
+}
@@ -0,0 +1,82 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package promise
+
+import (
+	"sync"
+	"time"
+)
+
+// PromiseMap is a set of in-flight promises indexed by key, used to coalesce
+// concurrent requests for the same thing: The first caller asking for a key
+// gets a fresh promise it must deliver, and everyone else asking for the same
+// key in the meantime waits on that promise. The zero value is ready to use. A
+// PromiseMap must not be copied after first use.
+type PromiseMap[K comparable] struct {
+	// TTL is the duration a promise delivered without an error stays in the map
+	// after it is delivered. If zero, promises are removed as soon as they are
+	// delivered. Promises delivered with an error are always removed right
+	// away, so that the next caller retries.
+	TTL time.Duration
+
+	mut      sync.Mutex
+	promises map[K]*Promise
+}
+
+// GetOrCreate returns the promise stored under key. If there is none, a new
+// promise is stored and returned with created set to true, and the caller is
+// responsible for delivering it. Failing to do so makes every later caller
+// with the same key wait forever, unless the key is forgotten.
+func (m *PromiseMap[K]) GetOrCreate(key K) (p *Promise, created bool) {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	if p, ok := m.promises[key]; ok && !m.expired(p) {
+		return p, false
+	}
+	if m.promises == nil {
+		m.promises = make(map[K]*Promise)
+	}
+	p = New()
+	m.promises[key] = p
+	p.Observe(func(_ interface{}, err error) {
+		if err != nil || m.TTL <= 0 {
+			m.remove(key, p)
+			return
+		}
+		time.AfterFunc(m.TTL, func() { m.remove(key, p) })
+	})
+	return p, true
+}
+
+// expired returns true if p is delivered and should no longer be handed out,
+// but its observer has not removed it yet.
+func (m *PromiseMap[K]) expired(p *Promise) bool {
+	return p.Realized() && (p.err != nil || m.TTL <= 0)
+}
+
+// remove removes p from the map, unless it has already been replaced.
+func (m *PromiseMap[K]) remove(key K, p *Promise) {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	if m.promises[key] == p {
+		delete(m.promises, key)
+	}
+}
+
+// Forget makes the next call to GetOrCreate with key create a new promise, even
+// if the promise stored under key is undelivered or still within its TTL.
+// Callers already holding the old promise are not affected.
+func (m *PromiseMap[K]) Forget(key K) {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	delete(m.promises, key)
+}
+
+// Len returns the number of promises in the map.
+func (m *PromiseMap[K]) Len() int {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	return len(m.promises)
+}
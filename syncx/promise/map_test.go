@@ -0,0 +1,60 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package promise
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPromiseMapCoalesces(t *testing.T) {
+	var m PromiseMap[string]
+	p, created := m.GetOrCreate("a")
+	if !created {
+		t.Fatal("Expected first GetOrCreate to create a promise")
+	}
+	if q, created := m.GetOrCreate("a"); created || q != p {
+		t.Fatal("Expected second GetOrCreate to return the in-flight promise")
+	}
+	if _, created := m.GetOrCreate("b"); !created {
+		t.Fatal("Expected a new promise for a different key")
+	}
+	p.Deliver(1)
+	if q, created := m.GetOrCreate("a"); !created || q == p {
+		t.Fatal("Expected a new promise after delivery")
+	}
+
+	m.Forget("b")
+	if _, created := m.GetOrCreate("b"); !created {
+		t.Fatal("Expected a new promise after Forget")
+	}
+}
+
+func TestPromiseMapTTL(t *testing.T) {
+	m := PromiseMap[int]{TTL: 20 * time.Millisecond}
+	p, _ := m.GetOrCreate(1)
+	p.Deliver("cached")
+	if q, created := m.GetOrCreate(1); created || q != p {
+		t.Fatal("Expected delivered promise to be kept within the TTL")
+	}
+
+	failed, _ := m.GetOrCreate(2)
+	failed.DeliverError(errors.New("failed"))
+	if _, created := m.GetOrCreate(2); !created {
+		t.Fatal("Expected failed promise to be removed right away")
+	}
+
+	deadline := time.Now().Add(1 * time.Second)
+	for m.Len() != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the delivered promise to expire, %d left", m.Len())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if _, created := m.GetOrCreate(1); !created {
+		t.Fatal("Expected a new promise after the TTL")
+	}
+}
@@ -8,9 +8,43 @@ package promise
 
 import (
 	"context"
+	"errors"
+	"runtime"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
+// ErrTimeout is returned by promises derived through WithTimeout and by
+// GetWithin if the promise was not delivered in time.
+var ErrTimeout = errors.New("promise timed out")
+
+// ErrBroken is returned by Get on promises abandoned by their producer. If the
+// producer gave a reason, Get returns a *BrokenError matching ErrBroken through
+// errors.Is instead.
+var ErrBroken = errors.New("promise broken")
+
+// BrokenError is the error an abandoned promise is delivered with if the
+// producer gave a reason for abandoning it.
+type BrokenError struct {
+	// Reason is the error passed to Abandon.
+	Reason error
+}
+
+func (e *BrokenError) Error() string {
+	return "promise broken: " + e.Reason.Error()
+}
+
+// Is returns true if target is ErrBroken.
+func (e *BrokenError) Is(target error) bool {
+	return target == ErrBroken
+}
+
+// Unwrap returns the reason the promise was abandoned.
+func (e *BrokenError) Unwrap() error {
+	return e.Reason
+}
+
 // Promise is a type embedding a value. The value is or will be computed at some
 // point, and the promise type gives you the option to wait until the value is
 // computed. A promise differs from a channel in that a promise can only be set
@@ -37,45 +71,353 @@ import (
 //		return val.(int), err
 //	}
 type Promise struct {
-	mutex    sync.Mutex
-	assigned bool
-	val      interface{}
-	done     chan struct{}
+	mutex     sync.Mutex
+	assigned  bool
+	val       interface{}
+	err       error
+	done      chan struct{}
+	opts      Opts
+	observers []func(interface{}, error)
+	notifying bool
+	delivered atomic.Uint64
+	canceled  atomic.Uint64
+	created   time.Time
+}
+
+// Opts are options that can be passed to NewWithOpts.
+type Opts struct {
+	// ConcurrentObservers makes observers run concurrently, each in its own
+	// goroutine. By default, observers run sequentially in the order they were
+	// registered, see Observe.
+	ConcurrentObservers bool
+	// TrackWaiters makes the promise count how many calls to Get ended with the
+	// value being delivered, and how many ended because their context was done.
+	// The counts are available through WaiterStats.
+	TrackWaiters bool
+	// OnAbandoned, if set, is called if the promise is garbage collected without
+	// being delivered, after at least one call to Get gave up waiting on it. This
+	// usually means the work that was supposed to deliver the promise has leaked
+	// or was dropped. OnAbandoned runs on the finalizer goroutine and implies
+	// TrackWaiters.
+	OnAbandoned func(WaiterStats)
+	// Strict makes Deliver and DeliverError panic if the promise already has a
+	// value, instead of silently doing nothing. Use it where delivering twice
+	// means two code paths both think they completed the work. TryDeliver never
+	// panics.
+	Strict bool
+	// OnLatency, if set, is called with the time from the creation of the
+	// promise until it was delivered, along with the error it was delivered
+	// with. It runs on the delivering goroutine, and is typically used to
+	// record latency metrics of asynchronous dependencies. Sharing one Opts
+	// value among all promises created for a dependency makes every one of
+	// them report to the same sink.
+	OnLatency func(d time.Duration, err error)
+}
+
+// WaiterStats are the waiter statistics of a promise created with
+// TrackWaiters.
+type WaiterStats struct {
+	// Delivered is the number of calls to Get that returned the delivered value.
+	Delivered uint64
+	// Canceled is the number of calls to Get that returned because their context
+	// was done.
+	Canceled uint64
 }
 
 // New creates a new promise.
 func New() *Promise {
+	return NewWithOpts(nil)
+}
+
+// NewWithOpts creates a new promise with the provided options. If opts is nil,
+// the default options are used.
+func NewWithOpts(opts *Opts) *Promise {
 	p := new(Promise)
 	p.done = make(chan struct{})
+	if opts != nil {
+		p.opts = *opts
+	}
+	if p.opts.OnLatency != nil {
+		p.created = time.Now()
+	}
+	if p.opts.OnAbandoned != nil {
+		p.opts.TrackWaiters = true
+		runtime.SetFinalizer(p, (*Promise).finalize)
+	}
 	return p
 }
 
+func (p *Promise) finalize() {
+	if p.Realized() {
+		return
+	}
+	if stats := p.WaiterStats(); stats.Canceled != 0 {
+		p.opts.OnAbandoned(stats)
+	}
+}
+
+// WaiterStats returns the waiter statistics of the promise. They are always
+// zero unless the promise was created with TrackWaiters.
+func (p *Promise) WaiterStats() WaiterStats {
+	return WaiterStats{
+		Delivered: p.delivered.Load(),
+		Canceled:  p.canceled.Load(),
+	}
+}
+
 // Deliver assigns a value to the promise if it does not already have a value.
-// If it has a value, then this does nothing.
+// If it has a value, then this does nothing, or panics if the promise is
+// strict.
 func (p *Promise) Deliver(val interface{}) {
+	p.mustDeliver(val, nil)
+}
+
+// DeliverError assigns err to the promise as a failed outcome, if it does not
+// already have a value. Get then returns err instead of a value. If it has a
+// value, then this does nothing, or panics if the promise is strict.
+func (p *Promise) DeliverError(err error) {
+	p.mustDeliver(nil, err)
+}
+
+// TryDeliver assigns a value to the promise if it does not already have a
+// value, and reports whether it did. It never panics, even if the promise is
+// strict.
+func (p *Promise) TryDeliver(val interface{}) bool {
+	return p.deliver(val, nil)
+}
+
+// Abandon signals that the promise will never be delivered, waking everyone
+// waiting on it. Get then returns ErrBroken, or a *BrokenError wrapping reason
+// if reason is non-nil. If the promise already has a value, Abandon does
+// nothing, even if the promise is strict. This makes it safe for producers to
+// defer a call to Abandon, in case they exit before delivering.
+func (p *Promise) Abandon(reason error) {
+	var err error = ErrBroken
+	if reason != nil {
+		err = &BrokenError{Reason: reason}
+	}
+	p.deliver(nil, err)
+}
+
+// mustDeliver delivers the value and error, and panics if the promise is strict
+// and already delivered.
+func (p *Promise) mustDeliver(val interface{}, err error) {
+	if !p.deliver(val, err) && p.opts.Strict {
+		panic("promise: strict promise delivered twice")
+	}
+}
+
+// deliver assigns the value and error to the promise if it does not already
+// have a value, and returns true if it did.
+func (p *Promise) deliver(val interface{}, err error) bool {
 	if p.done == nil {
 		panic("Promise not initialised")
 	}
 	p.mutex.Lock()
-	if !p.assigned {
-		p.assigned = true
-		p.val = val
-		close(p.done)
+	if p.assigned {
+		p.mutex.Unlock()
+		return false
 	}
+	p.assigned = true
+	p.val = val
+	p.err = err
+	close(p.done)
+	p.notify()
 	p.mutex.Unlock()
+	if p.opts.OnLatency != nil {
+		p.opts.OnLatency(time.Since(p.created), err)
+	}
+	return true
+}
+
+// Observe registers f to be called with the value and error of the promise
+// once it is delivered. If the promise is already delivered, f is called
+// shortly after. Observers never run on the goroutine calling Deliver or
+// Observe.
+//
+// By default, observers run sequentially on a single goroutine in the order
+// they were registered, so that each observer sees the side effects of the
+// ones registered before it. A slow observer therefore delays the ones after
+// it. If the promise was created with ConcurrentObservers, each observer runs
+// in its own goroutine and no ordering is guaranteed.
+func (p *Promise) Observe(f func(val interface{}, err error)) {
+	if p.done == nil {
+		panic("Promise not initialised")
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.observers = append(p.observers, f)
+	if p.assigned {
+		p.notify()
+	}
+}
+
+// OnDelivered calls f with the value of the promise once it is delivered
+// without an error. Unlike Observe, f is called immediately on the calling
+// goroutine if the promise is already delivered. Otherwise it is called as an
+// observer, once the promise is delivered. If the promise is delivered with an
+// error, f is never called.
+func (p *Promise) OnDelivered(f func(val interface{})) {
+	if p.Realized() {
+		if p.err == nil {
+			f(p.val)
+		}
+		return
+	}
+	p.Observe(func(val interface{}, err error) {
+		if err == nil {
+			f(val)
+		}
+	})
 }
 
-// Get returns the value within the promise. If the value is not yet set, then
-// this will block until either the value is set or the context times out.
+// notify runs the pending observers. Must be called while holding the mutex,
+// after the promise has been assigned.
+func (p *Promise) notify() {
+	if len(p.observers) == 0 {
+		return
+	}
+	if p.opts.ConcurrentObservers {
+		for _, f := range p.observers {
+			go f(p.val, p.err)
+		}
+		p.observers = nil
+		return
+	}
+	if p.notifying {
+		// the running goroutine will pick up the new observers
+		return
+	}
+	p.notifying = true
+	go p.runObservers()
+}
+
+func (p *Promise) runObservers() {
+	for {
+		p.mutex.Lock()
+		observers := p.observers
+		p.observers = nil
+		if len(observers) == 0 {
+			p.notifying = false
+			p.mutex.Unlock()
+			return
+		}
+		p.mutex.Unlock()
+		for _, f := range observers {
+			f(p.val, p.err)
+		}
+	}
+}
+
+// derive returns a new promise for Then and its relatives.
+func (p *Promise) derive() *Promise {
+	return NewWithOpts(&Opts{ConcurrentObservers: p.opts.ConcurrentObservers})
+}
+
+// Then returns a promise which is delivered with the result of calling f with
+// the value of p, once p is delivered. If p is delivered with an error, f is
+// not called and the returned promise is delivered with the same error. f runs
+// as an observer of p, so it is subject to the same ordering guarantees. The
+// returned promise has concurrent observers if p has, but none of the other
+// options of p: Its hooks would otherwise fire once per derived promise.
+func (p *Promise) Then(f func(val interface{}) (interface{}, error)) *Promise {
+	derived := p.derive()
+	p.Observe(func(val interface{}, err error) {
+		if err != nil {
+			derived.deliver(nil, err)
+			return
+		}
+		derived.deliver(f(val))
+	})
+	return derived
+}
+
+// ThenCompose is like Then, but for f starting another asynchronous
+// computation: The returned promise is delivered with the value and error of
+// the promise returned by f, once that is delivered. This chains dependent
+// asynchronous calls without a goroutine blocking on Get in between. f must
+// not return nil.
+func (p *Promise) ThenCompose(f func(val interface{}) *Promise) *Promise {
+	derived := p.derive()
+	p.Observe(func(val interface{}, err error) {
+		if err != nil {
+			derived.deliver(nil, err)
+			return
+		}
+		f(val).Observe(func(val interface{}, err error) {
+			derived.deliver(val, err)
+		})
+	})
+	return derived
+}
+
+// Map is like Then, but for transforms that cannot fail.
+func (p *Promise) Map(f func(val interface{}) interface{}) *Promise {
+	return p.Then(func(val interface{}) (interface{}, error) {
+		return f(val), nil
+	})
+}
+
+// Catch returns a promise which recovers from a failed p: If p is delivered
+// with an error, the returned promise is delivered with the result of calling f
+// with that error. Otherwise, it is delivered with the value of p and f is not
+// called. Like Then, f runs as an observer of p, and the returned promise only
+// inherits the ConcurrentObservers option of p.
+func (p *Promise) Catch(f func(err error) (interface{}, error)) *Promise {
+	derived := p.derive()
+	p.Observe(func(val interface{}, err error) {
+		if err == nil {
+			derived.deliver(val, nil)
+			return
+		}
+		derived.deliver(f(err))
+	})
+	return derived
+}
+
+// Get returns the value within the promise, or the error it was delivered with
+// through DeliverError. If the value is not yet set, then this will block until
+// either the value is set or the context times out, in which case ctx.Err() is
+// returned. Delivered errors and context errors can be told apart by checking
+// Realized, unless the promise was delivered with a context error itself.
 func (p *Promise) Get(ctx context.Context) (interface{}, error) {
 	if p.done == nil {
 		panic("Promise not initialised")
 	}
 	select {
 	case <-ctx.Done():
+		if p.opts.TrackWaiters {
+			p.canceled.Add(1)
+		}
 		return nil, ctx.Err()
 	case <-p.done:
-		return p.val, nil
+		if p.opts.TrackWaiters {
+			p.delivered.Add(1)
+		}
+		return p.val, p.err
+	}
+}
+
+// GetWithin is like Get, but waits at most d for the value. If the promise is
+// not delivered in time, GetWithin returns ErrTimeout. This saves creating a
+// context just to bound a single read.
+func (p *Promise) GetWithin(d time.Duration) (interface{}, error) {
+	if p.done == nil {
+		panic("Promise not initialised")
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		if p.opts.TrackWaiters {
+			p.canceled.Add(1)
+		}
+		return nil, ErrTimeout
+	case <-p.done:
+		if p.opts.TrackWaiters {
+			p.delivered.Add(1)
+		}
+		return p.val, p.err
 	}
 }
 
@@ -92,11 +434,57 @@ func (p *Promise) Realized() bool {
 	}
 }
 
-/*
+// Peek returns the value of the promise without blocking. ok is false if the
+// promise has not been realized yet. For promises delivered with an error, Peek
+// returns a nil value and true; use Get to retrieve the error, which does not
+// block on a realized promise.
+func (p *Promise) Peek() (val interface{}, ok bool) {
+	if !p.Realized() {
+		return nil, false
+	}
+	return p.val, true
+}
 
-// Skip these for now: People should just use context.
+// WithTimeout returns a promise derived from p, which is delivered with the
+// value of p if p is delivered within d. Otherwise, getting the value of the
+// derived promise returns ErrTimeout. p itself is not affected, so different
+// consumers of p can have different deadlines without building contexts.
+func WithTimeout(p *Promise, d time.Duration) *Promise {
+	if p.done == nil {
+		panic("Promise not initialised")
+	}
+	derived := New()
+	go func() {
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		select {
+		case <-p.done:
+			derived.deliver(p.val, p.err)
+		case <-timer.C:
+			derived.deliver(nil, ErrTimeout)
+		}
+	}()
+	return derived
+}
 
-// Done returns a channel that's closed when the promise is assigned.
+// FromChan returns a promise delivered with the first value received from ch.
+// If ch is closed without a value, the promise is abandoned. The promise holds
+// on to a goroutine until ch receives a value or is closed.
+func FromChan[T any](ch <-chan T) *Promise {
+	p := New()
+	go func() {
+		val, ok := <-ch
+		if !ok {
+			p.Abandon(nil)
+			return
+		}
+		p.deliver(val, nil)
+	}()
+	return p
+}
+
+// Done returns a channel that's closed when the promise is assigned, so that
+// the promise can be waited on in a select statement alongside other channels.
 func (p *Promise) Done() <-chan struct{} {
 	if p.done == nil {
 		panic("Promise not initialised")
@@ -104,6 +492,10 @@ func (p *Promise) Done() <-chan struct{} {
 	return p.done
 }
 
+/*
+
+// Skip this for now: People should just use context.
+
 // Value returns the value within the promise. If the value is not yet set, then
 // this function will block until the value has been assigned.
 func (p *Promise) Value() interface{} {
@@ -6,6 +6,8 @@ package promise
 
 import (
 	"context"
+	"errors"
+	"runtime"
 	"sync"
 	"testing"
 	"time"
@@ -46,6 +48,7 @@ func TestSequentialReadWrite(t *testing.T) {
 func TestTimeout(t *testing.T) {
 	p := NewIntPromise()
 	ctx, cancelCtx := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancelCtx()
 	var toplevelErr error
 	var errMut sync.Mutex
 	var wg sync.WaitGroup
@@ -62,7 +65,6 @@ func TestTimeout(t *testing.T) {
 		}()
 	}
 	wg.Wait()
-	cancelCtx()
 	if toplevelErr != nil {
 		t.Fatal(toplevelErr)
 	}
@@ -71,6 +73,7 @@ func TestTimeout(t *testing.T) {
 func TestEventualReturn(t *testing.T) {
 	p := NewIntPromise()
 	ctx, cancelCtx := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancelCtx()
 	var toplevelErr error
 	var errMut sync.Mutex
 	var wg sync.WaitGroup
@@ -89,8 +92,381 @@ func TestEventualReturn(t *testing.T) {
 	time.Sleep(1 * time.Millisecond)
 	p.Deliver(10)
 	wg.Wait()
-	cancelCtx()
 	if toplevelErr != nil {
 		t.Fatal(toplevelErr)
 	}
 }
+
+func TestWithTimeout(t *testing.T) {
+	p := New()
+	fast := WithTimeout(p, 1*time.Second)
+	slow := WithTimeout(p, 1*time.Millisecond)
+	if _, err := slow.Get(context.Background()); err != ErrTimeout {
+		t.Fatalf("Expected ErrTimeout, but got %v", err)
+	}
+	if p.Realized() {
+		t.Fatal("Expected parent promise to not be affected by timeout")
+	}
+	p.Deliver(10)
+	val, err := fast.Get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if val != 10 {
+		t.Fatalf("Expected derived promise to be delivered with 10, but was %v", val)
+	}
+}
+
+func TestObserveOrder(t *testing.T) {
+	p := New()
+	var order []int
+	done := make(chan struct{})
+	for i := 0; i < 5; i++ {
+		i := i
+		p.Observe(func(val interface{}, err error) {
+			time.Sleep(time.Duration(5-i) * time.Millisecond)
+			order = append(order, i)
+		})
+	}
+	p.Deliver(1)
+	// registered after delivery, but must still run after the others
+	p.Observe(func(val interface{}, err error) {
+		order = append(order, 5)
+		close(done)
+	})
+	select {
+	case <-done:
+	case <-time.After(1 * time.Second):
+		t.Fatal("timed out waiting for observers")
+	}
+	for i, v := range order {
+		if i != v {
+			t.Fatalf("Expected observers to run in registration order, got %v", order)
+		}
+	}
+}
+
+func TestObserveConcurrent(t *testing.T) {
+	p := NewWithOpts(&Opts{ConcurrentObservers: true})
+	var wg sync.WaitGroup
+	wg.Add(2)
+	block := make(chan struct{})
+	p.Observe(func(val interface{}, err error) {
+		<-block
+		wg.Done()
+	})
+	p.Observe(func(val interface{}, err error) {
+		// would deadlock if observers ran sequentially
+		close(block)
+		wg.Done()
+	})
+	p.Deliver(1)
+	wg.Wait()
+}
+
+func TestThen(t *testing.T) {
+	p := New()
+	doubled := p.Then(func(val interface{}) (interface{}, error) {
+		return val.(int) * 2, nil
+	})
+	p.Deliver(21)
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	val, err := doubled.Get(ctx)
+	if err != nil || val != 42 {
+		t.Errorf("Expected (42, nil), got (%v, %v)", val, err)
+	}
+
+	timedOut := WithTimeout(New(), 1*time.Millisecond)
+	called := false
+	chained := timedOut.Then(func(val interface{}) (interface{}, error) {
+		called = true
+		return val, nil
+	})
+	if _, err := chained.Get(ctx); err != ErrTimeout || called {
+		t.Errorf("Expected error to propagate without calling f, got %v (called: %v)", err, called)
+	}
+}
+
+func TestThenCompose(t *testing.T) {
+	userID := New()
+	profile := userID.ThenCompose(func(val interface{}) *Promise {
+		return Go(context.Background(), func(context.Context) (interface{}, error) {
+			return "profile of " + val.(string), nil
+		})
+	})
+	userID.Deliver("alice")
+	val, err := profile.GetWithin(1 * time.Second)
+	if err != nil || val != "profile of alice" {
+		t.Errorf("Expected (profile of alice, nil), got (%v, %v)", val, err)
+	}
+
+	errFailed := errors.New("failed")
+	failed := New()
+	failed.DeliverError(errFailed)
+	chained := failed.ThenCompose(func(val interface{}) *Promise {
+		t.Error("f called for a failed promise")
+		return New()
+	})
+	if _, err := chained.GetWithin(1 * time.Second); err != errFailed {
+		t.Errorf("Expected error to propagate, got %v", err)
+	}
+}
+
+func TestWaiterStats(t *testing.T) {
+	p := NewWithOpts(&Opts{TrackWaiters: true})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	p.Get(ctx)
+	p.Deliver(1)
+	p.Get(context.Background())
+	p.Get(context.Background())
+	if stats := p.WaiterStats(); stats != (WaiterStats{Delivered: 2, Canceled: 1}) {
+		t.Errorf("Unexpected waiter stats %+v", stats)
+	}
+	if stats := New().WaiterStats(); stats != (WaiterStats{}) {
+		t.Errorf("Expected untracked promise to have zero stats, got %+v", stats)
+	}
+}
+
+func TestOnAbandoned(t *testing.T) {
+	abandoned := make(chan WaiterStats, 2)
+	opts := &Opts{OnAbandoned: func(stats WaiterStats) { abandoned <- stats }}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	func() {
+		p := NewWithOpts(opts)
+		p.Get(ctx)
+		delivered := NewWithOpts(opts)
+		delivered.Get(ctx)
+		delivered.Deliver(1)
+		NewWithOpts(opts)
+	}()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		runtime.GC()
+		select {
+		case stats := <-abandoned:
+			if stats != (WaiterStats{Canceled: 1}) {
+				t.Errorf("Unexpected waiter stats %+v", stats)
+			}
+			runtime.GC()
+			time.Sleep(10 * time.Millisecond)
+			if len(abandoned) != 0 {
+				t.Errorf("Expected only the undelivered promise to be reported")
+			}
+			return
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	t.Fatal("Expected abandoned promise to be reported")
+}
+
+func TestDeliverError(t *testing.T) {
+	errFailed := errors.New("computation failed")
+	p := New()
+	p.DeliverError(errFailed)
+	p.Deliver(1)
+	val, err := p.Get(context.Background())
+	if val != nil || err != errFailed {
+		t.Fatalf("Expected (nil, %v), got (%v, %v)", errFailed, val, err)
+	}
+	if !p.Realized() {
+		t.Fatal("Expected failed promise to be realized")
+	}
+	derived := p.Then(func(val interface{}) (interface{}, error) {
+		t.Error("Expected Then not to be called on a failed promise")
+		return nil, nil
+	})
+	if _, err := derived.Get(context.Background()); err != errFailed {
+		t.Fatalf("Expected derived promise to fail with %v, got %v", errFailed, err)
+	}
+}
+
+func TestTryDeliver(t *testing.T) {
+	p := New()
+	if !p.TryDeliver(1) {
+		t.Fatal("Expected first TryDeliver to deliver")
+	}
+	if p.TryDeliver(2) {
+		t.Fatal("Expected second TryDeliver not to deliver")
+	}
+	p.Deliver(3)
+	if val, _ := p.Get(context.Background()); val != 1 {
+		t.Fatalf("Expected first value to win, got %v", val)
+	}
+}
+
+func TestStrict(t *testing.T) {
+	p := NewWithOpts(&Opts{Strict: true})
+	p.Deliver(1)
+	if p.TryDeliver(2) {
+		t.Fatal("Expected TryDeliver not to deliver")
+	}
+	defer func() {
+		if recover() == nil {
+			t.Fatal("Expected second Deliver on a strict promise to panic")
+		}
+	}()
+	p.DeliverError(errors.New("late"))
+}
+
+func TestMapCatch(t *testing.T) {
+	p := New()
+	doubled := p.Map(func(val interface{}) interface{} { return val.(int) * 2 })
+	recovered := doubled.Catch(func(err error) (interface{}, error) {
+		t.Error("Expected Catch not to be called on a successful promise")
+		return nil, err
+	})
+	p.Deliver(21)
+	if val, err := recovered.Get(context.Background()); val != 42 || err != nil {
+		t.Fatalf("Expected (42, nil), got (%v, %v)", val, err)
+	}
+
+	failed := New()
+	fallback := failed.Map(func(val interface{}) interface{} {
+		t.Error("Expected Map not to be called on a failed promise")
+		return val
+	}).Catch(func(err error) (interface{}, error) {
+		return "fallback", nil
+	})
+	failed.DeliverError(errors.New("failed"))
+	if val, err := fallback.Get(context.Background()); val != "fallback" || err != nil {
+		t.Fatalf("Expected (fallback, nil), got (%v, %v)", val, err)
+	}
+}
+
+func TestPeek(t *testing.T) {
+	p := New()
+	if val, ok := p.Peek(); val != nil || ok {
+		t.Fatalf("Expected (nil, false) before delivery, got (%v, %v)", val, ok)
+	}
+	p.Deliver(1)
+	if val, ok := p.Peek(); val != 1 || !ok {
+		t.Fatalf("Expected (1, true) after delivery, got (%v, %v)", val, ok)
+	}
+}
+
+func TestGetWithin(t *testing.T) {
+	p := NewWithOpts(&Opts{TrackWaiters: true})
+	if _, err := p.GetWithin(1 * time.Millisecond); err != ErrTimeout {
+		t.Fatalf("Expected ErrTimeout, got %v", err)
+	}
+	p.Deliver(1)
+	if val, err := p.GetWithin(1 * time.Millisecond); val != 1 || err != nil {
+		t.Fatalf("Expected (1, nil), got (%v, %v)", val, err)
+	}
+	if stats := p.WaiterStats(); stats != (WaiterStats{Delivered: 1, Canceled: 1}) {
+		t.Errorf("Unexpected waiter stats %+v", stats)
+	}
+}
+
+func TestOnDelivered(t *testing.T) {
+	p := New()
+	called := make(chan interface{}, 1)
+	p.OnDelivered(func(val interface{}) { called <- val })
+	p.Deliver(1)
+	if val := <-called; val != 1 {
+		t.Fatalf("Expected 1, got %v", val)
+	}
+
+	// already delivered: called synchronously
+	var got interface{}
+	p.OnDelivered(func(val interface{}) { got = val })
+	if got != 1 {
+		t.Fatalf("Expected callback to run immediately, got %v", got)
+	}
+
+	failed := New()
+	failed.DeliverError(errors.New("failed"))
+	failed.OnDelivered(func(val interface{}) {
+		t.Error("Callback called for a promise delivered with an error")
+	})
+}
+
+func TestAbandon(t *testing.T) {
+	p := NewWithOpts(&Opts{Strict: true})
+	go func() {
+		defer p.Abandon(nil)
+	}()
+	if _, err := p.Get(context.Background()); err != ErrBroken {
+		t.Fatalf("Expected ErrBroken, got %v", err)
+	}
+
+	reason := errors.New("producer crashed")
+	p = New()
+	p.Abandon(reason)
+	p.Abandon(nil)
+	_, err := p.Get(context.Background())
+	if !errors.Is(err, ErrBroken) || !errors.Is(err, reason) {
+		t.Fatalf("Expected error matching ErrBroken and the reason, got %v", err)
+	}
+
+	p = New()
+	p.Deliver(1)
+	p.Abandon(nil)
+	if val, err := p.Get(context.Background()); val != 1 || err != nil {
+		t.Fatalf("Expected Abandon to not affect a delivered promise, got (%v, %v)", val, err)
+	}
+}
+
+func TestFromChan(t *testing.T) {
+	ch := make(chan int, 1)
+	p := FromChan(ch)
+	select {
+	case <-p.Done():
+		t.Fatal("Promise done before the channel received a value")
+	default:
+	}
+	ch <- 5
+	<-p.Done()
+	if val, ok := p.Peek(); !ok || val != 5 {
+		t.Fatalf("Expected (5, true), got (%v, %v)", val, ok)
+	}
+
+	closed := make(chan string)
+	close(closed)
+	if _, err := FromChan(closed).Get(context.Background()); err != ErrBroken {
+		t.Fatalf("Expected ErrBroken from closed channel, got %v", err)
+	}
+}
+
+func TestOnLatency(t *testing.T) {
+	var latencies []time.Duration
+	opts := &Opts{
+		OnLatency: func(d time.Duration, err error) {
+			latencies = append(latencies, d)
+		},
+	}
+	p := NewWithOpts(opts)
+	time.Sleep(5 * time.Millisecond)
+	p.Deliver(1)
+	p.Deliver(2)
+	NewWithOpts(opts).DeliverError(errors.New("failed"))
+	if len(latencies) != 2 {
+		t.Fatalf("Expected two latencies to be recorded, got %v", latencies)
+	}
+	if latencies[0] < 5*time.Millisecond {
+		t.Errorf("Expected latency of at least 5ms, got %v", latencies[0])
+	}
+}
+
+func TestDerivedOpts(t *testing.T) {
+	var reported int
+	p := NewWithOpts(&Opts{
+		Strict:              true,
+		ConcurrentObservers: true,
+		OnLatency:           func(time.Duration, error) { reported++ },
+	})
+	derived := p.Then(func(val interface{}) (interface{}, error) { return val, nil })
+	p.Deliver(1)
+	if _, err := derived.Get(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if reported != 1 {
+		t.Errorf("Expected only p to report its latency, got %d reports", reported)
+	}
+	if !derived.opts.ConcurrentObservers || derived.opts.Strict {
+		t.Errorf("Expected derived promise to only inherit ConcurrentObservers, got %+v", derived.opts)
+	}
+}
@@ -0,0 +1,63 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package promise
+
+import "context"
+
+// Transport delivers promise values across process boundaries, typically
+// through a message broker like Redis pub/sub or NATS. Values are opaque byte
+// slices: Encoding and decoding them is left to the user.
+//
+// Implementations must be safe for concurrent use.
+type Transport interface {
+	// Publish sends val to everyone subscribing to id.
+	Publish(ctx context.Context, id string, val []byte) error
+	// Subscribe starts listening for values published to id, and sends them on
+	// the returned channel. When ctx is done, the transport should release the
+	// subscription and stop sending values.
+	Subscribe(ctx context.Context, id string) (<-chan []byte, error)
+}
+
+// Await returns a promise which is delivered with the first value published to
+// id on t, as a []byte. Await subscribes before it returns, so any value
+// published to id after Await has returned will be delivered.
+//
+// The subscription is released when a value has been delivered or when ctx is
+// done, whichever comes first. In the latter case, the promise is abandoned
+// with ctx.Err() as the reason. The promise is also abandoned if the transport
+// closes the channel without sending a value.
+//
+// The process delivering the value calls t.Publish directly:
+//
+//	// In the worker process
+//	err := transport.Publish(ctx, requestID, result)
+//
+//	// In the requesting process
+//	p, err := promise.Await(ctx, transport, requestID)
+//	// ... send the request to the worker
+//	val, err := p.Get(ctx)
+func Await(ctx context.Context, t Transport, id string) (*Promise, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	vals, err := t.Subscribe(ctx, id)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	p := New()
+	go func() {
+		defer cancel()
+		select {
+		case val, ok := <-vals:
+			if !ok {
+				p.Abandon(nil)
+				return
+			}
+			p.Deliver(val)
+		case <-ctx.Done():
+			p.Abandon(ctx.Err())
+		}
+	}()
+	return p, nil
+}
@@ -0,0 +1,104 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package promise
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+type memTransport struct {
+	mut  sync.Mutex
+	subs map[string][]chan []byte
+}
+
+func (mt *memTransport) Publish(ctx context.Context, id string, val []byte) error {
+	mt.mut.Lock()
+	defer mt.mut.Unlock()
+	for _, ch := range mt.subs[id] {
+		select {
+		case ch <- val:
+		default:
+		}
+	}
+	return nil
+}
+
+func (mt *memTransport) Subscribe(ctx context.Context, id string) (<-chan []byte, error) {
+	mt.mut.Lock()
+	defer mt.mut.Unlock()
+	if mt.subs == nil {
+		mt.subs = make(map[string][]chan []byte)
+	}
+	ch := make(chan []byte, 1)
+	mt.subs[id] = append(mt.subs[id], ch)
+	return ch, nil
+}
+
+func TestAwait(t *testing.T) {
+	transport := &memTransport{}
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	p, err := Await(ctx, transport, "request-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := Await(ctx, transport, "request-2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = transport.Publish(ctx, "request-1", []byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	val, err := p.Get(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(val.([]byte)) != "hello" {
+		t.Fatalf("Expected promise to be delivered with hello, but was %q", val)
+	}
+	if other.Realized() {
+		t.Fatal("Expected promise for other id to not be realized")
+	}
+}
+
+func TestAwaitCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	p, err := Await(ctx, &memTransport{}, "request-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	getCtx, getCancel := context.WithTimeout(context.Background(), time.Second)
+	defer getCancel()
+	_, err = p.Get(getCtx)
+	if !errors.Is(err, ErrBroken) || !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected promise to be abandoned with context.Canceled, got %v", err)
+	}
+}
+
+type closedTransport struct{ memTransport }
+
+func (*closedTransport) Subscribe(ctx context.Context, id string) (<-chan []byte, error) {
+	ch := make(chan []byte)
+	close(ch)
+	return ch, nil
+}
+
+func TestAwaitClosed(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	p, err := Await(ctx, &closedTransport{}, "request-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Get(ctx); err != ErrBroken {
+		t.Fatalf("Expected ErrBroken, got %v", err)
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package promise
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrScopeClosed is the error of promises created through Scope.Go after the
+// scope has been closed.
+var ErrScopeClosed = errors.New("promise scope closed")
+
+// Scope ties the goroutines producing promises to a parent lifetime, typically
+// a request handler: Closing the scope cancels the context of every producer
+// started through Go, and waits for them to finish. This guarantees that no
+// producer outlives the handler:
+//
+//	scope := promise.NewScope(r.Context())
+//	defer scope.Close(context.Background())
+//	user := scope.Go(fetchUser)
+//	orders := scope.Go(fetchOrders)
+//	...
+//
+// A Scope is safe for concurrent use.
+type Scope struct {
+	ctx     context.Context
+	cancel  context.CancelFunc
+	mut     sync.Mutex
+	closed  bool
+	running int
+	done    chan struct{}
+}
+
+// NewScope creates a new scope. The context passed to the producers is derived
+// from ctx, so the producers are also cancelled when ctx is.
+func NewScope(ctx context.Context) *Scope {
+	ctx, cancel := context.WithCancel(ctx)
+	return &Scope{ctx: ctx, cancel: cancel, done: make(chan struct{})}
+}
+
+// Go runs f in a new goroutine, and returns a promise delivered with its
+// result, like the package-level Go. f must return soon after its context is
+// done. If the scope is closed, f is not run, and the promise is delivered with
+// ErrScopeClosed.
+func (s *Scope) Go(f func(ctx context.Context) (interface{}, error)) *Promise {
+	p := New()
+	s.mut.Lock()
+	if s.closed {
+		s.mut.Unlock()
+		p.deliver(nil, ErrScopeClosed)
+		return p
+	}
+	s.running++
+	s.mut.Unlock()
+	go func() {
+		defer s.finish()
+		run(s.ctx, p, f)
+	}()
+	return p
+}
+
+func (s *Scope) finish() {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	s.running--
+	if s.closed && s.running == 0 {
+		close(s.done)
+	}
+}
+
+// Running returns the number of producers that have not yet finished.
+func (s *Scope) Running() int {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	return s.running
+}
+
+// Close cancels the context of all producers and waits for them to finish. If
+// ctx is done before that, Close returns the number of producers still running
+// along with ctx.Err(). Calling Close multiple times is fine, and later calls
+// wait for the producers again.
+func (s *Scope) Close(ctx context.Context) (int, error) {
+	s.mut.Lock()
+	if !s.closed {
+		s.closed = true
+		s.cancel()
+		if s.running == 0 {
+			close(s.done)
+		}
+	}
+	s.mut.Unlock()
+	select {
+	case <-s.done:
+		return 0, nil
+	case <-ctx.Done():
+		return s.Running(), ctx.Err()
+	}
+}
@@ -0,0 +1,59 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package promise
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestScope(t *testing.T) {
+	scope := NewScope(context.Background())
+	quick := scope.Go(func(ctx context.Context) (interface{}, error) {
+		return 1, nil
+	})
+	blocked := scope.Go(func(ctx context.Context) (interface{}, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	if val, err := quick.Get(context.Background()); val != 1 || err != nil {
+		t.Fatalf("Expected (1, nil), got (%v, %v)", val, err)
+	}
+	if n, err := scope.Close(context.Background()); n != 0 || err != nil {
+		t.Fatalf("Expected all producers to finish, got (%d, %v)", n, err)
+	}
+	if !blocked.Realized() {
+		t.Fatal("Expected cancelled producer to have delivered")
+	}
+	if _, err := blocked.Get(context.Background()); err != context.Canceled {
+		t.Fatalf("Expected Canceled, got %v", err)
+	}
+	late := scope.Go(func(ctx context.Context) (interface{}, error) {
+		t.Error("Expected producer not to run on a closed scope")
+		return nil, nil
+	})
+	if _, err := late.Get(context.Background()); err != ErrScopeClosed {
+		t.Fatalf("Expected ErrScopeClosed, got %v", err)
+	}
+}
+
+func TestScopeCloseDeadline(t *testing.T) {
+	scope := NewScope(context.Background())
+	release := make(chan struct{})
+	scope.Go(func(ctx context.Context) (interface{}, error) {
+		<-release
+		return nil, nil
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if n, err := scope.Close(ctx); n != 1 || err != context.DeadlineExceeded {
+		t.Fatalf("Expected (1, DeadlineExceeded), got (%d, %v)", n, err)
+	}
+	close(release)
+	if n, err := scope.Close(context.Background()); n != 0 || err != nil {
+		t.Fatalf("Expected producer to finish, got (%d, %v)", n, err)
+	}
+}
@@ -0,0 +1,115 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package promise
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrEpochPassed is returned by VersionedPromise.Get if the awaited epoch has
+// been superseded by a newer one.
+var ErrEpochPassed = errors.New("promise epoch has passed")
+
+// VersionedPromise is a reusable promise for repeated request/response cycles
+// on a long-lived object. Every call to Reset starts a new epoch, which can be
+// delivered once. Waiters specify the epoch they await, so a waiter never
+// mistakes the value of an earlier or later cycle for the one it waits for.
+//
+// A typical cycle looks like this:
+//
+//	epoch := vp.Reset()
+//	sendRequest(epoch)
+//	val, err := vp.Get(ctx, epoch)
+//
+// while the response handler calls vp.Deliver(epoch, response).
+type VersionedPromise struct {
+	mut       sync.Mutex
+	epoch     uint64
+	delivered bool
+	val       interface{}
+	err       error
+	changed   chan struct{}
+}
+
+// NewVersioned creates a new versioned promise at epoch 0.
+func NewVersioned() *VersionedPromise {
+	return &VersionedPromise{changed: make(chan struct{})}
+}
+
+// broadcast wakes up all waiters. Must be called while holding the mutex.
+func (vp *VersionedPromise) broadcast() {
+	close(vp.changed)
+	vp.changed = make(chan struct{})
+}
+
+// Epoch returns the current epoch.
+func (vp *VersionedPromise) Epoch() uint64 {
+	vp.mut.Lock()
+	defer vp.mut.Unlock()
+	return vp.epoch
+}
+
+// Reset starts a new epoch and returns it. Waiters of earlier epochs which have
+// not been delivered receive ErrEpochPassed.
+func (vp *VersionedPromise) Reset() uint64 {
+	vp.mut.Lock()
+	defer vp.mut.Unlock()
+	vp.epoch++
+	vp.delivered = false
+	vp.val, vp.err = nil, nil
+	vp.broadcast()
+	return vp.epoch
+}
+
+// Deliver assigns val to the given epoch, if it is the current epoch and has
+// not been delivered yet. It returns true if the value was assigned.
+func (vp *VersionedPromise) Deliver(epoch uint64, val interface{}) bool {
+	return vp.deliver(epoch, val, nil)
+}
+
+// DeliverError assigns err to the given epoch, like Deliver does with a value.
+func (vp *VersionedPromise) DeliverError(epoch uint64, err error) bool {
+	return vp.deliver(epoch, nil, err)
+}
+
+func (vp *VersionedPromise) deliver(epoch uint64, val interface{}, err error) bool {
+	vp.mut.Lock()
+	defer vp.mut.Unlock()
+	if epoch != vp.epoch || vp.delivered {
+		return false
+	}
+	vp.delivered = true
+	vp.val, vp.err = val, err
+	vp.broadcast()
+	return true
+}
+
+// Get returns the value of the given epoch, blocking until it is delivered or
+// the context is done. If the epoch is passed before it is delivered, or was
+// passed already, ErrEpochPassed is returned. Awaiting a future epoch blocks
+// until that epoch is started and delivered.
+func (vp *VersionedPromise) Get(ctx context.Context, epoch uint64) (interface{}, error) {
+	for {
+		vp.mut.Lock()
+		if epoch < vp.epoch {
+			vp.mut.Unlock()
+			return nil, ErrEpochPassed
+		}
+		if epoch == vp.epoch && vp.delivered {
+			val, err := vp.val, vp.err
+			vp.mut.Unlock()
+			return val, err
+		}
+		changed := vp.changed
+		vp.mut.Unlock()
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,59 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package promise
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestVersionedPromise(t *testing.T) {
+	vp := NewVersioned()
+	ctx := context.Background()
+
+	epoch := vp.Reset()
+	if epoch != 1 || vp.Epoch() != 1 {
+		t.Fatalf("Expected epoch 1, got %d", epoch)
+	}
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		vp.Deliver(epoch, "first")
+	}()
+	if val, err := vp.Get(ctx, epoch); err != nil || val != "first" {
+		t.Fatalf("Expected (first, nil), got (%v, %v)", val, err)
+	}
+	if vp.Deliver(epoch, "again") {
+		t.Fatal("Expected an epoch to be delivered only once")
+	}
+
+	// waiters of the previous epoch must not see the next one
+	res := make(chan error, 1)
+	next := epoch + 1
+	go func() {
+		_, err := vp.Get(ctx, epoch)
+		res <- err
+	}()
+	vp.Reset()
+	if vp.Deliver(epoch, "stale") {
+		t.Fatal("Expected delivery to a passed epoch to fail")
+	}
+	vp.Deliver(next, "second")
+	if err := <-res; err != nil && err != ErrEpochPassed {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := vp.Get(ctx, epoch); err != ErrEpochPassed {
+		t.Fatalf("Expected ErrEpochPassed, got %v", err)
+	}
+	if val, _ := vp.Get(ctx, next); val != "second" {
+		t.Fatalf("Expected second, got %v", val)
+	}
+
+	timeout, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if _, err := vp.Get(timeout, next+1); err != context.DeadlineExceeded {
+		t.Fatalf("Expected DeadlineExceeded for a future epoch, got %v", err)
+	}
+}
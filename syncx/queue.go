@@ -0,0 +1,119 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package syncx
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// QueueStats are size and throughput metrics of a BlockingQueue.
+type QueueStats struct {
+	// Len and Cap are the current length and the capacity of the queue.
+	Len int
+	Cap int
+	// Puts and Polls are the total number of elements put into and polled from
+	// the queue.
+	Puts  uint64
+	Polls uint64
+	// FullPuts is the number of puts that found the queue full, either blocking
+	// or being rejected by TryPut.
+	FullPuts uint64
+}
+
+// BlockingQueue is a bounded FIFO queue safe for concurrent use. Put blocks
+// while the queue is full and Poll blocks while it is empty, both until their
+// context is done.
+type BlockingQueue[T any] struct {
+	ch       chan T
+	puts     atomic.Uint64
+	polls    atomic.Uint64
+	fullPuts atomic.Uint64
+}
+
+// NewBlockingQueue returns a new queue which can hold at most capacity
+// elements.
+func NewBlockingQueue[T any](capacity int) *BlockingQueue[T] {
+	if capacity <= 0 {
+		panic("syncx: BlockingQueue capacity must be positive")
+	}
+	return &BlockingQueue[T]{ch: make(chan T, capacity)}
+}
+
+// Put adds v to the queue, waiting for room if the queue is full. If ctx is
+// done before v is added, ctx.Err() is returned.
+func (q *BlockingQueue[T]) Put(ctx context.Context, v T) error {
+	if q.TryPut(v) {
+		return nil
+	}
+	select {
+	case q.ch <- v:
+		q.puts.Add(1)
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// TryPut adds v to the queue if there is room, and reports whether it did.
+func (q *BlockingQueue[T]) TryPut(v T) bool {
+	select {
+	case q.ch <- v:
+		q.puts.Add(1)
+		return true
+	default:
+		q.fullPuts.Add(1)
+		return false
+	}
+}
+
+// Poll removes and returns the first element of the queue, waiting for one to
+// arrive if the queue is empty. If ctx is done before an element arrives,
+// ctx.Err() is returned.
+func (q *BlockingQueue[T]) Poll(ctx context.Context) (T, error) {
+	select {
+	case v := <-q.ch:
+		q.polls.Add(1)
+		return v, nil
+	case <-ctx.Done():
+		var zero T
+		return zero, ctx.Err()
+	}
+}
+
+// TryPoll removes and returns the first element of the queue if there is one.
+// The boolean reports whether an element was returned.
+func (q *BlockingQueue[T]) TryPoll() (T, bool) {
+	select {
+	case v := <-q.ch:
+		q.polls.Add(1)
+		return v, true
+	default:
+		var zero T
+		return zero, false
+	}
+}
+
+// Len returns the number of elements in the queue.
+func (q *BlockingQueue[T]) Len() int {
+	return len(q.ch)
+}
+
+// Cap returns the capacity of the queue.
+func (q *BlockingQueue[T]) Cap() int {
+	return cap(q.ch)
+}
+
+// Stats returns the metrics of the queue. The fields are read individually,
+// so the snapshot may be slightly inconsistent if the queue is in use.
+func (q *BlockingQueue[T]) Stats() QueueStats {
+	return QueueStats{
+		Len:      len(q.ch),
+		Cap:      cap(q.ch),
+		Puts:     q.puts.Load(),
+		Polls:    q.polls.Load(),
+		FullPuts: q.fullPuts.Load(),
+	}
+}
@@ -0,0 +1,52 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package syncx
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestBlockingQueue(t *testing.T) {
+	q := NewBlockingQueue[int](2)
+	ctx := context.Background()
+	q.Put(ctx, 1)
+	if !q.TryPut(2) {
+		t.Fatal("Expected TryPut to succeed with room left")
+	}
+	if q.TryPut(3) {
+		t.Fatal("Expected TryPut to fail on a full queue")
+	}
+	timeout, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if err := q.Put(timeout, 3); err != context.DeadlineExceeded {
+		t.Fatalf("Expected DeadlineExceeded on a full queue, got %v", err)
+	}
+
+	for _, expected := range []int{1, 2} {
+		v, err := q.Poll(ctx)
+		if err != nil || v != expected {
+			t.Fatalf("Expected (%d, nil), got (%d, %v)", expected, v, err)
+		}
+	}
+	if _, ok := q.TryPoll(); ok {
+		t.Fatal("Expected TryPoll to fail on an empty queue")
+	}
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		q.Put(ctx, 4)
+	}()
+	if v, err := q.Poll(ctx); err != nil || v != 4 {
+		t.Fatalf("Expected Poll to wait for (4, nil), got (%d, %v)", v, err)
+	}
+
+	stats := q.Stats()
+	expected := QueueStats{Len: 0, Cap: 2, Puts: 3, Polls: 3, FullPuts: 2}
+	if stats != expected {
+		t.Errorf("Expected stats %+v, got %+v", expected, stats)
+	}
+}
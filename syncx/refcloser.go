@@ -0,0 +1,64 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package syncx
+
+import (
+	"io"
+	"sync"
+
+	"github.com/hypirion/gluten/iox"
+)
+
+// RefCloser is a reference counted io.Closer, used to share a resource between
+// goroutines where no single goroutine owns it. The resource is closed when the
+// last reference is released.
+type RefCloser struct {
+	mut      sync.Mutex
+	refs     int
+	closed   bool
+	resource io.Closer
+}
+
+// NewRefCloser returns a RefCloser over c. The caller holds the first
+// reference, and must release it when done with the resource.
+func NewRefCloser(c io.Closer) *RefCloser {
+	return &RefCloser{refs: 1, resource: c}
+}
+
+// Acquire acquires a new reference to the resource. If the resource is closed,
+// Acquire returns iox.ErrClosed and no reference is acquired.
+func (rc *RefCloser) Acquire() error {
+	rc.mut.Lock()
+	defer rc.mut.Unlock()
+	if rc.closed {
+		return iox.ErrClosed
+	}
+	rc.refs++
+	return nil
+}
+
+// Release releases a reference to the resource. If it was the last one, the
+// resource is closed and the result of closing it is returned. Releasing more
+// references than were acquired panics.
+func (rc *RefCloser) Release() error {
+	rc.mut.Lock()
+	defer rc.mut.Unlock()
+	if rc.refs == 0 {
+		panic("syncx: RefCloser released more times than acquired")
+	}
+	rc.refs--
+	if rc.refs > 0 {
+		return nil
+	}
+	rc.closed = true
+	return rc.resource.Close()
+}
+
+// Refs returns the number of references currently held.
+func (rc *RefCloser) Refs() int {
+	rc.mut.Lock()
+	defer rc.mut.Unlock()
+	return rc.refs
+}
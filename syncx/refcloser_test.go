@@ -0,0 +1,31 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package syncx
+
+import (
+	"testing"
+
+	"github.com/hypirion/gluten/iox"
+)
+
+func TestRefCloser(t *testing.T) {
+	dc := &dummyCloser{}
+	rc := NewRefCloser(dc)
+	if err := rc.Acquire(); err != nil {
+		t.Fatal(err)
+	}
+	if err := rc.Release(); err != nil || dc.closed {
+		t.Fatalf("Expected resource to stay open while referenced, got err %v", err)
+	}
+	if err := rc.Release(); err != nil || !dc.closed {
+		t.Fatalf("Expected resource to be closed on last release, got err %v", err)
+	}
+	if err := rc.Acquire(); !iox.IsErrClosed(err) {
+		t.Fatalf("Expected ErrClosed after close, got %v", err)
+	}
+	if rc.Refs() != 0 {
+		t.Fatalf("Expected no references, got %d", rc.Refs())
+	}
+}
@@ -0,0 +1,45 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package syncx
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// releaseNotifier lets a goroutine wait for the locks of a locker to be
+// released without queuing up as a writer. A queued writer blocks every new
+// reader, which is not acceptable for a writer that may give up.
+type releaseNotifier struct {
+	armed atomic.Bool
+	mut   sync.Mutex
+	ch    chan struct{}
+}
+
+// wait returns a channel which is closed on the next call to notify. Call it
+// before trying to acquire the lock, so that no release is missed.
+func (rn *releaseNotifier) wait() <-chan struct{} {
+	rn.mut.Lock()
+	defer rn.mut.Unlock()
+	if rn.ch == nil {
+		rn.ch = make(chan struct{})
+		rn.armed.Store(true)
+	}
+	return rn.ch
+}
+
+// notify must be called after a lock has been released.
+func (rn *releaseNotifier) notify() {
+	if !rn.armed.Load() {
+		return
+	}
+	rn.mut.Lock()
+	if rn.ch != nil {
+		close(rn.ch)
+		rn.ch = nil
+		rn.armed.Store(false)
+	}
+	rn.mut.Unlock()
+}
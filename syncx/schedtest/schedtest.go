@@ -0,0 +1,248 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package schedtest explores the interleavings of small concurrent scenarios
+// in tests. Goroutines started through a Sched run one at a time, and only
+// switch at explicit yield points, which makes it possible to enumerate every
+// interleaving of those yield points instead of hoping a stress test hits the
+// one that breaks:
+//
+//	schedtest.Explore(t, nil, func(s *schedtest.Sched) {
+//		sl := syncx.NewSuspendLocker(resource, nil)
+//		s.Go(func(g *schedtest.G) {
+//			sl.Suspend()
+//			g.Yield()
+//			sl.Close()
+//		})
+//		s.Go(func(g *schedtest.G) {
+//			if err := sl.RLock(); err == nil {
+//				g.Yield()
+//				sl.RUnlock()
+//			}
+//		})
+//		s.Wait()
+//		// check invariants here
+//	})
+//
+// Goroutines may block on real synchronization primitives. A goroutine which
+// neither yields nor finishes within BlockTimeout is considered blocked, and
+// another goroutine is scheduled; the blocked goroutine rejoins the schedule at
+// its next yield point. Schedules involving blocked goroutines depend on timing
+// and may not replay exactly.
+package schedtest
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+	"time"
+)
+
+// Opts are options that can be passed to Explore.
+type Opts struct {
+	// MaxSchedules is the maximal number of schedules to explore. If unset, the
+	// value is set to 1000.
+	MaxSchedules int
+	// Random makes Explore run random schedules instead of enumerating them
+	// depth first. Use it for scenarios with too many interleavings to
+	// enumerate. Schedule i uses seed i, so runs are reproducible.
+	Random bool
+	// BlockTimeout is how long a goroutine may run without yielding before it
+	// is considered blocked. If unset, the value is set to 5 milliseconds.
+	BlockTimeout time.Duration
+	// DeadlockTimeout is how long Wait waits when all goroutines are blocked,
+	// before it reports a deadlock. If unset, the value is set to one second.
+	DeadlockTimeout time.Duration
+}
+
+// Explore calls scenario once per schedule, until every schedule has been
+// explored, MaxSchedules is reached or the test fails. The failing schedule is
+// logged. Explore returns the number of schedules run. If opts is nil, the
+// default options are used.
+func Explore(tb testing.TB, opts *Opts, scenario func(s *Sched)) int {
+	tb.Helper()
+	var o Opts
+	if opts != nil {
+		o = *opts
+	}
+	if o.MaxSchedules <= 0 {
+		o.MaxSchedules = 1000
+	}
+	if o.BlockTimeout <= 0 {
+		o.BlockTimeout = 5 * time.Millisecond
+	}
+	if o.DeadlockTimeout <= 0 {
+		o.DeadlockTimeout = 1 * time.Second
+	}
+
+	var prefix []int
+	for i := 0; i < o.MaxSchedules; i++ {
+		s := &Sched{
+			tb:     tb,
+			opts:   o,
+			prefix: prefix,
+			events: make(chan event),
+		}
+		if o.Random {
+			s.rng = rand.New(rand.NewSource(int64(i)))
+		}
+		scenario(s)
+		s.Wait()
+		if tb.Failed() {
+			tb.Logf("schedtest: failed on schedule %d: %v", i, s.Schedule())
+			return i + 1
+		}
+		if !o.Random {
+			var ok bool
+			if prefix, ok = s.next(); !ok {
+				return i + 1
+			}
+		}
+	}
+	return o.MaxSchedules
+}
+
+type choice struct {
+	n      int
+	picked int
+}
+
+type event struct {
+	g    *G
+	done bool
+}
+
+// Sched schedules the goroutines of a single run of a scenario.
+type Sched struct {
+	tb      testing.TB
+	opts    Opts
+	rng     *rand.Rand
+	prefix  []int
+	taken   []choice
+	events  chan event
+	waiting []*G
+	live    int
+	nextID  int
+}
+
+// G is a goroutine started through Sched.Go.
+type G struct {
+	s    *Sched
+	id   int
+	wake chan struct{}
+}
+
+// Go starts f in a new goroutine, which runs when the scheduler picks it.
+func (s *Sched) Go(f func(g *G)) {
+	g := &G{s: s, id: s.nextID, wake: make(chan struct{})}
+	s.nextID++
+	s.live++
+	s.waiting = append(s.waiting, g)
+	go func() {
+		<-g.wake
+		f(g)
+		s.events <- event{g: g, done: true}
+	}()
+}
+
+// Yield is a scheduling point: The scheduler may switch to another goroutine
+// here.
+func (g *G) Yield() {
+	g.s.events <- event{g: g}
+	<-g.wake
+}
+
+// ID returns the index of the goroutine, in the order it was started.
+func (g *G) ID() int {
+	return g.id
+}
+
+func (s *Sched) handle(ev event) {
+	if ev.done {
+		s.live--
+		return
+	}
+	s.waiting = append(s.waiting, ev.g)
+}
+
+// pick removes and returns the next goroutine to run from the waiting list.
+func (s *Sched) pick() *G {
+	sort.Slice(s.waiting, func(i, j int) bool { return s.waiting[i].id < s.waiting[j].id })
+	n := len(s.waiting)
+	idx := 0
+	if n > 1 {
+		pos := len(s.taken)
+		switch {
+		case pos < len(s.prefix):
+			idx = s.prefix[pos]
+			if n <= idx {
+				idx = n - 1
+			}
+		case s.rng != nil:
+			idx = s.rng.Intn(n)
+		}
+		s.taken = append(s.taken, choice{n: n, picked: idx})
+	}
+	g := s.waiting[idx]
+	s.waiting = append(s.waiting[:idx], s.waiting[idx+1:]...)
+	return g
+}
+
+// Wait runs the goroutines started through Go until all of them have
+// finished. It reports a deadlock through the test if all remaining goroutines
+// are blocked for longer than DeadlockTimeout.
+func (s *Sched) Wait() {
+	for s.live > 0 {
+		if len(s.waiting) == 0 {
+			select {
+			case ev := <-s.events:
+				s.handle(ev)
+			case <-time.After(s.opts.DeadlockTimeout):
+				s.tb.Errorf("schedtest: deadlock, %d goroutines blocked", s.live)
+				return
+			}
+			continue
+		}
+		g := s.pick()
+		g.wake <- struct{}{}
+		timer := time.NewTimer(s.opts.BlockTimeout)
+	running:
+		for {
+			select {
+			case ev := <-s.events:
+				s.handle(ev)
+				if ev.g == g {
+					break running
+				}
+			case <-timer.C:
+				// g is blocked, let someone else run
+				break running
+			}
+		}
+		timer.Stop()
+	}
+}
+
+// Schedule returns the choices made by the scheduler so far, as indices into
+// the goroutines waiting at each scheduling point, sorted by ID.
+func (s *Sched) Schedule() []int {
+	schedule := make([]int, len(s.taken))
+	for i, c := range s.taken {
+		schedule[i] = c.picked
+	}
+	return schedule
+}
+
+// next returns the prefix of the next schedule in depth first order, or false
+// if all schedules have been explored.
+func (s *Sched) next() ([]int, bool) {
+	for i := len(s.taken) - 1; i >= 0; i-- {
+		if s.taken[i].picked+1 < s.taken[i].n {
+			prefix := s.Schedule()[:i+1]
+			prefix[i]++
+			return prefix, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,52 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package schedtest
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestExploreFindsLostUpdate(t *testing.T) {
+	outcomes := map[int]int{}
+	n := Explore(t, nil, func(s *Sched) {
+		x := 0
+		for i := 0; i < 2; i++ {
+			s.Go(func(g *G) {
+				v := x
+				g.Yield()
+				x = v + 1
+			})
+		}
+		s.Wait()
+		outcomes[x]++
+	})
+	if outcomes[1] == 0 || outcomes[2] == 0 {
+		t.Errorf("Expected both the lost update and the correct result, got %v", outcomes)
+	}
+	if n != outcomes[1]+outcomes[2] || n > 10 {
+		t.Errorf("Expected a small, exhaustive exploration, but ran %d schedules", n)
+	}
+}
+
+func TestExploreWithBlockingLocks(t *testing.T) {
+	Explore(t, &Opts{Random: true, MaxSchedules: 20}, func(s *Sched) {
+		var mut sync.Mutex
+		x := 0
+		for i := 0; i < 3; i++ {
+			s.Go(func(g *G) {
+				mut.Lock()
+				v := x
+				g.Yield()
+				x = v + 1
+				mut.Unlock()
+			})
+		}
+		s.Wait()
+		if x != 3 {
+			t.Errorf("Expected mutex to prevent lost updates, got %d", x)
+		}
+	})
+}
@@ -0,0 +1,116 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package singleflight provides duplicate call suppression.
+//
+// Unlike golang.org/x/sync/singleflight, the Group is typed, every caller may
+// give up on its own context without affecting the others, and results may be
+// shared for a while after the call has finished.
+package singleflight
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Group deduplicates concurrent calls with the same key. The zero value is
+// ready to use. A Group must not be copied after first use.
+type Group[K comparable, V any] struct {
+	// TTL is the duration successful results are shared with subsequent callers
+	// after the call has finished. If zero, results are only shared with callers
+	// arriving while the call is in flight. Errors are never shared after the
+	// call has finished.
+	TTL time.Duration
+
+	mut   sync.Mutex
+	calls map[K]*call[V]
+}
+
+type call[V any] struct {
+	done    chan struct{}
+	cancel  context.CancelFunc
+	waiters int
+	val     V
+	err     error
+}
+
+// Do calls fn and returns its result, unless a call with the same key is in
+// flight or its result is still shared, in which case that result is returned
+// instead.
+//
+// fn runs in its own goroutine with a context that is not tied to any single
+// caller: If ctx is done before fn finishes, Do returns ctx.Err() immediately,
+// and fn's context is only cancelled once every caller waiting for it has
+// given up. Values from ctx are passed on to fn's context.
+func (g *Group[K, V]) Do(ctx context.Context, key K, fn func(context.Context) (V, error)) (V, error) {
+	g.mut.Lock()
+	if g.calls == nil {
+		g.calls = make(map[K]*call[V])
+	}
+	c, ok := g.calls[key]
+	if !ok {
+		cctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		c = &call[V]{done: make(chan struct{}), cancel: cancel}
+		g.calls[key] = c
+		go g.run(cctx, key, c, fn)
+	}
+	c.waiters++
+	g.mut.Unlock()
+
+	select {
+	case <-c.done:
+		return c.val, c.err
+	case <-ctx.Done():
+	}
+
+	g.mut.Lock()
+	c.waiters--
+	select {
+	case <-c.done:
+	default:
+		if c.waiters == 0 {
+			c.cancel()
+			g.forget(key, c)
+		}
+	}
+	g.mut.Unlock()
+	var zero V
+	return zero, ctx.Err()
+}
+
+func (g *Group[K, V]) run(ctx context.Context, key K, c *call[V], fn func(context.Context) (V, error)) {
+	val, err := fn(ctx)
+	g.mut.Lock()
+	defer g.mut.Unlock()
+	c.val, c.err = val, err
+	close(c.done)
+	c.cancel()
+	if err != nil || g.TTL <= 0 {
+		g.forget(key, c)
+		return
+	}
+	time.AfterFunc(g.TTL, func() {
+		g.mut.Lock()
+		defer g.mut.Unlock()
+		g.forget(key, c)
+	})
+}
+
+// forget removes c from the group, unless it has already been replaced. Must
+// be called while holding mut.
+func (g *Group[K, V]) forget(key K, c *call[V]) {
+	if g.calls[key] == c {
+		delete(g.calls, key)
+	}
+}
+
+// Forget makes the next call to Do with key call fn, even if a call with that
+// key is in flight or its result is still shared. Callers already waiting for
+// the call in flight still receive its result.
+func (g *Group[K, V]) Forget(key K) {
+	g.mut.Lock()
+	defer g.mut.Unlock()
+	delete(g.calls, key)
+}
@@ -0,0 +1,125 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package singleflight
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDoDeduplicates(t *testing.T) {
+	var g Group[string, int]
+	var calls int32
+	release := make(chan struct{})
+	fn := func(ctx context.Context) (int, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return 42, nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, err := g.Do(context.Background(), "key", fn)
+			if v != 42 || err != nil {
+				t.Errorf("Expected (42, nil), got (%d, %v)", v, err)
+			}
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if calls != 1 {
+		t.Errorf("Expected fn to be called once, but was called %d times", calls)
+	}
+}
+
+func TestDoCallerCancel(t *testing.T) {
+	var g Group[string, int]
+	started := make(chan struct{})
+	release := make(chan struct{})
+	fn := func(ctx context.Context) (int, error) {
+		close(started)
+		select {
+		case <-release:
+			return 1, nil
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+	}
+
+	res := make(chan error, 1)
+	go func() {
+		_, err := g.Do(context.Background(), "key", fn)
+		res <- err
+	}()
+	<-started
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := g.Do(ctx, "key", fn); err != context.Canceled {
+		t.Errorf("Expected cancelled caller to get context.Canceled, got %v", err)
+	}
+	close(release)
+	if err := <-res; err != nil {
+		t.Errorf("Expected other caller to be unaffected, got %v", err)
+	}
+}
+
+func TestDoLastCallerCancelsCall(t *testing.T) {
+	var g Group[string, int]
+	cancelled := make(chan struct{})
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	_, err := g.Do(ctx, "key", func(ctx context.Context) (int, error) {
+		<-ctx.Done()
+		close(cancelled)
+		return 0, ctx.Err()
+	})
+	if err != context.Canceled {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+	select {
+	case <-cancelled:
+	case <-time.After(1 * time.Second):
+		t.Error("Expected call to be cancelled when its only caller gave up")
+	}
+}
+
+func TestDoTTL(t *testing.T) {
+	g := Group[string, int]{TTL: 30 * time.Millisecond}
+	var calls int32
+	fn := func(ctx context.Context) (int, error) {
+		return int(atomic.AddInt32(&calls, 1)), nil
+	}
+	v1, _ := g.Do(context.Background(), "key", fn)
+	v2, _ := g.Do(context.Background(), "key", fn)
+	if v1 != 1 || v2 != 1 {
+		t.Errorf("Expected result to be shared within TTL, got %d and %d", v1, v2)
+	}
+	time.Sleep(60 * time.Millisecond)
+	if v, _ := g.Do(context.Background(), "key", fn); v != 2 {
+		t.Errorf("Expected new call after TTL, got %d", v)
+	}
+
+	failing := func(ctx context.Context) (int, error) {
+		atomic.AddInt32(&calls, 1)
+		return 0, errors.New("failed")
+	}
+	g.Do(context.Background(), "err", failing)
+	g.Do(context.Background(), "err", failing)
+	if calls != 4 {
+		t.Errorf("Expected errors not to be shared after the call, but fn was called %d times", calls)
+	}
+}
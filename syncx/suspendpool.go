@@ -0,0 +1,133 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package syncx
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/hypirion/gluten/iox"
+)
+
+// SuspendPool manages a set of SuspendLockers and bounds how many of them may
+// be resumed simultaneously. When a resume makes the pool exceed its cap, the
+// least recently used lockers are suspended in the background. This bounds
+// aggregate resource usage in cases where per-resource idle timers cannot,
+// e.g. with hundreds of per-tenant database connections.
+//
+// The cap is soft: A locker with active readers is suspended only once its
+// readers have released the read lock, and a suspended locker is resumed on
+// the next RLock regardless of the cap.
+type SuspendPool struct {
+	mut        sync.Mutex
+	maxResumed int
+	lockers    map[string]inspectableSuspendLocker
+	enforcing  bool
+	pending    bool
+}
+
+// NewSuspendPool returns a new SuspendPool which keeps at most maxResumed
+// lockers resumed.
+func NewSuspendPool(maxResumed int) *SuspendPool {
+	if maxResumed <= 0 {
+		panic("syncx: SuspendPool cap must be positive")
+	}
+	return &SuspendPool{
+		maxResumed: maxResumed,
+		lockers:    make(map[string]inspectableSuspendLocker),
+	}
+}
+
+// NewLocker creates a SuspendLocker over s with the given options, and adds it
+// to the pool under name, replacing any locker previously added under that
+// name. If opts is nil, the default options are used.
+func (p *SuspendPool) NewLocker(name string, s iox.Suspender, opts *SuspendLockerOpts) SuspendLocker {
+	var o SuspendLockerOpts
+	if opts != nil {
+		o = *opts
+	}
+	onResume := o.OnResume
+	o.OnResume = func(err error) {
+		if onResume != nil {
+			onResume(err)
+		}
+		if err == nil {
+			p.enforce()
+		}
+	}
+	sl := newLocker(s, &o)
+	p.mut.Lock()
+	p.lockers[name] = sl
+	p.mut.Unlock()
+	if sl.State() == StateResumed {
+		p.enforce()
+	}
+	return sl
+}
+
+// Remove removes the locker with the given name from the pool. The locker is
+// not closed.
+func (p *SuspendPool) Remove(name string) {
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	delete(p.lockers, name)
+}
+
+// Resumed returns the number of resumed lockers in the pool.
+func (p *SuspendPool) Resumed() int {
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	n := 0
+	for _, sl := range p.lockers {
+		if sl.State() == StateResumed {
+			n++
+		}
+	}
+	return n
+}
+
+// enforce suspends the least recently used lockers in the background until the
+// cap is met. Concurrent calls are coalesced into a single run.
+func (p *SuspendPool) enforce() {
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	if p.enforcing {
+		p.pending = true
+		return
+	}
+	p.enforcing = true
+	go p.runEnforce()
+}
+
+func (p *SuspendPool) runEnforce() {
+	for {
+		p.mut.Lock()
+		p.pending = false
+		var resumed []inspectableSuspendLocker
+		for _, sl := range p.lockers {
+			if sl.State() == StateResumed {
+				resumed = append(resumed, sl)
+			}
+		}
+		p.mut.Unlock()
+
+		if excess := len(resumed) - p.maxResumed; excess > 0 {
+			sort.Slice(resumed, func(i, j int) bool {
+				return resumed[i].LastUsed().Before(resumed[j].LastUsed())
+			})
+			for _, sl := range resumed[:excess] {
+				sl.Suspend()
+			}
+		}
+
+		p.mut.Lock()
+		if !p.pending {
+			p.enforcing = false
+			p.mut.Unlock()
+			return
+		}
+		p.mut.Unlock()
+	}
+}
@@ -0,0 +1,46 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package syncx
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestSuspendPool(t *testing.T) {
+	pool := NewSuspendPool(2)
+	var lockers []SuspendLocker
+	for i := 0; i < 4; i++ {
+		sl := pool.NewLocker(fmt.Sprint(i), &dummySuspender{suspendState: suspendStateSuspended},
+			&SuspendLockerOpts{AlreadySuspended: true})
+		lockers = append(lockers, sl)
+	}
+	for _, sl := range lockers {
+		if err := sl.RLock(); err != nil {
+			t.Fatal(err)
+		}
+		sl.RUnlock()
+		time.Sleep(1 * time.Millisecond)
+	}
+
+	deadline := time.Now().Add(1 * time.Second)
+	for pool.Resumed() > 2 && time.Now().Before(deadline) {
+		time.Sleep(1 * time.Millisecond)
+	}
+	if n := pool.Resumed(); n != 2 {
+		t.Fatalf("Expected 2 resumed lockers, got %d", n)
+	}
+	// the least recently used lockers are the ones to go
+	for i, sl := range lockers {
+		expected := StateSuspended
+		if 2 <= i {
+			expected = StateResumed
+		}
+		if state := sl.(SuspendInspector).State(); state != expected {
+			t.Errorf("Expected locker %d to be %s, was %s", i, expected, state)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package syncx
+
+import (
+	"io"
+	"sync"
+
+	"github.com/hypirion/gluten/iox"
+)
+
+// SwapLocker holds a resource which can be hot-replaced while in use, for
+// example to rotate connections bearing credentials without downtime. Readers
+// acquire a handle to the current resource, and keep using that resource until
+// they release the handle, even if it has been swapped out in the meantime. A
+// swapped out resource is closed once its last handle is released.
+//
+// A SwapLocker is safe for concurrent use.
+type SwapLocker[T io.Closer] struct {
+	mut    sync.Mutex
+	cur    *swapEntry[T]
+	closed bool
+}
+
+type swapEntry[T io.Closer] struct {
+	resource T
+	refs     int
+	retired  bool
+}
+
+// SwapHandle is a handle to a resource acquired from a SwapLocker.
+type SwapHandle[T io.Closer] struct {
+	sl       *SwapLocker[T]
+	entry    *swapEntry[T]
+	released bool
+}
+
+// NewSwapLocker returns a SwapLocker holding resource.
+func NewSwapLocker[T io.Closer](resource T) *SwapLocker[T] {
+	return &SwapLocker[T]{cur: &swapEntry[T]{resource: resource}}
+}
+
+// Acquire returns a handle to the current resource, which must be released
+// when the caller is done with the resource. If the locker is closed, Acquire
+// returns iox.ErrClosed.
+func (sl *SwapLocker[T]) Acquire() (*SwapHandle[T], error) {
+	sl.mut.Lock()
+	defer sl.mut.Unlock()
+	if sl.closed {
+		return nil, iox.ErrClosed
+	}
+	sl.cur.refs++
+	return &SwapHandle[T]{sl: sl, entry: sl.cur}, nil
+}
+
+// Swap replaces the current resource with resource. The old resource is closed
+// once all handles to it are released. If there are none, it is closed right
+// away and the result of closing it is returned. If the locker is closed, the
+// resource is not swapped in and Swap returns iox.ErrClosed.
+func (sl *SwapLocker[T]) Swap(resource T) error {
+	sl.mut.Lock()
+	if sl.closed {
+		sl.mut.Unlock()
+		return iox.ErrClosed
+	}
+	old := sl.cur
+	sl.cur = &swapEntry[T]{resource: resource}
+	unused := sl.retire(old)
+	sl.mut.Unlock()
+	if unused {
+		return old.resource.Close()
+	}
+	return nil
+}
+
+// Close closes the locker. The current resource is closed once all handles to
+// it are released. If there are none, it is closed right away and the result of
+// closing it is returned. Closing a closed locker does nothing.
+func (sl *SwapLocker[T]) Close() error {
+	sl.mut.Lock()
+	if sl.closed {
+		sl.mut.Unlock()
+		return nil
+	}
+	sl.closed = true
+	unused := sl.retire(sl.cur)
+	sl.mut.Unlock()
+	if unused {
+		return sl.cur.resource.Close()
+	}
+	return nil
+}
+
+// retire marks e as retired, and returns true if it should be closed right
+// away. Must be called while holding the mutex.
+func (sl *SwapLocker[T]) retire(e *swapEntry[T]) bool {
+	e.retired = true
+	return e.refs == 0
+}
+
+// Resource returns the resource the handle refers to. It must not be used after
+// the handle is released.
+func (h *SwapHandle[T]) Resource() T {
+	return h.entry.resource
+}
+
+// Release releases the handle. If the resource has been swapped out or the
+// locker closed, and this was the last handle to the resource, the resource is
+// closed and the result of closing it is returned. Releasing a handle more
+// than once panics.
+func (h *SwapHandle[T]) Release() error {
+	sl := h.sl
+	sl.mut.Lock()
+	if h.released {
+		sl.mut.Unlock()
+		panic("syncx: SwapHandle released twice")
+	}
+	h.released = true
+	h.entry.refs--
+	unused := h.entry.retired && h.entry.refs == 0
+	sl.mut.Unlock()
+	if unused {
+		return h.entry.resource.Close()
+	}
+	return nil
+}
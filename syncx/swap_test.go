@@ -0,0 +1,55 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package syncx
+
+import (
+	"testing"
+
+	"github.com/hypirion/gluten/iox"
+)
+
+func TestSwapLocker(t *testing.T) {
+	first, second, third := &dummyCloser{}, &dummyCloser{}, &dummyCloser{}
+	sl := NewSwapLocker(first)
+
+	h, err := sl.Acquire()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sl.Swap(second); err != nil {
+		t.Fatal(err)
+	}
+	if h.Resource() != first || first.closed {
+		t.Fatal("Expected reader to keep using the old resource until released")
+	}
+	h2, _ := sl.Acquire()
+	if h2.Resource() != second {
+		t.Fatal("Expected new readers to get the new resource")
+	}
+	if err := h.Release(); err != nil || !first.closed {
+		t.Fatalf("Expected old resource to be closed on last release, got %v", err)
+	}
+	if err := h2.Release(); err != nil || second.closed {
+		t.Fatal("Expected current resource to stay open after release")
+	}
+	if err := sl.Swap(third); err != nil || !second.closed {
+		t.Fatal("Expected unused resource to be closed right away on swap")
+	}
+
+	h3, _ := sl.Acquire()
+	if err := sl.Close(); err != nil || third.closed {
+		t.Fatal("Expected Close to wait for the resource to be released")
+	}
+	if _, err := sl.Acquire(); !iox.IsErrClosed(err) {
+		t.Fatalf("Expected ErrClosed, got %v", err)
+	}
+	if err := sl.Swap(&dummyCloser{}); !iox.IsErrClosed(err) {
+		t.Fatalf("Expected ErrClosed, got %v", err)
+	}
+	h3.Release()
+	if !third.closed {
+		t.Fatal("Expected resource to be closed once released after Close")
+	}
+}
@@ -7,8 +7,12 @@
 package syncx
 
 import (
+	"context"
 	"io"
+	"math/rand"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/hypirion/gluten/iox"
@@ -19,7 +23,8 @@ import (
 // interface on top of the resource, along with the read-write lock.
 //
 // CloseLockers are typically used inside other types which wrap a closeable
-// resource.
+// resource. The CloseLockers from this package also implement TryLocker,
+// ReaderEvicter, CloseNotifier and CloseWaiter.
 type CloseLocker interface {
 	io.Closer
 	// Lock acquires write lock on this locker.
@@ -37,27 +42,66 @@ type rawCloseLocker struct {
 	mut      sync.RWMutex
 	closed   bool
 	resource io.Closer
+	evicter  evicter
+	hooks    closeHooks
+	readers  atomic.Int32
+	released releaseNotifier
 }
 
 func (rcl *rawCloseLocker) Close() error {
 	rcl.Lock()
-	defer rcl.Unlock()
+	return rcl.closeLocked()
+}
+
+func (rcl *rawCloseLocker) CloseWait(ctx context.Context) (int, error) {
+	// Blocking in Lock would queue a writer that blocks all new readers until
+	// the outstanding ones are done, even after ctx is done. Instead, retry
+	// TryLock whenever a lock is released.
+	for {
+		released := rcl.released.wait()
+		if rcl.TryLock() {
+			return 0, rcl.closeLocked()
+		}
+		select {
+		case <-released:
+		case <-ctx.Done():
+			return int(rcl.readers.Load()), ctx.Err()
+		}
+	}
+}
+
+// closeLocked closes the resource and releases the write lock, which must be
+// held by the caller.
+func (rcl *rawCloseLocker) closeLocked() error {
 	if rcl.closed {
+		rcl.Unlock()
 		return nil
 	}
 	err := rcl.resource.Close()
 	if err == nil {
 		rcl.closed = true
 	}
+	rcl.Unlock()
+	rcl.hooks.run(err)
 	return err
 }
 
+func (rcl *rawCloseLocker) OnClose(f func()) {
+	rcl.hooks.onClose(f)
+}
+
+func (rcl *rawCloseLocker) OnCloseFailure(f func(err error)) {
+	rcl.hooks.onCloseFailure(f)
+}
+
 func (rcl *rawCloseLocker) Lock() {
 	rcl.mut.Lock()
+	rcl.evicter.reset()
 }
 
 func (rcl *rawCloseLocker) Unlock() {
 	rcl.mut.Unlock()
+	rcl.released.notify()
 }
 
 func (rcl *rawCloseLocker) RLock() error {
@@ -66,11 +110,42 @@ func (rcl *rawCloseLocker) RLock() error {
 		rcl.mut.RUnlock()
 		return iox.ErrClosed
 	}
+	rcl.readers.Add(1)
 	return nil
 }
 
 func (rcl *rawCloseLocker) RUnlock() {
+	rcl.readers.Add(-1)
 	rcl.mut.RUnlock()
+	rcl.released.notify()
+}
+
+func (rcl *rawCloseLocker) TryLock() bool {
+	if !rcl.mut.TryLock() {
+		return false
+	}
+	rcl.evicter.reset()
+	return true
+}
+
+func (rcl *rawCloseLocker) TryRLock() (bool, error) {
+	if !rcl.mut.TryRLock() {
+		return false, nil
+	}
+	if rcl.closed {
+		rcl.mut.RUnlock()
+		return false, iox.ErrClosed
+	}
+	rcl.readers.Add(1)
+	return true, nil
+}
+
+func (rcl *rawCloseLocker) EvictReaders(reason error) {
+	rcl.evicter.evict(reason)
+}
+
+func (rcl *rawCloseLocker) ReaderContext() context.Context {
+	return rcl.evicter.readerContext()
 }
 
 // NewCloseLocker returns a new CloserLocker over c.
@@ -83,7 +158,9 @@ func NewCloseLocker(c io.Closer) CloseLocker {
 // interface on top of the resource, along with a read-write lock.
 //
 // SuspendLockers are typically used inside other types which wrap a suspendable
-// resource.
+// resource. The SuspendLockers from this package also implement ReaderEvicter,
+// SuspendInspector, Warmer, ContextRLocker, CapacityLocker and iox.Readier, and
+// implement Leaser if they were created with a MaxIdleTime.
 type SuspendLocker interface {
 	iox.Suspender
 	// Lock acquires write lock on this locker. Note that any iox.Suspender calls
@@ -102,6 +179,31 @@ type SuspendLocker interface {
 	RUnlock()
 }
 
+// SuspendState is the state of the resource of a SuspendLocker.
+type SuspendState uint32
+
+const (
+	// StateResumed means the resource is in use or ready to be used.
+	StateResumed SuspendState = iota
+	// StateSuspended means the resource is suspended, and will be resumed on
+	// the next read lock.
+	StateSuspended
+	// StateClosed means the resource is closed.
+	StateClosed
+)
+
+func (s SuspendState) String() string {
+	switch s {
+	case StateResumed:
+		return "resumed"
+	case StateSuspended:
+		return "suspended"
+	case StateClosed:
+		return "closed"
+	}
+	return "SuspendState(" + strconv.Itoa(int(s)) + ")"
+}
+
 // SuspendLockerOpts is a struct different options you can provide while
 // creating a SuspendLocker. You can provide nil if you want the default
 // behaviour.
@@ -112,10 +214,53 @@ type SuspendLockerOpts struct {
 	// If set, MaxIdleTime will be the maximal time the Suspender will be open
 	// after a call to [R]Lock.
 	MaxIdleTime time.Duration
+	// MinOpenTime is the minimal time the Suspender stays resumed after it has
+	// been resumed, even if it is idle for longer than MaxIdleTime. Use it to
+	// avoid suspending a resource right after an expensive resume. Only used if
+	// MaxIdleTime is set.
+	MinOpenTime time.Duration
+	// SuspendJitter adds a random duration between 0 and SuspendJitter to every
+	// idle period, so that many lockers created at the same time do not suspend
+	// and resume in lockstep. Only used if MaxIdleTime is set.
+	SuspendJitter time.Duration
+	// WarmHoldTime is the minimal time the Suspender stays resumed after a call
+	// to Warm, so that a warmed resource is not suspended before the load it was
+	// warmed for arrives. Only used if MaxIdleTime is set.
+	WarmHoldTime time.Duration
+	// OnSuspend, if set, is called after every attempt to suspend the resource,
+	// with the error from the Suspender. auto is true if the suspend was
+	// triggered by MaxIdleTime, in which case the error is otherwise lost. It is
+	// called after the write lock has been released.
+	OnSuspend func(auto bool, err error)
+	// OnResume, if set, is called after every attempt to resume the resource,
+	// with the error from the Suspender. It is called after the write lock has
+	// been released.
+	OnResume func(err error)
+	// ReadyProbe, if set, is a health probe run by Ready after the resource has
+	// been resumed, while holding a read lock. The lockers from this package are
+	// iox.Readiers: Ready resumes the resource like Warm, then runs the probe.
+	// It returns nil if the resource is ready, and an *iox.ReadyError with the
+	// stage that failed otherwise: "closed", "resume" or "probe".
+	ReadyProbe func(ctx context.Context) error
+	// Capacity is the total capacity of the resource, shared by the readers
+	// acquiring the read lock through RLockN. If zero, the capacity is
+	// unlimited.
+	Capacity int64
 }
 
 // NewSuspendLocker returns a SuspendLocker over s.
 func NewSuspendLocker(s iox.Suspender, slo *SuspendLockerOpts) SuspendLocker {
+	return newLocker(s, slo)
+}
+
+// inspectableSuspendLocker is implemented by the SuspendLockers from this
+// package.
+type inspectableSuspendLocker interface {
+	SuspendLocker
+	SuspendInspector
+}
+
+func newLocker(s iox.Suspender, slo *SuspendLockerOpts) inspectableSuspendLocker {
 	if slo == nil {
 		slo = &SuspendLockerOpts{}
 	}
@@ -126,10 +271,19 @@ func NewSuspendLocker(s iox.Suspender, slo *SuspendLockerOpts) SuspendLocker {
 }
 
 func newSuspendLocker(s iox.Suspender, slo *SuspendLockerOpts) *rawSuspendLocker {
-	return &rawSuspendLocker{
+	rsl := &rawSuspendLocker{
 		resource:  s,
 		suspended: slo.AlreadySuspended,
+		onSuspend: slo.OnSuspend,
+		onResume:  slo.OnResume,
+		probe:     slo.ReadyProbe,
 	}
+	rsl.capacity.cap = slo.Capacity
+	rsl.ctxResource, _ = s.(iox.ContextSuspender)
+	if slo.AlreadySuspended {
+		rsl.state.Store(uint32(StateSuspended))
+	}
+	return rsl
 }
 
 // TODO: Embed CloseLocker inside this one? Or not? Duplication of the resouce
@@ -139,55 +293,149 @@ type rawSuspendLocker struct {
 	closed    bool
 	suspended bool
 	resource  iox.Suspender
+	// ctxResource is the resource as an iox.ContextSuspender, or nil if it
+	// doesn't implement it.
+	ctxResource iox.ContextSuspender
+	evicter     evicter
+	// state mirrors closed and suspended, so that it can be read without the
+	// lock.
+	state        AtomicEnum
+	lastUsed     AtomicTime
+	resumedAt    AtomicTime
+	suspendCount atomic.Uint64
+	resumeCount  atomic.Uint64
+	onSuspend    func(auto bool, err error)
+	onResume     func(err error)
+	probe        func(ctx context.Context) error
+	capacity     capacityGate
 }
 
 func (rsl *rawSuspendLocker) Close() error {
-	rsl.Lock()
+	rsl.lock()
 	defer rsl.Unlock()
 	if rsl.closed {
 		return nil
 	}
-	err := rsl.resource.Close()
+	var err error
+	if rsl.ctxResource != nil {
+		err = rsl.ctxResource.CloseContext(context.Background())
+	} else {
+		err = rsl.resource.Close()
+	}
 	if err == nil {
 		rsl.closed = true
+		rsl.state.Store(uint32(StateClosed))
 	}
 	return err
 }
 
 func (rsl *rawSuspendLocker) Suspend() error {
-	rsl.Lock()
-	defer rsl.Unlock()
+	return rsl.suspend(false)
+}
+
+func (rsl *rawSuspendLocker) suspend(auto bool) error {
+	rsl.lock()
 	if rsl.closed {
+		rsl.Unlock()
 		return iox.ErrClosed
 	}
 	if rsl.suspended {
+		rsl.Unlock()
 		return nil
 	}
-	err := rsl.resource.Suspend()
+	var err error
+	if rsl.ctxResource != nil {
+		err = rsl.ctxResource.SuspendContext(context.Background())
+	} else {
+		err = rsl.resource.Suspend()
+	}
 	if err == nil {
 		rsl.suspended = true
+		rsl.state.Store(uint32(StateSuspended))
+		rsl.suspendCount.Add(1)
+	}
+	rsl.Unlock()
+	if rsl.onSuspend != nil {
+		rsl.onSuspend(auto, err)
 	}
 	return err
 }
 
 func (rsl *rawSuspendLocker) Resume() error {
-	rsl.Lock()
-	defer rsl.Unlock()
+	return rsl.resume(context.Background())
+}
+
+// resume resumes the resource, bounded by ctx if the resource is an
+// iox.ContextSuspender.
+func (rsl *rawSuspendLocker) resume(ctx context.Context) error {
+	rsl.lock()
+	return rsl.resumeLocked(ctx)
+}
+
+// resumeContext is like resume, but gives up waiting for the write lock when
+// ctx is done. It does not take the write lock at all if the resource is
+// already resumed, so it doesn't wait for readers in that case.
+func (rsl *rawSuspendLocker) resumeContext(ctx context.Context) error {
+	if rsl.State() == StateResumed {
+		return nil
+	}
+	locked := make(chan struct{})
+	go func() {
+		rsl.lock()
+		close(locked)
+	}()
+	select {
+	case <-locked:
+	case <-ctx.Done():
+		go func() {
+			<-locked
+			rsl.Unlock()
+		}()
+		return ctx.Err()
+	}
+	return rsl.resumeLocked(ctx)
+}
+
+// resumeLocked resumes the resource and releases the write lock, which must be
+// held by the caller.
+func (rsl *rawSuspendLocker) resumeLocked(ctx context.Context) error {
 	if rsl.closed {
+		rsl.Unlock()
 		return iox.ErrClosed
 	}
 	if !rsl.suspended {
+		rsl.Unlock()
 		return nil
 	}
-	err := rsl.resource.Resume()
+	var err error
+	if rsl.ctxResource != nil {
+		err = rsl.ctxResource.ResumeContext(ctx)
+	} else {
+		err = rsl.resource.Resume()
+	}
 	if err == nil {
 		rsl.suspended = false
+		rsl.state.Store(uint32(StateResumed))
+		rsl.resumedAt.Store(time.Now())
+		rsl.resumeCount.Add(1)
+	}
+	rsl.Unlock()
+	if rsl.onResume != nil {
+		rsl.onResume(err)
 	}
 	return err
 }
 
 func (rsl *rawSuspendLocker) Lock() {
+	rsl.lock()
+	rsl.lastUsed.Store(time.Now())
+}
+
+// lock acquires the write lock without marking the locker as used, for the
+// Suspender calls.
+func (rsl *rawSuspendLocker) lock() {
 	rsl.mut.Lock()
+	rsl.evicter.reset()
 }
 
 func (rsl *rawSuspendLocker) Unlock() {
@@ -214,6 +462,7 @@ func (rsl *rawSuspendLocker) RLock() error {
 		}
 		break
 	}
+	rsl.lastUsed.Store(time.Now())
 	return nil
 }
 
@@ -221,21 +470,228 @@ func (rsl *rawSuspendLocker) RUnlock() {
 	rsl.mut.RUnlock()
 }
 
-func newAutoSuspendLocker(s iox.Suspender, slo *SuspendLockerOpts) SuspendLocker {
-	locker := newSuspendLocker(s, slo)
-	trySuspend := func() { locker.Suspend() }
-	return &autoSuspendLocker{
-		rawSuspendLocker: locker,
+func (rsl *rawSuspendLocker) RLockContext(ctx context.Context) error {
+	return rsl.rlockContext(ctx, rsl.RLock)
+}
+
+// rlockContext acquires the read lock through rlock, unless ctx is done first.
+func (rsl *rawSuspendLocker) rlockContext(ctx context.Context, rlock func() error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	// Fast path: The resource is resumed and the lock is not contended.
+	if rsl.mut.TryRLock() {
+		if !rsl.closed && !rsl.suspended {
+			rsl.lastUsed.Store(time.Now())
+			return nil
+		}
+		rsl.mut.RUnlock()
+	}
+	if rsl.ctxResource != nil {
+		// Resume within ctx, so that rlock below is unlikely to have to.
+		if err := rsl.resumeContext(ctx); err != nil {
+			return err
+		}
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- rlock()
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+	}
+	select {
+	case err := <-done: // acquired right at the deadline
+		return err
+	default:
+	}
+	go func() {
+		if err := <-done; err == nil {
+			rsl.RUnlock()
+		}
+	}()
+	return ctx.Err()
+}
+
+func (rsl *rawSuspendLocker) RLockN(ctx context.Context, n int64) error {
+	return rsl.rlockN(ctx, n, rsl.RLock)
+}
+
+// rlockN acquires n capacity, then the read lock through rlock.
+func (rsl *rawSuspendLocker) rlockN(ctx context.Context, n int64, rlock func() error) error {
+	if err := rsl.capacity.acquire(ctx, n); err != nil {
+		return err
+	}
+	if err := rlock(); err != nil {
+		rsl.capacity.release(n)
+		return err
+	}
+	return nil
+}
+
+func (rsl *rawSuspendLocker) RUnlockN(n int64) {
+	rsl.RUnlock()
+	rsl.capacity.release(n)
+}
+
+func (rsl *rawSuspendLocker) EvictReaders(reason error) {
+	rsl.evicter.evict(reason)
+}
+
+func (rsl *rawSuspendLocker) ReaderContext() context.Context {
+	return rsl.evicter.readerContext()
+}
+
+func (rsl *rawSuspendLocker) LastUsed() time.Time {
+	return rsl.lastUsed.Load()
+}
+
+func (rsl *rawSuspendLocker) SuspendCount() uint64 {
+	return rsl.suspendCount.Load()
+}
+
+func (rsl *rawSuspendLocker) ResumeCount() uint64 {
+	return rsl.resumeCount.Load()
+}
+
+func (rsl *rawSuspendLocker) State() SuspendState {
+	return SuspendState(rsl.state.Load())
+}
+
+func (rsl *rawSuspendLocker) NeedsResume() bool {
+	return rsl.State() == StateSuspended
+}
+
+func (rsl *rawSuspendLocker) Warm(ctx context.Context) error {
+	if rsl.ctxResource != nil {
+		return rsl.resumeContext(ctx)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- rsl.Resume()
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (rsl *rawSuspendLocker) Ready(ctx context.Context) error {
+	return rsl.ready(ctx, rsl.Warm)
+}
+
+// ready checks the readiness of the resource, warming it with warm.
+func (rsl *rawSuspendLocker) ready(ctx context.Context, warm func(context.Context) error) error {
+	if rsl.State() == StateClosed {
+		return &iox.ReadyError{Stage: "closed", Err: iox.ErrClosed}
+	}
+	if err := warm(ctx); err != nil {
+		return resumeReadyError(err)
+	}
+	if rsl.probe == nil {
+		return nil
+	}
+	if err := rsl.RLock(); err != nil {
+		return resumeReadyError(err)
+	}
+	defer rsl.RUnlock()
+	if err := rsl.probe(ctx); err != nil {
+		return &iox.ReadyError{Stage: "probe", Err: err}
+	}
+	return nil
+}
+
+func resumeReadyError(err error) *iox.ReadyError {
+	if iox.IsErrClosed(err) {
+		return &iox.ReadyError{Stage: "closed", Err: err}
+	}
+	return &iox.ReadyError{Stage: "resume", Err: err}
+}
+
+func newAutoSuspendLocker(s iox.Suspender, slo *SuspendLockerOpts) *autoSuspendLocker {
+	asl := &autoSuspendLocker{
+		rawSuspendLocker: newSuspendLocker(s, slo),
 		maxIdle:          slo.MaxIdleTime,
-		timer:            time.AfterFunc(slo.MaxIdleTime, trySuspend),
+		minOpen:          slo.MinOpenTime,
+		jitter:           slo.SuspendJitter,
+		warmHold:         slo.WarmHoldTime,
 	}
+	asl.timerLock.Lock()
+	d := asl.idleTime()
+	asl.nextSuspend.Store(time.Now().Add(d))
+	asl.timer = time.AfterFunc(d, asl.trySuspend)
+	asl.timerLock.Unlock()
+	return asl
 }
 
 type autoSuspendLocker struct {
 	*rawSuspendLocker
-	maxIdle   time.Duration
-	timer     *time.Timer
-	timerLock sync.Mutex
+	maxIdle  time.Duration
+	minOpen  time.Duration
+	jitter   time.Duration
+	warmHold time.Duration
+	// heldUntil is the time before which the resource must not be
+	// suspended, as set by Warm and Extend.
+	heldUntil   AtomicTime
+	nextSuspend AtomicTime
+	timer       *time.Timer
+	timerLock   sync.Mutex
+}
+
+// idleTime returns the idle time before the next suspend, including jitter.
+func (asl *autoSuspendLocker) idleTime() time.Duration {
+	if asl.jitter <= 0 {
+		return asl.maxIdle
+	}
+	return asl.maxIdle + time.Duration(rand.Int63n(int64(asl.jitter)))
+}
+
+func (asl *autoSuspendLocker) trySuspend() {
+	var wait time.Duration
+	if resumedAt := asl.resumedAt.Load(); !resumedAt.IsZero() {
+		wait = asl.minOpen - time.Since(resumedAt)
+	}
+	if holdWait := time.Until(asl.heldUntil.Load()); wait < holdWait {
+		wait = holdWait
+	}
+	if wait > 0 {
+		asl.timerLock.Lock()
+		asl.timer.Reset(wait)
+		asl.nextSuspend.Store(time.Now().Add(wait))
+		asl.timerLock.Unlock()
+		return
+	}
+	asl.suspend(true)
+}
+
+func (asl *autoSuspendLocker) Warm(ctx context.Context) error {
+	asl.hold(time.Now().Add(asl.warmHold))
+	err := asl.rawSuspendLocker.Warm(ctx)
+	if err == nil {
+		asl.resetTimer()
+	}
+	return err
+}
+
+func (asl *autoSuspendLocker) Ready(ctx context.Context) error {
+	return asl.ready(ctx, asl.Warm)
+}
+
+func (asl *autoSuspendLocker) RLockContext(ctx context.Context) error {
+	err := asl.rlockContext(ctx, asl.rawSuspendLocker.RLock)
+	if err != nil {
+		return err
+	}
+	asl.resetTimer()
+	return nil
+}
+
+func (asl *autoSuspendLocker) RLockN(ctx context.Context, n int64) error {
+	return asl.rlockN(ctx, n, asl.RLock)
 }
 
 func (asl *autoSuspendLocker) stopTimer() bool {
@@ -247,7 +703,39 @@ func (asl *autoSuspendLocker) stopTimer() bool {
 func (asl *autoSuspendLocker) resetTimer() bool {
 	asl.timerLock.Lock()
 	defer asl.timerLock.Unlock()
-	return asl.timer.Reset(asl.maxIdle)
+	d := asl.idleTime()
+	asl.nextSuspend.Store(time.Now().Add(d))
+	return asl.timer.Reset(d)
+}
+
+// hold prevents the resource from being suspended before t.
+func (asl *autoSuspendLocker) hold(t time.Time) {
+	for {
+		old := asl.heldUntil.Load()
+		if !old.Before(t) || asl.heldUntil.CompareAndSwap(old, t) {
+			return
+		}
+	}
+}
+
+func (asl *autoSuspendLocker) NextSuspendAt() time.Time {
+	if asl.State() != StateResumed {
+		return time.Time{}
+	}
+	next := asl.nextSuspend.Load()
+	if held := asl.heldUntil.Load(); next.Before(held) {
+		next = held
+	}
+	if resumedAt := asl.resumedAt.Load(); !resumedAt.IsZero() {
+		if minOpen := resumedAt.Add(asl.minOpen); next.Before(minOpen) {
+			next = minOpen
+		}
+	}
+	return next
+}
+
+func (asl *autoSuspendLocker) Extend(d time.Duration) {
+	asl.hold(time.Now().Add(d))
 }
 
 func (asl *autoSuspendLocker) Close() error {
@@ -257,10 +745,10 @@ func (asl *autoSuspendLocker) Close() error {
 
 func (asl *autoSuspendLocker) Lock() {
 	asl.rawSuspendLocker.Lock()
-	// No need to grab the lock for the timer here, as the lock we've grabbed
-	// denies anyone to do anything with the resource until we unlock it.
+	// The lock we've grabbed denies anyone to do anything with the resource
+	// until we unlock it, but the timer may still be rescheduled by MinOpenTime.
 	if !asl.rawSuspendLocker.closed {
-		asl.timer.Reset(asl.maxIdle)
+		asl.resetTimer()
 	}
 }
 
@@ -5,13 +5,18 @@
 package syncx
 
 import (
+	"context"
 	"errors"
+	"io"
+	"reflect"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"testing/quick"
 	"time"
 
 	"github.com/hypirion/gluten/iox"
+	"github.com/hypirion/gluten/syncx/schedtest"
 )
 
 const (
@@ -20,6 +25,35 @@ const (
 	suspendStateClosed
 )
 
+// fullCloseLocker and fullSuspendLocker are the optional interfaces
+// implemented by the lockers from this package. Auto-suspending lockers
+// additionally implement Leaser.
+type fullCloseLocker interface {
+	CloseLocker
+	TryLocker
+	ReaderEvicter
+	CloseNotifier
+	CloseWaiter
+}
+
+type fullSuspendLocker interface {
+	SuspendLocker
+	ReaderEvicter
+	SuspendInspector
+	Warmer
+	ContextRLocker
+	CapacityLocker
+	iox.Readier
+}
+
+func testCloseLocker(c io.Closer) fullCloseLocker {
+	return NewCloseLocker(c).(fullCloseLocker)
+}
+
+func testSuspendLocker(s iox.Suspender, slo *SuspendLockerOpts) fullSuspendLocker {
+	return NewSuspendLocker(s, slo).(fullSuspendLocker)
+}
+
 var errDummyCloser = errors.New("dummy closer close error")
 
 type dummyCloser struct {
@@ -35,7 +69,7 @@ func (dc *dummyCloser) Close() error {
 }
 
 func TestCloseLocker(t *testing.T) {
-	cl := NewCloseLocker(&dummyCloser{})
+	cl := testCloseLocker(&dummyCloser{})
 	// Test a couple of times
 	for i := 0; i < 10; i++ {
 		err := cl.Close()
@@ -48,7 +82,7 @@ func TestCloseLocker(t *testing.T) {
 		t.Fatalf("Expected err to be ErrClosed, but was %s", err)
 	}
 
-	cl = NewCloseLocker(&dummyCloser{closed: true}) // To force error
+	cl = testCloseLocker(&dummyCloser{closed: true}) // To force error
 	for i := 0; i < 10; i++ {
 		err := cl.Close()
 		if err != errDummyCloser {
@@ -64,6 +98,104 @@ func TestCloseLocker(t *testing.T) {
 	defer cl.Unlock()
 }
 
+func TestCloseLockerHooks(t *testing.T) {
+	dc := &dummyCloser{closed: true}
+	cl := testCloseLocker(dc)
+	var calls []string
+	cl.OnClose(func() { calls = append(calls, "closed") })
+	cl.OnCloseFailure(func(err error) { calls = append(calls, err.Error()) })
+
+	cl.Close()
+	dc.closed = false
+	cl.Close()
+	cl.Close()
+	cl.OnClose(func() { calls = append(calls, "late") })
+
+	expected := []string{errDummyCloser.Error(), "closed", "late"}
+	if !reflect.DeepEqual(calls, expected) {
+		t.Errorf("Expected hooks to be called as %v, but was %v", expected, calls)
+	}
+}
+
+func TestCloseLockerCloseWait(t *testing.T) {
+	dc := &dummyCloser{}
+	cl := testCloseLocker(dc)
+	cl.RLock()
+	cl.RLock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	n, err := cl.CloseWait(ctx)
+	if n != 2 || err != context.DeadlineExceeded {
+		t.Fatalf("Expected (2, DeadlineExceeded), got (%d, %v)", n, err)
+	}
+	if dc.closed {
+		t.Fatal("Expected resource to stay open after CloseWait timed out")
+	}
+	cl.RUnlock()
+	cl.RUnlock()
+
+	n, err = cl.CloseWait(context.Background())
+	if n != 0 || err != nil {
+		t.Fatalf("Expected (0, nil), got (%d, %v)", n, err)
+	}
+	if !dc.closed {
+		t.Fatal("Expected resource to be closed")
+	}
+}
+
+func TestCloseLockerCloseWaitDoesNotBlockReaders(t *testing.T) {
+	dc := &dummyCloser{}
+	cl := testCloseLocker(dc)
+	cl.RLock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := cl.CloseWait(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("Expected DeadlineExceeded, got %v", err)
+	}
+
+	locked := make(chan error, 1)
+	go func() { locked <- cl.RLock() }()
+	select {
+	case err := <-locked:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(500 * time.Millisecond):
+		t.Fatal("RLock blocked after a timed out CloseWait")
+	}
+	cl.RUnlock()
+	cl.RUnlock()
+	if err := cl.Close(); err != nil || !dc.closed {
+		t.Fatalf("Expected resource to be closed, got %v", err)
+	}
+}
+
+func TestCloseLockerTryLock(t *testing.T) {
+	cl := testCloseLocker(&dummyCloser{})
+	if !cl.TryLock() {
+		t.Fatal("Expected TryLock to succeed on an unlocked locker")
+	}
+	if ok, err := cl.TryRLock(); ok || err != nil {
+		t.Fatalf("Expected TryRLock to fail without error while write locked, got (%v, %v)", ok, err)
+	}
+	cl.Unlock()
+
+	if ok, err := cl.TryRLock(); !ok || err != nil {
+		t.Fatalf("Expected TryRLock to succeed, got (%v, %v)", ok, err)
+	}
+	if cl.TryLock() {
+		t.Fatal("Expected TryLock to fail while read locked")
+	}
+	cl.RUnlock()
+
+	cl.Close()
+	if ok, err := cl.TryRLock(); ok || !iox.IsErrClosed(err) {
+		t.Fatalf("Expected TryRLock to return ErrClosed, got (%v, %v)", ok, err)
+	}
+}
+
 type dummySuspender struct {
 	mut          sync.Mutex
 	suspendState int
@@ -107,7 +239,7 @@ func (ds *dummySuspender) Close() error {
 
 func TestBasicSuspendLocker(t *testing.T) {
 	ds := &dummySuspender{}
-	sl := NewSuspendLocker(ds, nil)
+	sl := testSuspendLocker(ds, nil)
 	err := sl.Suspend()
 	if err != nil {
 		t.Fatal(err)
@@ -148,9 +280,70 @@ func TestBasicSuspendLocker(t *testing.T) {
 	}
 }
 
+func TestSuspendLockerSchedules(t *testing.T) {
+	schedtest.Explore(t, nil, func(s *schedtest.Sched) {
+		ds := &dummySuspender{}
+		sl := testSuspendLocker(ds, nil)
+		s.Go(func(g *schedtest.G) {
+			sl.Suspend()
+			g.Yield()
+			sl.Close()
+		})
+		s.Go(func(g *schedtest.G) {
+			if sl.RLock() != nil {
+				return
+			}
+			g.Yield()
+			ds.mut.Lock()
+			state := ds.suspendState
+			ds.mut.Unlock()
+			sl.RUnlock()
+			if state != suspendStateOpen {
+				t.Errorf("Expected suspender to be open while read locked, but was in state %d", state)
+			}
+		})
+		s.Wait()
+		if ds.suspendState != suspendStateClosed {
+			t.Errorf("Expected suspender to be closed, but was in state %d", ds.suspendState)
+		}
+	})
+}
+
+func TestSuspendLockerStats(t *testing.T) {
+	sl := testSuspendLocker(&dummySuspender{suspendState: suspendStateSuspended},
+		&SuspendLockerOpts{AlreadySuspended: true})
+	if sl.State() != StateSuspended || !sl.LastUsed().IsZero() {
+		t.Fatalf("Expected unused, suspended locker, got state %s, last used %s", sl.State(), sl.LastUsed())
+	}
+	before := time.Now()
+	sl.RLock()
+	sl.RUnlock()
+	if sl.State() != StateResumed || sl.LastUsed().Before(before) {
+		t.Fatalf("Expected used, resumed locker, got state %s, last used %s", sl.State(), sl.LastUsed())
+	}
+	lastUsed := sl.LastUsed()
+	time.Sleep(1 * time.Millisecond)
+	sl.Suspend()
+	sl.Suspend()
+	sl.RLock()
+	sl.RUnlock()
+	sl.Suspend()
+	if sl.SuspendCount() != 2 || sl.ResumeCount() != 2 {
+		t.Fatalf("Expected 2 suspends and 2 resumes, got %d and %d", sl.SuspendCount(), sl.ResumeCount())
+	}
+	if !sl.LastUsed().After(lastUsed) {
+		t.Fatal("Expected RLock to update LastUsed")
+	}
+	lastUsed = sl.LastUsed()
+	sl.Close()
+	if sl.State() != StateClosed || !sl.LastUsed().Equal(lastUsed) {
+		t.Fatalf("Expected closed locker without new use, got state %s, last used %s", sl.State(), sl.LastUsed())
+	}
+}
+
 func TestSuspendLockerIdempotent(t *testing.T) {
 	f := func(operators []bool) bool {
-		slock := NewSuspendLocker(&dummySuspender{}, nil)
+		slock := testSuspendLocker(&dummySuspender{}, nil)
 		var toplevelErr error
 		var errMut sync.Mutex
 		var wg sync.WaitGroup
@@ -184,7 +377,7 @@ func TestSuspendLockerIdempotent(t *testing.T) {
 
 func TestAutoSuspendLocker(t *testing.T) {
 	ds := &dummySuspender{}
-	asl := NewSuspendLocker(ds, &SuspendLockerOpts{MaxIdleTime: 1 * time.Millisecond})
+	asl := testSuspendLocker(ds, &SuspendLockerOpts{MaxIdleTime: 1 * time.Millisecond})
 	for i := 0; i < 100; i++ {
 		time.Sleep(300 * time.Nanosecond)
 		err := asl.RLock()
@@ -200,3 +393,318 @@ func TestAutoSuspendLocker(t *testing.T) {
 		t.Fatalf("Unexpected suspend state: %d", state)
 	}
 }
+
+func TestSuspendLockerHooks(t *testing.T) {
+	suspends := make(chan bool, 10)
+	var resumes int32
+	asl := testSuspendLocker(&dummySuspender{}, &SuspendLockerOpts{
+		MaxIdleTime: 10 * time.Millisecond,
+		OnSuspend: func(auto bool, err error) {
+			if err != nil {
+				t.Errorf("Unexpected suspend error: %v", err)
+			}
+			suspends <- auto
+		},
+		OnResume: func(err error) {
+			atomic.AddInt32(&resumes, 1)
+		},
+	})
+	select {
+	case auto := <-suspends:
+		if !auto {
+			t.Error("Expected idle suspend to be reported as automatic")
+		}
+	case <-time.After(1 * time.Second):
+		t.Fatal("Timed out waiting for automatic suspend")
+	}
+	asl.RLock()
+	asl.RUnlock()
+	asl.Lock()
+	asl.Unlock()
+	asl.Close()
+	if n := atomic.LoadInt32(&resumes); n != 1 {
+		t.Errorf("Expected one resume, got %d", n)
+	}
+
+	sl := testSuspendLocker(&dummySuspender{}, &SuspendLockerOpts{
+		OnSuspend: func(auto bool, err error) { suspends <- auto },
+	})
+	sl.Suspend()
+	sl.Suspend()
+	if auto := <-suspends; auto {
+		t.Error("Expected explicit suspend not to be reported as automatic")
+	}
+	if len(suspends) != 0 {
+		t.Error("Expected no-op suspend not to be reported")
+	}
+}
+
+func TestAutoSuspendLockerMinOpenTime(t *testing.T) {
+	suspended := make(chan time.Time, 1)
+	asl := testSuspendLocker(&dummySuspender{suspendState: suspendStateSuspended}, &SuspendLockerOpts{
+		AlreadySuspended: true,
+		MaxIdleTime:      5 * time.Millisecond,
+		MinOpenTime:      50 * time.Millisecond,
+		SuspendJitter:    5 * time.Millisecond,
+		OnSuspend:        func(bool, error) { suspended <- time.Now() },
+	})
+	defer asl.Close()
+	start := time.Now()
+	asl.RLock()
+	asl.RUnlock()
+	select {
+	case at := <-suspended:
+		if d := at.Sub(start); d < 45*time.Millisecond {
+			t.Errorf("Expected resource to stay open for MinOpenTime, but was suspended after %s", d)
+		}
+	case <-time.After(1 * time.Second):
+		t.Fatal("Timed out waiting for automatic suspend")
+	}
+}
+
+func TestSuspendLockerWarm(t *testing.T) {
+	ds := &dummySuspender{suspendState: suspendStateSuspended}
+	sl := testSuspendLocker(ds, &SuspendLockerOpts{
+		AlreadySuspended: true,
+		MaxIdleTime:      5 * time.Millisecond,
+		WarmHoldTime:     50 * time.Millisecond,
+	})
+	defer sl.Close()
+	if !sl.NeedsResume() {
+		t.Fatal("Expected suspended locker to need a resume")
+	}
+	if err := sl.Warm(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if sl.NeedsResume() {
+		t.Fatal("Expected warmed locker not to need a resume")
+	}
+	time.Sleep(20 * time.Millisecond)
+	if sl.State() != StateResumed {
+		t.Fatal("Expected warmed locker to stay resumed for WarmHoldTime")
+	}
+	time.Sleep(60 * time.Millisecond)
+	if sl.State() != StateSuspended {
+		t.Fatal("Expected locker to be suspended after WarmHoldTime")
+	}
+}
+
+func TestSuspendLockerReady(t *testing.T) {
+	errProbe := errors.New("probe failed")
+	var probeErr error
+	ds := &dummySuspender{suspendState: suspendStateSuspended}
+	sl := testSuspendLocker(ds, &SuspendLockerOpts{
+		AlreadySuspended: true,
+		ReadyProbe: func(ctx context.Context) error {
+			if ds.suspendState != suspendStateOpen {
+				t.Error("Expected probe to run on a resumed resource")
+			}
+			return probeErr
+		},
+	})
+	var _ iox.Readier = sl
+	if err := sl.Ready(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	probeErr = errProbe
+	var re *iox.ReadyError
+	if err := sl.Ready(context.Background()); !errors.As(err, &re) || re.Stage != "probe" || re.Err != errProbe {
+		t.Fatalf("Expected probe failure, got %v", err)
+	}
+	sl.Close()
+	if err := sl.Ready(context.Background()); !errors.As(err, &re) || re.Stage != "closed" {
+		t.Fatalf("Expected closed failure, got %v", err)
+	}
+}
+
+func TestSuspendLockerRLockN(t *testing.T) {
+	sl := testSuspendLocker(&dummySuspender{}, &SuspendLockerOpts{Capacity: 10})
+	defer sl.Close()
+	ctx := context.Background()
+	if err := sl.RLockN(ctx, 11); err != ErrCapacityExceeded {
+		t.Fatalf("Expected ErrCapacityExceeded, got %v", err)
+	}
+	if err := sl.RLockN(ctx, 6); err != nil {
+		t.Fatal(err)
+	}
+	if err := sl.RLockN(ctx, 4); err != nil {
+		t.Fatal(err)
+	}
+	timeout, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if err := sl.RLockN(timeout, 1); err != context.DeadlineExceeded {
+		t.Fatalf("Expected RLockN to wait for capacity, got %v", err)
+	}
+	acquired := make(chan error)
+	go func() { acquired <- sl.RLockN(ctx, 5) }()
+	time.Sleep(5 * time.Millisecond)
+	sl.RUnlockN(4)
+	select {
+	case <-acquired:
+		t.Fatal("Expected RLockN to wait until enough capacity was released")
+	case <-time.After(5 * time.Millisecond):
+	}
+	sl.RUnlockN(6)
+	if err := <-acquired; err != nil {
+		t.Fatal(err)
+	}
+	sl.RUnlockN(5)
+
+	sl.Close()
+	if err := sl.RLockN(ctx, 1); !iox.IsErrClosed(err) {
+		t.Fatalf("Expected ErrClosed, got %v", err)
+	}
+}
+
+type slowSuspender struct {
+	dummySuspender
+	delay time.Duration
+}
+
+func (ss *slowSuspender) Resume() error {
+	time.Sleep(ss.delay)
+	return ss.dummySuspender.Resume()
+}
+
+func TestSuspendLockerRLockContext(t *testing.T) {
+	ss := &slowSuspender{dummySuspender: dummySuspender{suspendState: suspendStateSuspended}, delay: 50 * time.Millisecond}
+	sl := testSuspendLocker(ss, &SuspendLockerOpts{AlreadySuspended: true})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := sl.RLockContext(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("Expected DeadlineExceeded, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 40*time.Millisecond {
+		t.Fatalf("Expected RLockContext to give up at the deadline, took %s", elapsed)
+	}
+	// The resume continues in the background, and the abandoned read lock is
+	// released, so Close does not block.
+	if err := sl.RLockContext(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	sl.RUnlock()
+	if ss.suspendState != suspendStateOpen {
+		t.Fatal("Expected resource to be resumed")
+	}
+	if err := sl.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := sl.RLockContext(context.Background()); !iox.IsErrClosed(err) {
+		t.Fatalf("Expected ErrClosed, got %v", err)
+	}
+}
+
+// ctxSuspender is a suspender which can only be resumed through
+// ResumeContext, waiting until ctx is done.
+type ctxSuspender struct {
+	dummySuspender
+	resumeCalls int
+}
+
+func (cs *ctxSuspender) CloseContext(ctx context.Context) error {
+	return cs.Close()
+}
+
+func (cs *ctxSuspender) SuspendContext(ctx context.Context) error {
+	return cs.Suspend()
+}
+
+func (cs *ctxSuspender) ResumeContext(ctx context.Context) error {
+	cs.resumeCalls++
+	if cs.resumeCalls == 1 {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	return cs.dummySuspender.Resume()
+}
+
+func (cs *ctxSuspender) Resume() error {
+	panic("Resume called on a ContextSuspender")
+}
+
+func TestSuspendLockerContextSuspender(t *testing.T) {
+	cs := &ctxSuspender{dummySuspender: dummySuspender{suspendState: suspendStateSuspended}}
+	sl := testSuspendLocker(cs, &SuspendLockerOpts{AlreadySuspended: true})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := sl.RLockContext(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("Expected DeadlineExceeded, got %v", err)
+	}
+	// the canceled resume left the resource suspended
+	if !sl.NeedsResume() {
+		t.Fatal("Expected resource to still be suspended")
+	}
+	if err := sl.Warm(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if cs.suspendState != suspendStateOpen || cs.resumeCalls != 2 {
+		t.Fatalf("Expected resource to be resumed through ResumeContext, got %d calls", cs.resumeCalls)
+	}
+	if err := sl.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSuspendLockerContextSuspenderContention(t *testing.T) {
+	cs := &ctxSuspender{}
+	sl := testSuspendLocker(cs, nil)
+	if err := sl.RLock(); err != nil {
+		t.Fatal(err)
+	}
+	// A pending writer makes the read lock contended.
+	writerDone := make(chan struct{})
+	go func() {
+		sl.Lock()
+		sl.Unlock()
+		close(writerDone)
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := sl.Warm(ctx); err != nil {
+		t.Fatalf("Expected Warm on a resumed resource to succeed, got %v", err)
+	}
+	if err := sl.RLockContext(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("Expected DeadlineExceeded, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 200*time.Millisecond {
+		t.Fatalf("Expected the deadline to be honored, took %s", elapsed)
+	}
+	sl.RUnlock()
+	<-writerDone
+	if cs.resumeCalls != 0 {
+		t.Fatalf("Expected no resume of a resumed resource, got %d", cs.resumeCalls)
+	}
+	sl.Close()
+}
+
+func TestAutoSuspendLockerExtend(t *testing.T) {
+	ds := &dummySuspender{}
+	sl := testSuspendLocker(ds, &SuspendLockerOpts{MaxIdleTime: 10 * time.Millisecond})
+	defer sl.Close()
+	lease := sl.(Leaser)
+	if next := lease.NextSuspendAt(); time.Until(next) > 10*time.Millisecond || next.IsZero() {
+		t.Fatalf("Expected next suspend within MaxIdleTime, got %v", next)
+	}
+	lease.Extend(60 * time.Millisecond)
+	if until := time.Until(lease.NextSuspendAt()); until < 50*time.Millisecond {
+		t.Fatalf("Expected Extend to push back the next suspend, it is in %s", until)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if sl.State() != StateResumed {
+		t.Fatal("Expected extended locker to stay resumed")
+	}
+	time.Sleep(60 * time.Millisecond)
+	if sl.State() != StateSuspended {
+		t.Fatal("Expected locker to be suspended once the extension ran out")
+	}
+	if !lease.NextSuspendAt().IsZero() {
+		t.Fatal("Expected no next suspend for a suspended locker")
+	}
+	if _, ok := NewSuspendLocker(&dummySuspender{}, nil).(Leaser); ok {
+		t.Fatal("Expected no Leaser without MaxIdleTime")
+	}
+}
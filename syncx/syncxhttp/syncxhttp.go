@@ -0,0 +1,42 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package syncxhttp provides an HTTP handler for diagnosing contention on the
+// lockers registered in a syncx.LockMonitor.
+//
+// The handler is typically mounted under a debug path:
+//
+//	mux.Handle("/debug/locks", syncxhttp.Handler(monitor))
+//
+// GET requests return a JSON list of syncx.LockStats, sorted by name. Durations
+// are reported in nanoseconds.
+package syncxhttp
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/hypirion/gluten/syncx"
+)
+
+// Handler returns an HTTP handler for the lockers in m.
+func Handler(m *syncx.LockMonitor) http.Handler {
+	return &handler{m: m}
+}
+
+type handler struct {
+	m *syncx.LockMonitor
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(h.m.Stats())
+}
@@ -0,0 +1,41 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package syncxhttp
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hypirion/gluten/syncx"
+)
+
+type nopCloser struct{}
+
+func (nopCloser) Close() error { return nil }
+
+func TestHandler(t *testing.T) {
+	m := syncx.NewLockMonitor()
+	cl := m.MonitorCloseLocker("db", syncx.NewCloseLocker(nopCloser{}))
+	cl.Lock()
+	defer cl.Unlock()
+
+	rec := httptest.NewRecorder()
+	Handler(m).ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	var stats []syncx.LockStats
+	if err := json.NewDecoder(rec.Body).Decode(&stats); err != nil {
+		t.Fatal(err)
+	}
+	if len(stats) != 1 || stats[0].Name != "db" || !stats[0].Writer {
+		t.Fatalf("Unexpected stats: %+v", stats)
+	}
+
+	rec = httptest.NewRecorder()
+	Handler(m).ServeHTTP(rec, httptest.NewRequest("POST", "/", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405 on POST, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import (
+	"context"
+	"sync"
+)
+
+// Coalescer is an idempotent task runner where every submission carries a
+// value. Values submitted while a task is queued or running are merged, and the
+// next run gets the merged value. A typical use is to submit sets of dirty keys
+// and merge them through set union, so that every dirty key is processed
+// without tracking them outside the runner.
+//
+// If a run fails, its value is merged back in front of the values submitted
+// since, and is retried with the next run.
+type Coalescer[T any] struct {
+	idem       *Idempotent
+	merge      func(acc, v T) T
+	run        func(v T) error
+	mut        sync.Mutex
+	pending    T
+	hasPending bool
+}
+
+// NewCoalescer creates a new coalescer running run with the merged values.
+// merge is called with the value accumulated so far and a newer value, and
+// returns their merge. It is called while holding a lock, and must not call
+// back into the coalescer. The options are those of the underlying idempotent
+// runner. If opts is nil, the default options are used.
+func NewCoalescer[T any](merge func(acc, v T) T, run func(v T) error, opts *IdempotentOpts) *Coalescer[T] {
+	return &Coalescer[T]{
+		idem:  NewIdempotentWithOpts(opts),
+		merge: merge,
+		run:   run,
+	}
+}
+
+// add merges v into the pending value. Must be called while holding mut.
+func (c *Coalescer[T]) add(v T) {
+	if c.hasPending {
+		c.pending = c.merge(c.pending, v)
+	} else {
+		c.pending, c.hasPending = v, true
+	}
+}
+
+// Submit merges v into the pending value, and makes sure a run picking it up
+// is queued. It returns false if the coalescer is closed, in which case v is
+// discarded. Values submitted concurrently with Close may be discarded too.
+func (c *Coalescer[T]) Submit(v T) bool {
+	if c.idem.isClosed() {
+		return false
+	}
+	c.mut.Lock()
+	c.add(v)
+	c.mut.Unlock()
+	// If the task is dropped, the queued run picks v up.
+	c.idem.RunEventuallyErr(c.flush)
+	return true
+}
+
+// flush runs the task with the pending value, if there is one.
+func (c *Coalescer[T]) flush() error {
+	c.mut.Lock()
+	v, ok := c.pending, c.hasPending
+	var zero T
+	c.pending, c.hasPending = zero, false
+	c.mut.Unlock()
+	if !ok {
+		return nil
+	}
+	err := c.run(v)
+	if err != nil {
+		c.mut.Lock()
+		newer, ok := c.pending, c.hasPending
+		c.pending = v
+		if ok {
+			c.pending = c.merge(v, newer)
+		}
+		c.hasPending = true
+		c.mut.Unlock()
+	}
+	return err
+}
+
+// Close makes the coalescer reject new values. A run already queued still
+// runs.
+func (c *Coalescer[T]) Close() error {
+	return c.idem.Close()
+}
+
+// Drain waits until no run is queued or running, or until ctx is done, in
+// which case it returns ctx.Err().
+func (c *Coalescer[T]) Drain(ctx context.Context) error {
+	return c.idem.Drain(ctx)
+}
+
+// Status returns the status of the underlying task runner.
+func (c *Coalescer[T]) Status() RunnerStatus {
+	status := c.idem.Status()
+	status.Kind = "coalescer"
+	return status
+}
@@ -0,0 +1,65 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func union(acc, v map[string]bool) map[string]bool {
+	for k := range v {
+		acc[k] = true
+	}
+	return acc
+}
+
+func keys(m map[string]bool) []string {
+	var ks []string
+	for k := range m {
+		ks = append(ks, k)
+	}
+	sort.Strings(ks)
+	return ks
+}
+
+func TestCoalescer(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	var runs [][]string
+	fail := true
+	c := NewCoalescer(union, func(dirty map[string]bool) error {
+		if len(runs) == 0 {
+			close(started)
+			<-release
+		}
+		runs = append(runs, keys(dirty))
+		if fail {
+			fail = false
+			return errors.New("failed")
+		}
+		return nil
+	}, nil)
+	c.Submit(map[string]bool{"a": true})
+	<-started
+	c.Submit(map[string]bool{"b": true})
+	c.Submit(map[string]bool{"c": true, "b": true})
+	close(release)
+	c.Drain(context.Background())
+	c.Submit(map[string]bool{"d": true})
+	c.Drain(context.Background())
+
+	// the keys of the failed run are retried with the ones submitted since
+	expected := [][]string{{"a"}, {"a", "b", "c"}, {"d"}}
+	if !reflect.DeepEqual(runs, expected) {
+		t.Fatalf("Expected runs %v, got %v", expected, runs)
+	}
+	c.Close()
+	if c.Submit(map[string]bool{"e": true}) {
+		t.Fatal("Expected closed coalescer to reject values")
+	}
+}
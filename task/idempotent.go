@@ -4,6 +4,31 @@
 
 package task
 
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hypirion/gluten/clock"
+	"github.com/hypirion/gluten/syncx"
+	"github.com/hypirion/gluten/syncx/promise"
+)
+
+// ErrRunnerClosed is the error promises returned by RunEventuallyPromise are
+// delivered with if the runner is closed.
+var ErrRunnerClosed = errors.New("task runner is closed")
+
+// ErrTaskDropped is the error of a RunHandle for a task which was dropped, as
+// another task was already queued or the runner was closed.
+var ErrTaskDropped = errors.New("task dropped")
+
+// ErrTaskCanceled is the error of a RunHandle for a task which was canceled
+// before it started.
+var ErrTaskCanceled = errors.New("task canceled")
+
 // Idempotent is a task runner designed for time dependent idempotent tasks: If
 // it is okay to throw away some tasks, provided one one of the tasks will be
 // ran after this task was posted, then this is a good fit. Typical use cases
@@ -13,27 +38,255 @@ package task
 // More technically: An idempotent task runner can do one of three actions,
 // depending on the current statue of the runner:
 //
-//   1. No task running, no queue: Task is ran immediately
-//   2. Task is running, no queue: Task is queued
-//   3. Task is running, one task in queue: Task is dropped
+//  1. No task running, no queue: Task is ran immediately
+//  2. Task is running, no queue: Task is queued
+//  3. Task is running, one task in queue: Task is dropped
 //
 // Whenever a task has finished running, a queued task will immediately run.
 type Idempotent struct {
 	queue       chan struct{}
 	ready       chan struct{}
 	initialised bool
+	failureTTL  time.Duration
+	policy      FailurePolicy
+	onError     func(error)
+	debounce    time.Duration
+	minInterval time.Duration
+	clock       clock.Clock
+	pool        *Pool
+	stats       runStats
+	// closing is cancelled by Close, and cuts short the waits before a task
+	// runs.
+	closing       context.Context
+	cancelClosing context.CancelFunc
+	// lastRequest is the time of the last run request, and startedAt the time
+	// the last task started.
+	lastRequest syncx.AtomicTime
+	startedAt   syncx.AtomicTime
+	// mut protects closed, pending, idle and queued. pending is the number of
+	// tasks queued or running, and idle is closed when it drops to zero. queued
+	// is delivered once the queued task has run, if anyone is waiting for it.
+	mut     sync.Mutex
+	closed  bool
+	pending int
+	idle    chan struct{}
+	queued  *promise.Promise
+	// failedUntil, lastStart, started and running are only accessed while
+	// holding the ready token.
+	failedUntil time.Time
+	lastStart   time.Time
+	started     time.Time
+	running     *promise.Promise
+}
+
+// FailurePolicy decides what an idempotent task runner does with a task that
+// failed.
+type FailurePolicy int
+
+const (
+	// Drop drops failed tasks. This is the default.
+	Drop FailurePolicy = iota
+	// RequeueOnce queues a failed task to run one more time, unless another
+	// task is already queued, in which case that task runs in its place. A task
+	// failing a second time is dropped. Only tasks run through RunEventuallyErr
+	// are requeued, as RunSyncErr must finish before returning.
+	RequeueOnce
+)
+
+// IdempotentOpts are options that can be passed to NewIdempotentWithOpts.
+type IdempotentOpts struct {
+	// FailureTTL is the amount of time a failure is remembered. If a task ran
+	// through RunSyncErr or RunEventuallyErr fails, the next task will not run
+	// before the TTL has passed. Tasks posted while waiting are coalesced as
+	// usual. If zero, failures are not remembered.
+	FailureTTL time.Duration
+	// OnFailure is the policy applied to failed tasks. If unset, failed tasks
+	// are dropped.
+	OnFailure FailurePolicy
+	// OnError, if set, is called with the error of every failed task, after the
+	// runner is ready for the next task.
+	OnError func(error)
+	// Debounce is the quiet period the runner waits for before running a task:
+	// A queued task does not run until no task has been posted for the duration
+	// of Debounce, coalescing bursts of tasks into a single run. If zero, tasks
+	// run as soon as the runner is ready.
+	Debounce time.Duration
+	// MinInterval is the minimal duration between the start of two tasks. Tasks
+	// posted in between are coalesced as usual, so the last one posted still
+	// runs once the interval has passed. If zero, tasks are not throttled.
+	MinInterval time.Duration
+	// Clock is the source of time for the runner, used for FailureTTL,
+	// Debounce, MinInterval and the times reported by Status. Use a clock.Sim
+	// to fast-forward through failures in tests. If unset, the real clock is
+	// used.
+	Clock clock.Clock
 }
 
 // NewIdempotent creates a new idempotent task runner.
 func NewIdempotent() (idem *Idempotent) {
+	return NewIdempotentWithOpts(nil)
+}
+
+// NewIdempotentWithOpts creates a new idempotent task runner with the provided
+// options. If opts is nil, the default options are used.
+func NewIdempotentWithOpts(opts *IdempotentOpts) (idem *Idempotent) {
 	idem = new(Idempotent)
 	idem.queue = make(chan struct{}, 1)
 	idem.ready = make(chan struct{}, 1)
 	idem.ready <- struct{}{}
 	idem.initialised = true
+	idem.clock = clock.Real
+	idem.closing, idem.cancelClosing = context.WithCancel(context.Background())
+	if opts != nil {
+		idem.failureTTL = opts.FailureTTL
+		idem.policy = opts.OnFailure
+		idem.onError = opts.OnError
+		idem.debounce = opts.Debounce
+		idem.minInterval = opts.MinInterval
+		if opts.Clock != nil {
+			idem.clock = opts.Clock
+		}
+	}
 	return idem
 }
 
+// acquire waits for the runner, then takes the task out of the queue.
+func (idem *Idempotent) acquire() {
+	idem.wait()
+	idem.take()
+}
+
+// wait waits until the runner is ready, any remembered failure has expired and
+// the minimal interval and debounce period have passed. Once the runner is
+// closed, the task no longer waits.
+func (idem *Idempotent) wait() {
+	<-idem.ready
+	if wait := idem.failedUntil.Sub(idem.clock.Now()); wait > 0 {
+		clock.Sleep(idem.closing, idem.clock, wait)
+	}
+	if idem.minInterval > 0 && !idem.lastStart.IsZero() {
+		wait := idem.lastStart.Add(idem.minInterval).Sub(idem.clock.Now())
+		if wait > 0 {
+			clock.Sleep(idem.closing, idem.clock, wait)
+		}
+	}
+	for idem.debounce > 0 {
+		quietAt := idem.lastRequest.Load().Add(idem.debounce)
+		wait := quietAt.Sub(idem.clock.Now())
+		if wait <= 0 {
+			break
+		}
+		if clock.Sleep(idem.closing, idem.clock, wait) != nil {
+			break
+		}
+	}
+}
+
+// take takes the task out of the queue once the runner is ready, and records
+// that it started.
+func (idem *Idempotent) take() {
+	idem.mut.Lock()
+	<-idem.queue
+	idem.running, idem.queued = idem.queued, nil
+	idem.mut.Unlock()
+	now := idem.clock.Now()
+	idem.startedAt.Store(now)
+	if idem.minInterval > 0 {
+		idem.lastStart = now
+	}
+	idem.started = idem.stats.start(idem.clock)
+}
+
+// enqueue queues a task, and returns false if the runner is closed or a task is
+// already queued.
+func (idem *Idempotent) enqueue() bool {
+	idem.mut.Lock()
+	defer idem.mut.Unlock()
+	return idem.enqueueLocked()
+}
+
+// enqueueLocked is like enqueue, but must be called while holding mut.
+func (idem *Idempotent) enqueueLocked() bool {
+	if idem.closed {
+		idem.stats.drop()
+		return false
+	}
+	select {
+	case idem.queue <- struct{}{}:
+	default:
+		idem.stats.drop()
+		return false
+	}
+	idem.stats.accept()
+	idem.pending++
+	if idem.pending == 1 {
+		idem.idle = make(chan struct{})
+	}
+	return true
+}
+
+// request records that a task was posted, for debouncing.
+func (idem *Idempotent) request() {
+	if idem.debounce > 0 {
+		idem.lastRequest.Store(idem.clock.Now())
+	}
+}
+
+// release records the outcome of a task and readies the runner for the next.
+func (idem *Idempotent) release(err error) {
+	idem.stats.finish(idem.clock, idem.started, err)
+	running := idem.running
+	idem.running = nil
+	if err != nil && idem.failureTTL > 0 {
+		idem.failedUntil = idem.clock.Now().Add(idem.failureTTL)
+	} else {
+		idem.failedUntil = time.Time{}
+	}
+	idem.ready <- struct{}{}
+	idem.mut.Lock()
+	idem.pending--
+	if idem.pending == 0 {
+		close(idem.idle)
+	}
+	idem.mut.Unlock()
+	if running != nil && err != nil {
+		running.DeliverError(err)
+	} else if running != nil {
+		running.Deliver(nil)
+	}
+	if err != nil && idem.onError != nil {
+		idem.onError(err)
+	}
+}
+
+// skip gives up the queued task without running it once the runner is ready,
+// and delivers err to the requests it covered. The skipped task is not counted
+// as a run.
+func (idem *Idempotent) skip(err error) {
+	idem.mut.Lock()
+	<-idem.queue
+	covered := idem.queued
+	idem.queued = nil
+	idem.mut.Unlock()
+	idem.ready <- struct{}{}
+	idem.mut.Lock()
+	idem.pending--
+	if idem.pending == 0 {
+		close(idem.idle)
+	}
+	idem.mut.Unlock()
+	if covered != nil {
+		covered.DeliverError(err)
+	}
+}
+
+func noErr(f func()) func() error {
+	return func() error {
+		f()
+		return nil
+	}
+}
+
 // RunSync runs the task f if there are no other tasks waiting to be run,
 // blocking until it has finished. If there are other tasks waiting to be run,
 // this does nothing. Returns true if the task has been run, false otherwise.
@@ -42,21 +295,28 @@ func NewIdempotent() (idem *Idempotent) {
 // resources (e.g. SQL transactions) that has to be manually closed or managed
 // in some other way outside of the task.
 func (idem *Idempotent) RunSync(f func()) bool {
+	return idem.RunSyncErr(noErr(f))
+}
+
+// RunSyncErr is like RunSync, but f may fail. If the runner was created with a
+// FailureTTL, a failure delays the next task until the TTL has passed. Note
+// that this means RunSyncErr may block for the remainder of a previous
+// failure's TTL, the minimal interval or the debounce period before running f.
+func (idem *Idempotent) RunSyncErr(f func() error) bool {
 	if !idem.initialised {
 		panic("Idempotent task runner not initialised")
 	}
 
-	select {
-	case idem.queue <- struct{}{}:
-	default:
+	idem.request()
+	if !idem.enqueue() {
 		return false
 	}
-	<-idem.ready
-	<-idem.queue
+	idem.acquire()
+	var err error
 	defer func() {
-		idem.ready <- struct{}{}
+		idem.release(err)
 	}()
-	f()
+	err = f()
 	return true
 }
 
@@ -65,20 +325,264 @@ func (idem *Idempotent) RunSync(f func()) bool {
 // this does nothing. Returns true if the task will be run eventually or
 // straight away, false otherwise.
 func (idem *Idempotent) RunEventually(f func()) bool {
+	return idem.RunEventuallyErr(noErr(f))
+}
+
+// RunEventuallyTimeout is like RunEventuallyErr, but f is passed a context
+// which times out after d. If f is still running at that point, onTimeout is
+// called (if non-nil), and the timeout is counted in the runner's status. A
+// task which timed out fails with the context error, unless f returned another
+// error.
+//
+// The timeout only cancels f cooperatively, through its context: The runner is
+// held until f returns, so that tasks never overlap, and a task ignoring the
+// context still occupies the runner for as long as it runs.
+func (idem *Idempotent) RunEventuallyTimeout(d time.Duration, f func(ctx context.Context) error, onTimeout func()) bool {
+	return idem.RunEventuallyErr(func() error {
+		return runTimeout(&idem.stats, d, f, onTimeout)
+	})
+}
+
+// RunEventuallyErr is like RunEventually, but f may fail. If the runner was
+// created with a FailureTTL, a failure delays the next task until the TTL has
+// passed. If the runner was created with the RequeueOnce policy, a failed f is
+// requeued.
+func (idem *Idempotent) RunEventuallyErr(f func() error) bool {
 	if !idem.initialised {
 		panic("Idempotent task runner not initialised")
 	}
 
+	idem.request()
+	if !idem.enqueue() {
+		return false
+	}
+	idem.spawn(f, idem.policy == RequeueOnce)
+	return true
+}
+
+// spawn runs the queued task f in the background, on the worker pool of the
+// runner's RunnerSet if it has one. It never blocks: If the pool is full, or
+// the set is closing, the task is already queued and must run, so it runs in
+// its own goroutine instead.
+func (idem *Idempotent) spawn(f func() error, requeue bool) {
+	idem.spawnFunc(func() { idem.runEventually(f, requeue) })
+}
+
+// spawnFunc is like spawn, but runs the queued task through run.
+func (idem *Idempotent) spawnFunc(run func()) {
+	if idem.pool != nil && idem.pool.TrySubmit(run) == nil {
+		return
+	}
+	go run()
+}
+
+// RunEventuallyPromise is like RunEventuallyErr, but returns a promise which is
+// delivered once a run covering this request has finished: If f is dropped
+// because another task is queued, the promise is delivered when that task has
+// run instead, as it starts after this request was made. The promise is
+// delivered with a nil value, or the error of the run if it failed. If the
+// runner is closed, the promise is delivered with ErrRunnerClosed right away.
+//
+// Callers may wait on the promise for freshness, or ignore it.
+func (idem *Idempotent) RunEventuallyPromise(f func() error) *promise.Promise {
+	if !idem.initialised {
+		panic("Idempotent task runner not initialised")
+	}
+
+	idem.request()
+	idem.mut.Lock()
+	if idem.closed {
+		idem.mut.Unlock()
+		p := promise.New()
+		p.DeliverError(ErrRunnerClosed)
+		return p
+	}
+	enqueued := idem.enqueueLocked()
+	if idem.queued == nil {
+		idem.queued = promise.New()
+	}
+	p := idem.queued
+	idem.mut.Unlock()
+	if enqueued {
+		idem.spawn(f, idem.policy == RequeueOnce)
+	}
+	return p
+}
+
+// runEventually runs the queued task f, and requeues it on failure if requeue
+// is true.
+func (idem *Idempotent) runEventually(f func() error, requeue bool) {
+	idem.acquire()
+	err := f()
+	// Requeue before releasing, so that Drain doesn't miss the retry.
+	requeued := err != nil && requeue && idem.enqueue()
+	idem.release(err)
+	if requeued {
+		idem.runEventually(f, false)
+	}
+}
+
+// Status returns the status of the task runner. A task waiting for a failure
+// TTL to expire counts as queued.
+func (idem *Idempotent) Status() RunnerStatus {
+	return idem.stats.status("idempotent", len(idem.queue))
+}
+
+// Close makes the runner reject new tasks: Subsequent calls to the Run methods
+// do nothing and return false. A task already queued still runs, but no longer
+// waits for a failure TTL, the minimal interval or the debounce period. Use
+// Drain to wait for it and any running task to finish.
+func (idem *Idempotent) Close() error {
+	idem.mut.Lock()
+	defer idem.mut.Unlock()
+	idem.closed = true
+	idem.cancelClosing()
+	return nil
+}
+
+func (idem *Idempotent) isClosed() bool {
+	idem.mut.Lock()
+	defer idem.mut.Unlock()
+	return idem.closed
+}
+
+// Drain waits until no task is running or queued, or until ctx is done, in
+// which case it returns ctx.Err(). It is typically called after Close during a
+// graceful shutdown. If the runner is not closed, new tasks may be posted
+// while Drain waits, so it may not return until the runner is idle.
+func (idem *Idempotent) Drain(ctx context.Context) error {
+	idem.mut.Lock()
+	if idem.pending == 0 {
+		idem.mut.Unlock()
+		return nil
+	}
+	idle := idem.idle
+	idem.mut.Unlock()
 	select {
-	case idem.queue <- struct{}{}:
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// RunAtLeastEvery makes sure the runner runs a task at least every
+// maxStaleness, until ctx is done: Whenever no task has started within
+// maxStaleness, f is posted through RunEventuallyErr. If no task has started
+// yet, f is posted right away. Tasks posted by other means count, so f only
+// runs when the runner is otherwise idle for too long.
+// To avoid synchronised runs across processes, the interval is shortened by a
+// random duration between 0 and jitter, which must be shorter than
+// maxStaleness. RunAtLeastEvery panics if maxStaleness is not positive, or if
+// jitter is negative or not shorter than maxStaleness.
+//
+// RunAtLeastEvery blocks until ctx is done, and then returns ctx.Err().
+func (idem *Idempotent) RunAtLeastEvery(ctx context.Context, maxStaleness, jitter time.Duration, f func() error) error {
+	if maxStaleness <= 0 || jitter < 0 || maxStaleness <= jitter {
+		panic("task: RunAtLeastEvery needs 0 <= jitter < maxStaleness")
+	}
+	for {
+		interval := maxStaleness
+		if jitter > 0 {
+			interval -= time.Duration(rand.Int63n(int64(jitter)))
+		}
+		var wait time.Duration
+		if startedAt := idem.startedAt.Load(); !startedAt.IsZero() {
+			wait = startedAt.Add(interval).Sub(idem.clock.Now())
+		}
+		if wait <= 0 {
+			// If a task is already queued, it covers this one.
+			idem.RunEventuallyErr(f)
+			wait = interval
+		}
+		if err := clock.Sleep(ctx, idem.clock, wait); err != nil {
+			return err
+		}
+	}
+}
+
+// RunHandle is a handle to a task posted through RunEventuallyHandle.
+type RunHandle struct {
+	accepted bool
+	state    atomic.Int32
+	done     chan struct{}
+	err      error
+}
+
+const (
+	handleQueued int32 = iota
+	handleStarted
+	handleCanceled
+)
+
+// Accepted returns true if the task was queued, and false if it was dropped.
+func (h *RunHandle) Accepted() bool {
+	return h.accepted
+}
+
+// Done returns a channel that's closed when the task has finished, was
+// canceled or was dropped.
+func (h *RunHandle) Done() <-chan struct{} {
+	return h.done
+}
+
+// Err returns the error of the task once Done is closed: nil if it succeeded,
+// the error it failed with, ErrTaskCanceled or ErrTaskDropped. It returns nil
+// before Done is closed.
+func (h *RunHandle) Err() error {
+	select {
+	case <-h.done:
+		return h.err
 	default:
+		return nil
+	}
+}
+
+// Cancel withdraws the task if it has not started yet, and returns true if it
+// did. A canceled task still holds its place in the queue until the runner is
+// ready for it, and tasks dropped in its favour do not run either: Promises
+// from RunEventuallyPromise covered by the task are delivered with
+// ErrTaskCanceled. A canceled task is not counted as a run in the status of the
+// runner. Cancel is typically used when the resource the task would refresh is
+// being deleted.
+func (h *RunHandle) Cancel() bool {
+	if !h.state.CompareAndSwap(handleQueued, handleCanceled) {
 		return false
 	}
-	go func() {
-		<-idem.ready
-		<-idem.queue
-		f()
-		idem.ready <- struct{}{}
-	}()
+	h.err = ErrTaskCanceled
+	close(h.done)
 	return true
 }
+
+// RunEventuallyHandle is like RunEventuallyErr, but returns a handle to wait for
+// or cancel the task. Tasks posted through RunEventuallyHandle are never
+// requeued, regardless of the failure policy of the runner.
+func (idem *Idempotent) RunEventuallyHandle(f func() error) *RunHandle {
+	if !idem.initialised {
+		panic("Idempotent task runner not initialised")
+	}
+
+	h := &RunHandle{done: make(chan struct{})}
+	idem.request()
+	if !idem.enqueue() {
+		h.err = ErrTaskDropped
+		close(h.done)
+		return h
+	}
+	h.accepted = true
+	idem.spawnFunc(func() { idem.runHandle(h, f) })
+	return h
+}
+
+// runHandle runs the queued task f of h, or skips it if h was canceled.
+func (idem *Idempotent) runHandle(h *RunHandle, f func() error) {
+	idem.wait()
+	if !h.state.CompareAndSwap(handleQueued, handleStarted) {
+		idem.skip(ErrTaskCanceled)
+		return
+	}
+	idem.take()
+	h.err = f()
+	close(h.done)
+	idem.release(h.err)
+}
@@ -4,8 +4,12 @@
 package task
 
 import (
+	"context"
+	"errors"
 	"testing"
 	"time"
+
+	"github.com/hypirion/gluten/clock"
 )
 
 type intVal struct {
@@ -123,3 +127,407 @@ func TestIdempotentEventually3(t *testing.T) {
 	default:
 	}
 }
+
+func TestIdempotentFailureTTL(t *testing.T) {
+	idem := NewIdempotentWithOpts(&IdempotentOpts{FailureTTL: 50 * time.Millisecond})
+
+	idem.RunSyncErr(func() error { return errors.New("failed") })
+	start := time.Now()
+	var ranAt time.Time
+	ran := idem.RunSyncErr(func() error {
+		ranAt = time.Now()
+		return nil
+	})
+	if !ran {
+		t.Fatal("RunSyncErr should've been ran")
+	}
+	if elapsed := ranAt.Sub(start); elapsed < 40*time.Millisecond {
+		t.Errorf("Task ran %s after a failure, expected it to wait out the TTL", elapsed)
+	}
+
+	// the previous task succeeded, so this one should run right away
+	start = time.Now()
+	idem.RunSync(func() { ranAt = time.Now() })
+	if elapsed := ranAt.Sub(start); elapsed > 20*time.Millisecond {
+		t.Errorf("Task ran %s after a success, expected it to run immediately", elapsed)
+	}
+}
+
+func TestIdempotentSimulatedFailureTTL(t *testing.T) {
+	sim := clock.NewSim(time.Unix(0, 0))
+	idem := NewIdempotentWithOpts(&IdempotentOpts{FailureTTL: 24 * time.Hour, Clock: sim})
+	idem.RunSyncErr(func() error { return errors.New("failed") })
+	ranAt := make(chan time.Time, 1)
+	idem.RunEventually(func() { ranAt <- sim.Now() })
+	sim.BlockUntil(1)
+	sim.Advance(23 * time.Hour)
+	select {
+	case <-ranAt:
+		t.Fatal("Expected task to wait out the failure TTL")
+	case <-time.After(10 * time.Millisecond):
+	}
+	sim.Advance(1 * time.Hour)
+	if at := <-ranAt; !at.Equal(time.Unix(0, 0).Add(24 * time.Hour)) {
+		t.Fatalf("Expected task to run when the TTL expired, ran at %v", at)
+	}
+}
+
+func TestIdempotentCloseCutsFailureTTL(t *testing.T) {
+	idem := NewIdempotentWithOpts(&IdempotentOpts{FailureTTL: 1 * time.Hour})
+	idem.RunSyncErr(func() error { return errors.New("failed") })
+	ran := make(chan struct{})
+	idem.RunEventually(func() { close(ran) })
+	idem.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	if err := idem.Drain(ctx); err != nil {
+		t.Fatalf("Expected Drain after Close not to wait out the failure TTL, got %v", err)
+	}
+	<-ran
+}
+
+func TestIdempotentSimulatedStatus(t *testing.T) {
+	sim := clock.NewSim(time.Unix(1000, 0))
+	idem := NewIdempotentWithOpts(&IdempotentOpts{Clock: sim})
+	idem.RunSync(func() { sim.Advance(1 * time.Minute) })
+	s := idem.Status()
+	if !s.LastRun.Equal(time.Unix(1000, 0)) || s.LastDuration != 1*time.Minute {
+		t.Fatalf("Expected status times from the runner's clock, got %+v", s)
+	}
+}
+
+func TestIdempotentRequeueOnce(t *testing.T) {
+	errs := make(chan error, 10)
+	idem := NewIdempotentWithOpts(&IdempotentOpts{
+		OnFailure: RequeueOnce,
+		OnError:   func(err error) { errs <- err },
+	})
+	attempts := make(chan int, 10)
+	n := 0
+	idem.RunEventuallyErr(func() error {
+		n++
+		attempts <- n
+		return errors.New("failed")
+	})
+	for i := 1; i <= 2; i++ {
+		if attempt := <-attempts; attempt != i {
+			t.Fatalf("Expected attempt %d, got %d", i, attempt)
+		}
+		if err := <-errs; err == nil {
+			t.Fatal("Expected OnError to be called with the failure")
+		}
+	}
+	// wait for the runner to become idle, then make sure there was no third
+	// attempt
+	idem.RunSync(func() {})
+	select {
+	case attempt := <-attempts:
+		t.Fatalf("Expected task to be dropped after the requeue, got attempt %d", attempt)
+	default:
+	}
+}
+
+func TestIdempotentDebounce(t *testing.T) {
+	sim := clock.NewSim(time.Unix(0, 0))
+	idem := NewIdempotentWithOpts(&IdempotentOpts{Debounce: 1 * time.Second, Clock: sim})
+	ranAt := make(chan time.Time, 10)
+	run := func() { ranAt <- sim.Now() }
+	idem.RunEventually(run)
+	sim.BlockUntil(1)
+	// keep posting tasks within the quiet period
+	for i := 0; i < 5; i++ {
+		sim.Advance(500 * time.Millisecond)
+		idem.RunEventually(run)
+	}
+	sim.BlockUntil(1)
+	sim.Advance(1 * time.Second)
+	if at := <-ranAt; !at.Equal(time.Unix(0, 0).Add(3500 * time.Millisecond)) {
+		t.Fatalf("Expected the burst to run once it quieted down, ran at %v", at)
+	}
+	select {
+	case at := <-ranAt:
+		t.Fatalf("Expected the burst to be coalesced into one run, ran again at %v", at)
+	case <-time.After(10 * time.Millisecond):
+	}
+}
+
+func TestIdempotentMinInterval(t *testing.T) {
+	sim := clock.NewSim(time.Unix(0, 0))
+	idem := NewIdempotentWithOpts(&IdempotentOpts{MinInterval: 1 * time.Minute, Clock: sim})
+	ranAt := make(chan time.Time, 10)
+	run := func() { ranAt <- sim.Now() }
+	idem.RunSync(run)
+	if at := <-ranAt; !at.Equal(time.Unix(0, 0)) {
+		t.Fatalf("Expected first task to run immediately, ran at %v", at)
+	}
+	for i := 0; i < 3; i++ {
+		idem.RunEventually(run)
+	}
+	sim.BlockUntil(1)
+	sim.Advance(59 * time.Second)
+	select {
+	case at := <-ranAt:
+		t.Fatalf("Expected task to be throttled, ran at %v", at)
+	case <-time.After(10 * time.Millisecond):
+	}
+	sim.Advance(1 * time.Second)
+	if at := <-ranAt; !at.Equal(time.Unix(0, 0).Add(1 * time.Minute)) {
+		t.Fatalf("Expected trailing task to run after the interval, ran at %v", at)
+	}
+}
+
+func TestIdempotentCloseDrain(t *testing.T) {
+	idem := NewIdempotent()
+	started, release := make(chan struct{}), make(chan struct{})
+	var ran []int
+	idem.RunEventually(func() {
+		close(started)
+		<-release
+		ran = append(ran, 1)
+	})
+	<-started
+	idem.RunEventually(func() { ran = append(ran, 2) })
+	idem.Close()
+	if idem.RunEventually(func() { ran = append(ran, 3) }) {
+		t.Fatal("Expected closed runner to reject tasks")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := idem.Drain(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("Expected Drain to time out while a task runs, got %v", err)
+	}
+	close(release)
+	if err := idem.Drain(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(ran) != 2 || ran[0] != 1 || ran[1] != 2 {
+		t.Fatalf("Expected the running and queued task to finish, ran %v", ran)
+	}
+}
+
+func TestIdempotentRunEventuallyPromise(t *testing.T) {
+	idem := NewIdempotent()
+	started, release := make(chan struct{}), make(chan struct{})
+	var ran []int
+	first := idem.RunEventuallyPromise(func() error {
+		close(started)
+		<-release
+		ran = append(ran, 1)
+		return nil
+	})
+	<-started
+	second := idem.RunEventuallyPromise(func() error {
+		ran = append(ran, 2)
+		return errors.New("failed")
+	})
+	third := idem.RunEventuallyPromise(func() error {
+		ran = append(ran, 3)
+		return nil
+	})
+	if second != third {
+		t.Fatal("Expected the dropped request to share the queued run's promise")
+	}
+	close(release)
+	if _, err := first.Get(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := third.Get(context.Background()); err == nil {
+		t.Fatal("Expected the error of the covering run")
+	}
+	if len(ran) != 2 || ran[1] != 2 {
+		t.Fatalf("Expected the queued task to cover the dropped one, ran %v", ran)
+	}
+
+	idem.Close()
+	if _, err := idem.RunEventuallyPromise(func() error { return nil }).Get(context.Background()); err != ErrRunnerClosed {
+		t.Fatalf("Expected ErrRunnerClosed, got %v", err)
+	}
+}
+
+func TestIdempotentSimulatedDebounceDay(t *testing.T) {
+	sim := clock.NewSim(time.Unix(0, 0))
+	idem := NewIdempotentWithOpts(&IdempotentOpts{Debounce: 1 * time.Minute, Clock: sim})
+	ranAt := make(chan time.Duration, 10)
+	run := func() { ranAt <- sim.Now().Sub(time.Unix(0, 0)) }
+	// a burst of tasks every hour, each coalesced into a single run
+	for hour := time.Duration(0); hour < 24; hour++ {
+		for i := 0; i < 3; i++ {
+			idem.RunEventually(run)
+		}
+		sim.BlockUntil(1)
+		sim.Advance(1 * time.Minute)
+		if at := <-ranAt; at != hour*time.Hour+1*time.Minute {
+			t.Fatalf("Expected burst %d to run after the quiet period, ran at %v", hour, at)
+		}
+		sim.Advance(59 * time.Minute)
+	}
+	select {
+	case at := <-ranAt:
+		t.Fatalf("Expected one run per burst, ran again at %v", at)
+	default:
+	}
+}
+
+func TestIdempotentSimulatedWeek(t *testing.T) {
+	sim := clock.NewSim(time.Unix(0, 0))
+	idem := NewIdempotentWithOpts(&IdempotentOpts{Clock: sim})
+	ranAt := make(chan time.Duration)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- idem.RunAtLeastEvery(ctx, 1*time.Hour, 0, func() error {
+			ranAt <- sim.Now().Sub(time.Unix(0, 0))
+			return nil
+		})
+	}()
+	<-ranAt
+	for i := time.Duration(1); i <= 7*24; i++ {
+		sim.BlockUntil(1)
+		sim.Advance(1 * time.Hour)
+		if at := <-ranAt; at != i*time.Hour {
+			t.Fatalf("Expected hourly run %d at %v, ran at %v", i, i*time.Hour, at)
+		}
+	}
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Fatalf("Expected Canceled, got %v", err)
+	}
+}
+
+func TestIdempotentRunAtLeastEveryAtEpoch(t *testing.T) {
+	sim := clock.NewSim(time.Unix(0, 0))
+	idem := NewIdempotentWithOpts(&IdempotentOpts{Clock: sim})
+	idem.RunSync(func() {})
+	ranAt := make(chan time.Duration, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- idem.RunAtLeastEvery(ctx, 1*time.Minute, 0, func() error {
+			ranAt <- sim.Now().Sub(time.Unix(0, 0))
+			return nil
+		})
+	}()
+	// the task run at the epoch counts as a start
+	sim.BlockUntil(1)
+	sim.Advance(1 * time.Minute)
+	if at := <-ranAt; at != 1*time.Minute {
+		t.Fatalf("Expected first periodic run after a minute, ran at %v", at)
+	}
+	cancel()
+	<-done
+}
+
+func TestIdempotentRunAtLeastEveryInvalidJitter(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("Expected RunAtLeastEvery to panic when jitter is not shorter than maxStaleness")
+		}
+	}()
+	NewIdempotent().RunAtLeastEvery(context.Background(), 1*time.Minute, 1*time.Minute, func() error { return nil })
+}
+
+func TestIdempotentRunAtLeastEvery(t *testing.T) {
+	sim := clock.NewSim(time.Unix(0, 0))
+	idem := NewIdempotentWithOpts(&IdempotentOpts{Clock: sim})
+	ranAt := make(chan time.Duration, 10)
+	periodic := func() error {
+		ranAt <- sim.Now().Sub(time.Unix(0, 0))
+		return nil
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- idem.RunAtLeastEvery(ctx, 1*time.Minute, 0, periodic) }()
+	if at := <-ranAt; at != 0 {
+		t.Fatalf("Expected an initial run right away, ran at %v", at)
+	}
+
+	advance := func(d time.Duration) {
+		sim.BlockUntil(1)
+		sim.Advance(d)
+	}
+	advance(30 * time.Second)
+	idem.RunSync(func() {})
+	// the explicit run at 30s postpones the periodic one to 90s
+	advance(30 * time.Second)
+	select {
+	case at := <-ranAt:
+		t.Fatalf("Expected the explicit run to postpone the periodic run, ran at %v", at)
+	case <-time.After(10 * time.Millisecond):
+	}
+	advance(30 * time.Second)
+	if at := <-ranAt; at != 90*time.Second {
+		t.Fatalf("Expected periodic run at 90s, ran at %v", at)
+	}
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Fatalf("Expected Canceled, got %v", err)
+	}
+}
+
+func TestIdempotentRunHandle(t *testing.T) {
+	idem := NewIdempotent()
+	started, release := make(chan struct{}), make(chan struct{})
+	running := idem.RunEventuallyHandle(func() error {
+		close(started)
+		<-release
+		return errors.New("failed")
+	})
+	<-started
+	ran := false
+	queued := idem.RunEventuallyHandle(func() error {
+		ran = true
+		return nil
+	})
+	dropped := idem.RunEventuallyHandle(func() error { return nil })
+	if !running.Accepted() || !queued.Accepted() || dropped.Accepted() {
+		t.Fatal("Expected the third task to be dropped")
+	}
+	if <-dropped.Done(); dropped.Err() != ErrTaskDropped {
+		t.Fatalf("Expected ErrTaskDropped, got %v", dropped.Err())
+	}
+	if running.Cancel() {
+		t.Fatal("Expected running task to not be cancelable")
+	}
+	if !queued.Cancel() || queued.Err() != ErrTaskCanceled {
+		t.Fatalf("Expected queued task to be canceled, got %v", queued.Err())
+	}
+	close(release)
+	if <-running.Done(); running.Err() == nil {
+		t.Fatal("Expected the error of the running task")
+	}
+	idem.Drain(context.Background())
+	if ran {
+		t.Fatal("Expected canceled task to not run")
+	}
+}
+
+func TestIdempotentRunHandleCancelPromise(t *testing.T) {
+	idem := NewIdempotent()
+	started, release := make(chan struct{}), make(chan struct{})
+	idem.RunEventually(func() {
+		close(started)
+		<-release
+	})
+	<-started
+	queued := idem.RunEventuallyHandle(func() error { return nil })
+	p := idem.RunEventuallyPromise(func() error { return nil })
+	if !queued.Cancel() {
+		t.Fatal("Expected queued task to be canceled")
+	}
+	close(release)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := p.Get(ctx); err != ErrTaskCanceled {
+		t.Fatalf("Expected the promise to be delivered with ErrTaskCanceled, got %v", err)
+	}
+	if err := idem.Drain(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if s := idem.Status(); s.Runs != 1 || s.Queued != 0 {
+		t.Fatalf("Expected only the first task to count as a run, got %+v", s)
+	}
+	if !idem.RunSync(func() {}) {
+		t.Fatal("Expected the runner to accept tasks after the canceled one")
+	}
+}
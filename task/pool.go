@@ -0,0 +1,201 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hypirion/gluten/clock"
+)
+
+// ErrPoolClosed is returned when submitting tasks to a closed Pool.
+var ErrPoolClosed = errors.New("pool is closed")
+
+// ErrPoolFull is returned by TrySubmit when all the queues of a Pool are full.
+var ErrPoolFull = errors.New("pool is full")
+
+// PoolOpts are options that can be passed to NewPool.
+type PoolOpts struct {
+	// Workers is the number of worker goroutines. If unset, the value is set to
+	// runtime.GOMAXPROCS(0).
+	Workers int
+	// QueueSize is the number of tasks each worker can have queued before
+	// submitting to it blocks. If unset, the value is set to 64.
+	QueueSize int
+}
+
+// Pool is a fixed size pool of worker goroutines. Every worker has its own
+// queue, which lets tasks be pinned to a worker through an affinity key: Tasks
+// submitted with the same key run on the same worker, in submission order,
+// which preserves per-key ordering and cache locality. Tasks without a key are
+// spread across the workers.
+type Pool struct {
+	mut     sync.RWMutex
+	closed  bool
+	done    chan struct{}
+	sending sync.WaitGroup
+	queues  []chan func()
+	next    atomic.Uint32
+	wg      sync.WaitGroup
+	stats   runStats
+}
+
+// NewPool creates a new pool and starts its workers. If opts is nil, the
+// default options are used.
+func NewPool(opts *PoolOpts) *Pool {
+	var o PoolOpts
+	if opts != nil {
+		o = *opts
+	}
+	if o.Workers <= 0 {
+		o.Workers = runtime.GOMAXPROCS(0)
+	}
+	if o.QueueSize <= 0 {
+		o.QueueSize = 64
+	}
+	p := &Pool{
+		done:   make(chan struct{}),
+		queues: make([]chan func(), o.Workers),
+	}
+	for i := range p.queues {
+		p.queues[i] = make(chan func(), o.QueueSize)
+		p.wg.Add(1)
+		go p.work(p.queues[i])
+	}
+	return p
+}
+
+func (p *Pool) work(queue <-chan func()) {
+	defer p.wg.Done()
+	for f := range queue {
+		started := p.stats.start(clock.Real)
+		f()
+		p.stats.finish(clock.Real, started, nil)
+	}
+}
+
+// Submit queues f on the worker with the shortest queue, blocking while all
+// queues are full. It returns ErrPoolClosed if the pool is closed.
+func (p *Pool) Submit(f func()) error {
+	return p.submit(p.shortest(), f, true)
+}
+
+// TrySubmit is like Submit, but returns ErrPoolFull instead of blocking when
+// all queues are full.
+func (p *Pool) TrySubmit(f func()) error {
+	return p.submit(p.shortest(), f, false)
+}
+
+// shortest returns the worker with the shortest queue.
+func (p *Pool) shortest() int {
+	// Start at a rotating offset so that ties are spread across workers.
+	start := int(p.next.Add(1)) % len(p.queues)
+	best := start
+	for i := 1; i < len(p.queues); i++ {
+		idx := (start + i) % len(p.queues)
+		if len(p.queues[idx]) < len(p.queues[best]) {
+			best = idx
+		}
+	}
+	return best
+}
+
+// SubmitTimeout is like Submit, but f is passed a context which times out
+// after d. If f is still running at that point, onTimeout is called (if
+// non-nil), and the timeout is counted in the pool's status.
+//
+// The timeout only cancels f cooperatively, through its context: The worker is
+// held until f returns, so a task ignoring the context still occupies the
+// worker for as long as it runs.
+func (p *Pool) SubmitTimeout(d time.Duration, f func(ctx context.Context), onTimeout func()) error {
+	return p.Submit(func() {
+		runTimeout(&p.stats, d, func(ctx context.Context) error {
+			f(ctx)
+			return nil
+		}, onTimeout)
+	})
+}
+
+// SubmitKey queues f on the worker assigned to key, blocking while its queue is
+// full. Tasks with the same key run sequentially in submission order. It
+// returns ErrPoolClosed if the pool is closed.
+//
+// A task must not submit to a full queue of the worker it runs on, as that
+// worker cannot make room for it: The submission blocks until the pool is
+// closed.
+func (p *Pool) SubmitKey(key string, f func()) error {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return p.submit(int(h.Sum32()%uint32(len(p.queues))), f, true)
+}
+
+func (p *Pool) submit(worker int, f func(), block bool) error {
+	p.mut.RLock()
+	if p.closed {
+		p.mut.RUnlock()
+		p.stats.drop()
+		return ErrPoolClosed
+	}
+	p.sending.Add(1)
+	p.mut.RUnlock()
+	defer p.sending.Done()
+	if !block {
+		select {
+		case p.queues[worker] <- f:
+			p.stats.accept()
+			return nil
+		default:
+			return ErrPoolFull
+		}
+	}
+	// Don't block while holding the lock: Close must be able to unblock senders
+	// waiting on a full queue.
+	select {
+	case p.queues[worker] <- f:
+		p.stats.accept()
+		return nil
+	case <-p.done:
+		p.stats.drop()
+		return ErrPoolClosed
+	}
+}
+
+// Close stops the pool from accepting new tasks, and waits for all queued
+// tasks to finish. Submissions blocked on a full queue return ErrPoolClosed.
+// Subsequent calls to Close return nil immediately.
+//
+// Close must not be called from a task running on the pool: It waits for that
+// task to finish, and so never returns.
+func (p *Pool) Close() error {
+	p.mut.Lock()
+	if p.closed {
+		p.mut.Unlock()
+		return nil
+	}
+	p.closed = true
+	p.mut.Unlock()
+	close(p.done)
+	p.sending.Wait()
+	for _, queue := range p.queues {
+		close(queue)
+	}
+	p.wg.Wait()
+	return nil
+}
+
+// Status returns the status of the pool.
+func (p *Pool) Status() RunnerStatus {
+	queued := 0
+	for _, queue := range p.queues {
+		queued += len(queue)
+	}
+	return p.stats.status("pool", queued)
+}
@@ -0,0 +1,107 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPoolAffinity(t *testing.T) {
+	pool := NewPool(&PoolOpts{Workers: 4})
+	var mut sync.Mutex
+	seen := map[string][]int{}
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("key-%d", i%5)
+		i := i
+		pool.SubmitKey(key, func() {
+			mut.Lock()
+			seen[key] = append(seen[key], i)
+			mut.Unlock()
+		})
+	}
+	pool.Close()
+	for key, order := range seen {
+		for j := 1; j < len(order); j++ {
+			if order[j] < order[j-1] {
+				t.Fatalf("Expected tasks for %s to run in submission order, got %v", key, order)
+			}
+		}
+	}
+}
+
+func TestPool(t *testing.T) {
+	pool := NewPool(nil)
+	var count int32
+	for i := 0; i < 100; i++ {
+		pool.Submit(func() { atomic.AddInt32(&count, 1) })
+	}
+	pool.Close()
+	if count != 100 {
+		t.Errorf("Expected 100 tasks to run, got %d", count)
+	}
+	if err := pool.Submit(func() {}); err != ErrPoolClosed {
+		t.Errorf("Expected ErrPoolClosed, got %v", err)
+	}
+	if s := pool.Status(); s.Runs != 100 || s.Kind != "pool" {
+		t.Errorf("Unexpected status: %+v", s)
+	}
+}
+
+func TestPoolTrySubmit(t *testing.T) {
+	pool := NewPool(&PoolOpts{Workers: 1, QueueSize: 1})
+	release := make(chan struct{})
+	started := make(chan struct{})
+	pool.Submit(func() {
+		close(started)
+		<-release
+	})
+	<-started
+	if err := pool.TrySubmit(func() {}); err != nil {
+		t.Fatalf("Expected TrySubmit to queue the task, got %v", err)
+	}
+	if err := pool.TrySubmit(func() {}); err != ErrPoolFull {
+		t.Fatalf("Expected ErrPoolFull, got %v", err)
+	}
+	close(release)
+	pool.Close()
+	if err := pool.TrySubmit(func() {}); err != ErrPoolClosed {
+		t.Fatalf("Expected ErrPoolClosed, got %v", err)
+	}
+}
+
+func TestPoolSelfSubmitFullQueue(t *testing.T) {
+	pool := NewPool(&PoolOpts{Workers: 1, QueueSize: 1})
+	var ran atomic.Bool
+	submitted := make(chan error, 1)
+	blocked := make(chan struct{})
+	pool.SubmitKey("key", func() {
+		pool.SubmitKey("key", func() { ran.Store(true) })
+		close(blocked)
+		// The queue is full, and only this worker can make room for the task.
+		submitted <- pool.SubmitKey("key", func() {})
+	})
+	<-blocked
+
+	closed := make(chan struct{})
+	go func() {
+		pool.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("Close hung on a task submitting to its own full queue")
+	}
+	if err := <-submitted; err != ErrPoolClosed {
+		t.Fatalf("Expected blocked submission to return ErrPoolClosed, got %v", err)
+	}
+	if !ran.Load() {
+		t.Fatal("Expected queued task to run before Close returned")
+	}
+}
@@ -0,0 +1,175 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hypirion/gluten/clock"
+)
+
+// ErrDuplicateRunner is returned when adding a runner to a Registry under a
+// name which is already in use.
+var ErrDuplicateRunner = errors.New("runner name already in use")
+
+// RunnerStatus is a snapshot of the state of a task runner.
+type RunnerStatus struct {
+	// Name is the name the runner was registered with. It is filled in by the
+	// Registry.
+	Name string `json:"name"`
+	// Kind is the kind of runner, e.g. "idempotent".
+	Kind string `json:"kind"`
+	// Running is the number of tasks currently running.
+	Running int `json:"running"`
+	// Queued is the number of tasks waiting to be run.
+	Queued int `json:"queued"`
+	// Runs is the total number of tasks that have finished.
+	Runs uint64 `json:"runs"`
+	// Accepted is the total number of tasks the runner has accepted.
+	Accepted uint64 `json:"accepted"`
+	// Dropped is the total number of tasks the runner has dropped or rejected
+	// without running them.
+	Dropped uint64 `json:"dropped"`
+	// Timeouts is the total number of tasks that ran past their timeout.
+	Timeouts uint64 `json:"timeouts"`
+	// LastRun is the time the last task started, or the zero time if no task
+	// has started.
+	LastRun time.Time `json:"last_run"`
+	// LastDuration is how long the last finished task ran for.
+	LastDuration time.Duration `json:"last_duration"`
+	// LastError is the error of the last finished task, if it failed.
+	LastError string `json:"last_error,omitempty"`
+}
+
+// Inspector is implemented by task runners that can report their status.
+type Inspector interface {
+	Status() RunnerStatus
+}
+
+// Registry is a threadsafe collection of named task runners, used to list live
+// runners and their states, typically in admin endpoints.
+type Registry struct {
+	mut     sync.RWMutex
+	runners map[string]Inspector
+}
+
+// NewRegistry creates a new, empty registry.
+func NewRegistry() *Registry {
+	return &Registry{runners: make(map[string]Inspector)}
+}
+
+// Add adds r to the registry under the given name. If the name is already in
+// use, ErrDuplicateRunner is returned.
+func (reg *Registry) Add(name string, r Inspector) error {
+	reg.mut.Lock()
+	defer reg.mut.Unlock()
+	if _, ok := reg.runners[name]; ok {
+		return ErrDuplicateRunner
+	}
+	reg.runners[name] = r
+	return nil
+}
+
+// Remove removes the runner with the given name from the registry, if any.
+func (reg *Registry) Remove(name string) {
+	reg.mut.Lock()
+	defer reg.mut.Unlock()
+	delete(reg.runners, name)
+}
+
+// Get returns the runner with the given name, or nil if there is none.
+func (reg *Registry) Get(name string) Inspector {
+	reg.mut.RLock()
+	defer reg.mut.RUnlock()
+	return reg.runners[name]
+}
+
+// Statuses returns the status of all runners in the registry, sorted by name.
+func (reg *Registry) Statuses() []RunnerStatus {
+	reg.mut.RLock()
+	statuses := make([]RunnerStatus, 0, len(reg.runners))
+	for name, r := range reg.runners {
+		status := r.Status()
+		status.Name = name
+		statuses = append(statuses, status)
+	}
+	reg.mut.RUnlock()
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+	return statuses
+}
+
+// runStats tracks the status of a task runner.
+type runStats struct {
+	mut          sync.Mutex
+	running      int
+	runs         uint64
+	accepted     uint64
+	dropped      uint64
+	timeouts     uint64
+	lastRun      time.Time
+	lastDuration time.Duration
+	lastErr      error
+}
+
+func (rs *runStats) accept() {
+	rs.mut.Lock()
+	defer rs.mut.Unlock()
+	rs.accepted++
+}
+
+func (rs *runStats) drop() {
+	rs.mut.Lock()
+	defer rs.mut.Unlock()
+	rs.dropped++
+}
+
+func (rs *runStats) timeout() {
+	rs.mut.Lock()
+	defer rs.mut.Unlock()
+	rs.timeouts++
+}
+
+// start records that a task started, and returns the time it started at
+// according to c.
+func (rs *runStats) start(c clock.Clock) time.Time {
+	rs.mut.Lock()
+	defer rs.mut.Unlock()
+	rs.running++
+	rs.lastRun = c.Now()
+	return rs.lastRun
+}
+
+// finish records that the task started at started has finished.
+func (rs *runStats) finish(c clock.Clock, started time.Time, err error) {
+	rs.mut.Lock()
+	defer rs.mut.Unlock()
+	rs.running--
+	rs.runs++
+	rs.lastDuration = c.Now().Sub(started)
+	rs.lastErr = err
+}
+
+func (rs *runStats) status(kind string, queued int) RunnerStatus {
+	rs.mut.Lock()
+	defer rs.mut.Unlock()
+	status := RunnerStatus{
+		Kind:         kind,
+		Running:      rs.running,
+		Queued:       queued,
+		Runs:         rs.runs,
+		Accepted:     rs.accepted,
+		Dropped:      rs.dropped,
+		Timeouts:     rs.timeouts,
+		LastRun:      rs.lastRun,
+		LastDuration: rs.lastDuration,
+	}
+	if rs.lastErr != nil {
+		status.LastError = rs.lastErr.Error()
+	}
+	return status
+}
@@ -0,0 +1,45 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRegistry(t *testing.T) {
+	reg := NewRegistry()
+	idem := NewIdempotent()
+	if err := reg.Add("idem", idem); err != nil {
+		t.Fatal(err)
+	}
+	if err := reg.Add("idem", idem); err != ErrDuplicateRunner {
+		t.Fatalf("Expected ErrDuplicateRunner, got %v", err)
+	}
+
+	release := make(chan struct{})
+	idem.RunEventually(func() { <-release })
+	time.Sleep(10 * time.Millisecond)
+	idem.RunEventually(func() {})
+	idem.RunEventually(func() {})
+	s := reg.Statuses()[0]
+	if s.Running != 1 || s.Queued != 1 {
+		t.Errorf("Expected one running and one queued task, got %+v", s)
+	}
+	if s.Accepted != 2 || s.Dropped != 1 {
+		t.Errorf("Expected two accepted and one dropped task, got %+v", s)
+	}
+	close(release)
+	idem.Drain(context.Background())
+	if s := idem.Status(); s.Runs != 2 || s.LastDuration <= 0 {
+		t.Errorf("Expected two runs with a duration, got %+v", s)
+	}
+
+	reg.Remove("idem")
+	if reg.Get("idem") != nil || len(reg.Statuses()) != 0 {
+		t.Error("Expected runner to be removed")
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import (
+	"context"
+	"sync"
+)
+
+// RunnerSet is a set of idempotent task runners sharing a bounded worker pool.
+// Tasks posted to the runners through RunEventually and its variants run on
+// the pool instead of in their own goroutines, so that many runners becoming
+// busy at once, e.g. one per tenant, cannot spawn an unbounded number of
+// goroutines or connections. RunSync still runs tasks on the calling goroutine.
+//
+// A queued task occupies a worker while it waits for the task running before
+// it, as well as for any failure TTL, minimal interval or debounce period of
+// its runner. Size the pool accordingly. Posting a task never blocks: When all
+// workers are busy and their queues are full, the task runs in its own
+// goroutine instead, so that the bound is exceeded rather than deadlocking a
+// pool task which posts to a sibling runner.
+type RunnerSet struct {
+	pool    *Pool
+	mut     sync.Mutex
+	runners []*Idempotent
+}
+
+// NewRunnerSet creates a new runner set with a pool of the given number of
+// workers. If workers is zero, the value is set to runtime.GOMAXPROCS(0).
+func NewRunnerSet(workers int) *RunnerSet {
+	return &RunnerSet{pool: NewPool(&PoolOpts{Workers: workers})}
+}
+
+// NewIdempotent creates a new idempotent task runner in the set, with the
+// provided options. If opts is nil, the default options are used.
+func (s *RunnerSet) NewIdempotent(opts *IdempotentOpts) *Idempotent {
+	idem := NewIdempotentWithOpts(opts)
+	idem.pool = s.pool
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	s.runners = append(s.runners, idem)
+	return idem
+}
+
+// Close closes every runner in the set, then waits for their queued and running
+// tasks to finish before stopping the pool.
+func (s *RunnerSet) Close() error {
+	s.mut.Lock()
+	runners := s.runners
+	s.runners = nil
+	s.mut.Unlock()
+	for _, idem := range runners {
+		idem.Close()
+	}
+	err := s.pool.Close()
+	for _, idem := range runners {
+		// Tasks queued while the pool was closing run in their own goroutines.
+		idem.Drain(context.Background())
+	}
+	return err
+}
+
+// Status returns the status of the shared worker pool.
+func (s *RunnerSet) Status() RunnerStatus {
+	return s.pool.Status()
+}
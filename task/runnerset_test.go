@@ -0,0 +1,72 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRunnerSetBoundsConcurrency(t *testing.T) {
+	set := NewRunnerSet(2)
+	var running, maxRunning atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		idem := set.NewIdempotent(nil)
+		idem.RunEventually(func() {
+			defer wg.Done()
+			n := running.Add(1)
+			for {
+				max := maxRunning.Load()
+				if n <= max || maxRunning.CompareAndSwap(max, n) {
+					break
+				}
+			}
+			time.Sleep(5 * time.Millisecond)
+			running.Add(-1)
+		})
+	}
+	wg.Wait()
+	if max := maxRunning.Load(); max > 2 {
+		t.Fatalf("Expected at most 2 tasks to run at once, got %d", max)
+	}
+	if err := set.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if set.Status().Runs != 20 {
+		t.Fatalf("Expected 20 runs on the pool, got %+v", set.Status())
+	}
+}
+
+func TestRunnerSetSaturatedPool(t *testing.T) {
+	set := NewRunnerSet(1)
+	siblings := make([]*Idempotent, 100)
+	for i := range siblings {
+		siblings[i] = set.NewIdempotent(nil)
+	}
+	var wg sync.WaitGroup
+	wg.Add(len(siblings))
+	posted := make(chan struct{})
+	// The only worker posts more tasks than its queue can hold to sibling
+	// runners, which must not block on the pool.
+	set.NewIdempotent(nil).RunEventually(func() {
+		for _, idem := range siblings {
+			idem.RunEventually(wg.Done)
+		}
+		close(posted)
+	})
+	select {
+	case <-posted:
+	case <-time.After(time.Second):
+		t.Fatal("Posting to sibling runners blocked on the saturated pool")
+	}
+	wg.Wait()
+	if err := set.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
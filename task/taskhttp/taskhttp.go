@@ -0,0 +1,41 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package taskhttp provides an HTTP handler listing the task runners in a
+// task.Registry.
+//
+// The handler is typically mounted under a debug path:
+//
+//	mux.Handle("/debug/tasks", taskhttp.Handler(registry))
+//
+// GET requests return a JSON list of task.RunnerStatus, sorted by name.
+package taskhttp
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/hypirion/gluten/task"
+)
+
+// Handler returns an HTTP handler for the runners in reg.
+func Handler(reg *task.Registry) http.Handler {
+	return &handler{reg: reg}
+}
+
+type handler struct {
+	reg *task.Registry
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(h.reg.Statuses())
+}
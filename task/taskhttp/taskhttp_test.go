@@ -0,0 +1,37 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package taskhttp
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hypirion/gluten/task"
+)
+
+func TestHandler(t *testing.T) {
+	reg := task.NewRegistry()
+	idem := task.NewIdempotent()
+	if err := reg.Add("refresh-cache", idem); err != nil {
+		t.Fatal(err)
+	}
+	idem.RunSyncErr(func() error { return errors.New("db down") })
+
+	rec := httptest.NewRecorder()
+	Handler(reg).ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	var statuses []task.RunnerStatus
+	if err := json.NewDecoder(rec.Body).Decode(&statuses); err != nil {
+		t.Fatal(err)
+	}
+	if len(statuses) != 1 {
+		t.Fatalf("Expected one runner, got %+v", statuses)
+	}
+	s := statuses[0]
+	if s.Name != "refresh-cache" || s.Kind != "idempotent" || s.Runs != 1 || s.LastError != "db down" || s.LastRun.IsZero() {
+		t.Fatalf("Unexpected status: %+v", s)
+	}
+}
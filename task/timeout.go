@@ -0,0 +1,31 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import (
+	"context"
+	"time"
+)
+
+// runTimeout runs f with a context which times out after d. If f is still
+// running when the context times out, onTimeout is called (if non-nil)
+// concurrently with f, and the timeout is recorded in stats. runTimeout always
+// waits for f to return. If f timed out but returned nil, runTimeout returns
+// the context error.
+func runTimeout(stats *runStats, d time.Duration, f func(ctx context.Context) error, onTimeout func()) error {
+	ctx, cancel := context.WithTimeout(context.Background(), d)
+	defer cancel()
+	stop := context.AfterFunc(ctx, func() {
+		stats.timeout()
+		if onTimeout != nil {
+			onTimeout()
+		}
+	})
+	err := f(ctx)
+	if stop() || err != nil {
+		return err
+	}
+	return ctx.Err()
+}
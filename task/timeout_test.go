@@ -0,0 +1,86 @@
+// Copyright 2017 Jean Niklas L'orange.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestIdempotentRunEventuallyTimeoutFast(t *testing.T) {
+	idem := NewIdempotent()
+	timedOut := false
+	var ctxErr error
+	idem.RunEventuallyTimeout(1*time.Second, func(ctx context.Context) error {
+		ctxErr = ctx.Err()
+		return nil
+	}, func() {
+		timedOut = true
+	})
+	idem.RunSync(func() {})
+	if timedOut {
+		t.Error("Expected fast task to not time out")
+	}
+	if ctxErr != nil {
+		t.Errorf("Expected context to be live while running, but got %s", ctxErr)
+	}
+	if s := idem.Status(); s.Timeouts != 0 || s.LastError != "" {
+		t.Errorf("Expected no timeout to be recorded, got %+v", s)
+	}
+}
+
+func TestIdempotentRunEventuallyTimeout(t *testing.T) {
+	idem := NewIdempotent()
+	var running atomic.Int32
+	timedOut := make(chan struct{})
+	var taskErr error
+	idem.RunEventuallyTimeout(10*time.Millisecond, func(ctx context.Context) error {
+		running.Add(1)
+		defer running.Add(-1)
+		<-ctx.Done()
+		time.Sleep(10 * time.Millisecond) // cleanup after the timeout
+		return nil
+	}, func() { close(timedOut) })
+	<-timedOut
+	// The runner is held until the timed out task returns.
+	idem.RunSync(func() {
+		if running.Load() != 0 {
+			taskErr = errors.New("task overlapped the timed out one")
+		}
+	})
+	if taskErr != nil {
+		t.Fatal(taskErr)
+	}
+	s := idem.Status()
+	if s.Timeouts != 1 || s.Runs != 2 || s.LastError != "" {
+		t.Fatalf("Expected one timeout out of two runs, got %+v", s)
+	}
+}
+
+func TestPoolSubmitTimeout(t *testing.T) {
+	p := NewPool(&PoolOpts{Workers: 1})
+	var timeouts atomic.Int32
+	for _, d := range []time.Duration{1 * time.Millisecond, 1 * time.Second} {
+		err := p.SubmitTimeout(d, func(ctx context.Context) {
+			select {
+			case <-ctx.Done():
+			case <-time.After(50 * time.Millisecond):
+			}
+		}, func() { timeouts.Add(1) })
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	p.Close()
+	if n := timeouts.Load(); n != 1 {
+		t.Fatalf("Expected one timeout, got %d", n)
+	}
+	if s := p.Status(); s.Timeouts != 1 || s.Runs != 2 {
+		t.Fatalf("Expected one timeout recorded out of two runs, got %+v", s)
+	}
+}